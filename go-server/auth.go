@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 登录后签发短期的访问令牌（JWT）和长期的刷新令牌。刷新令牌为随机串，服务端只保存其 SHA-256，
+// 每次刷新时作废旧令牌并换发新令牌；已作废的刷新令牌再次被使用说明可能已泄露，同一次登录换发的令牌全部作废
+type tokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // 访问令牌的有效秒数
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 签发访问令牌和刷新令牌，familyID 为空表示新的一次登录
+func issueTokens(e execer, userID, username string, tokenVersion int, familyID string) (tokenPair, error) {
+	accessToken, err := generateToken(userID, username, tokenVersion)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return tokenPair{}, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+
+	if familyID == "" {
+		familyID = generateUUID()
+	}
+	expiresAt := time.Now().Add(cfg.Auth.RefreshTokenTTL)
+	_, err = e.Exec("INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?, ?)",
+		generateUUID(), userID, familyID, hashRefreshToken(refreshToken), backend.timeValue(expiresAt))
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(cfg.Auth.TokenTTL / time.Second),
+	}, nil
+}
+
+// 作废用户的全部登录：递增令牌版本使已签发的访问令牌失效，并作废全部刷新令牌。用户不存在时返回 false
+func revokeUserSessions(e execer, userID string) (bool, error) {
+	result, err := e.Exec("UPDATE users SET token_version = token_version + 1 WHERE id = ?", userID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	_, err = e.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		backend.timeValue(time.Now()), userID)
+	return err == nil, err
+}
+
+// 用刷新令牌换取新的访问令牌和刷新令牌，旧的刷新令牌随即作废
+func refreshTokens(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID, familyID string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRow("SELECT id, user_id, family_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?",
+		hashRefreshToken(req.RefreshToken)).Scan(&tokenID, &userID, &familyID, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	now := time.Now()
+	if revokedAt.Valid {
+		// 重复使用已作废的刷新令牌：作废这次登录换发的全部令牌，持有最新令牌的一方也需要重新登录
+		if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+			backend.timeValue(now), familyID); err == nil {
+			tx.Commit()
+		}
+		log.Printf("Warning: Revoked refresh token reused for user %s, session revoked", userID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token revoked"})
+		return
+	}
+	if now.After(expiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired"})
+		return
+	}
+
+	var username string
+	var disabled bool
+	var tokenVersion int
+	err = tx.QueryRow("SELECT username, disabled, token_version FROM users WHERE id = ?", userID).
+		Scan(&username, &disabled, &tokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账号已被禁用"})
+		return
+	}
+
+	// 并发使用同一个刷新令牌时只有一个请求能作废它并换发新令牌
+	result, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		backend.timeValue(now), tokenID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token revoked"})
+		return
+	}
+
+	tokens, err := issueTokens(tx, userID, username, tokenVersion, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// 退出登录：作废这次登录换发的全部刷新令牌。访问令牌在过期前仍然有效，客户端应一并丢弃；
+// 令牌不存在或已作废时同样返回成功
+func logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var familyID string
+	err := db.QueryRow("SELECT family_id FROM refresh_tokens WHERE token_hash = ?", hashRefreshToken(req.RefreshToken)).Scan(&familyID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err == nil {
+		_, err = db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+			backend.timeValue(time.Now()), familyID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+}
+
+// 退出当前用户在所有设备上的登录，包括本次请求使用的令牌
+func logoutAll(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	if _, err := revokeUserSessions(db, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions logged out"})
+}
+
+// 管理员强制用户退出所有登录
+func logoutUserAdmin(c *gin.Context) {
+	userID := c.Param("id")
+
+	found, err := revokeUserSessions(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout user"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User sessions logged out"})
+}
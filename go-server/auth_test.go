@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 按顺序执行的登录、刷新和退出步骤。use 为发送的令牌对（refreshToken 放在请求体中，
+// path 为 /api/auth/me 或 /api/auth/logout-all 时改用其访问令牌），save 保存响应中的新令牌对
+func TestRefreshTokenRotation(t *testing.T) {
+	r := setupTestServer(t)
+	registerTestUser(t, r, "alice")
+	sessions := map[string]tokenPair{"unknown": {RefreshToken: "not-a-token"}}
+
+	tests := []struct {
+		name       string
+		path       string
+		use        string
+		wantStatus int
+		save       string
+	}{
+		{"login", "/api/auth/login", "", http.StatusOK, "a1"},
+		{"rotate", "/api/auth/refresh", "a1", http.StatusOK, "a2"},
+		{"rotate again", "/api/auth/refresh", "a2", http.StatusOK, "a3"},
+		{"new access token works", "/api/auth/me", "a3", http.StatusOK, ""},
+		{"reuse of rotated token", "/api/auth/refresh", "a1", http.StatusUnauthorized, ""},
+		{"latest token of reused family", "/api/auth/refresh", "a3", http.StatusUnauthorized, ""},
+		{"unknown token", "/api/auth/refresh", "unknown", http.StatusUnauthorized, ""},
+
+		{"second login", "/api/auth/login", "", http.StatusOK, "b1"},
+		{"third login", "/api/auth/login", "", http.StatusOK, "c1"},
+		{"logout", "/api/auth/logout", "b1", http.StatusOK, ""},
+		{"refresh after logout", "/api/auth/refresh", "b1", http.StatusUnauthorized, ""},
+		{"logout is idempotent", "/api/auth/logout", "b1", http.StatusOK, ""},
+		{"other login unaffected", "/api/auth/refresh", "c1", http.StatusOK, "c2"},
+
+		{"logout everywhere", "/api/auth/logout-all", "c2", http.StatusOK, ""},
+		{"access token revoked", "/api/auth/me", "c2", http.StatusUnauthorized, ""},
+		{"refresh token revoked", "/api/auth/refresh", "c2", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w *httptest.ResponseRecorder
+			switch tt.path {
+			case "/api/auth/login":
+				w = doJSON(r, "POST", tt.path, "", gin.H{"username": "alice", "password": "secret"})
+			case "/api/auth/me":
+				w = doJSON(r, "GET", tt.path, sessions[tt.use].AccessToken, nil)
+			case "/api/auth/logout-all":
+				w = doJSON(r, "POST", tt.path, sessions[tt.use].AccessToken, nil)
+			default:
+				w = doJSON(r, "POST", tt.path, "", gin.H{"refreshToken": sessions[tt.use].RefreshToken})
+			}
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.save != "" {
+				var tokens tokenPair
+				decodeBody(t, w, &tokens)
+				if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+					t.Fatalf("missing tokens: %s", w.Body.String())
+				}
+				sessions[tt.save] = tokens
+			}
+		})
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	r := setupTestServer(t)
+	registerTestUser(t, r, "alice")
+
+	tests := []struct {
+		name       string
+		expiresIn  time.Duration
+		wantStatus int
+	}{
+		{"valid", time.Hour, http.StatusOK},
+		{"expired", -time.Minute, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doJSON(r, "POST", "/api/auth/login", "", gin.H{"username": "alice", "password": "secret"})
+			var tokens tokenPair
+			decodeBody(t, w, &tokens)
+			_, err := db.Exec("UPDATE refresh_tokens SET expires_at = ? WHERE token_hash = ?",
+				backend.timeValue(time.Now().Add(tt.expiresIn)), hashRefreshToken(tokens.RefreshToken))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w = doJSON(r, "POST", "/api/auth/refresh", "", gin.H{"refreshToken": tokens.RefreshToken})
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+// 访问令牌只接受 HS256 签名，即使换用其他算法的令牌内容与 token_version 都正确也会被拒绝
+func TestAccessTokenSigningMethod(t *testing.T) {
+	r := setupTestServer(t)
+	_, userID := registerTestUser(t, r, "alice")
+	claims := &Claims{
+		UserID:   userID,
+		Username: "alice",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		method     jwt.SigningMethod
+		key        interface{}
+		wantStatus int
+	}{
+		{"HS256", jwt.SigningMethodHS256, []byte(cfg.Auth.JWTSecret), http.StatusOK},
+		{"HS384 with same secret", jwt.SigningMethodHS384, []byte(cfg.Auth.JWTSecret), http.StatusForbidden},
+		{"HS512 with same secret", jwt.SigningMethodHS512, []byte(cfg.Auth.JWTSecret), http.StatusForbidden},
+		{"unsigned", jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(tt.method, claims).SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := doJSON(r, "GET", "/api/auth/me", token, nil)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
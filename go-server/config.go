@@ -0,0 +1,374 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// 服务配置。按 默认值 → 配置文件 → 环境变量 → 命令行参数 的顺序加载，后者覆盖前者，启动时校验
+type Config struct {
+	Env      string         `yaml:"env"` // development 或 production
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Upload   UploadConfig   `yaml:"upload"`
+	Media    MediaConfig    `yaml:"media"`
+	Import   ImportConfig   `yaml:"import"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"`
+}
+
+type DatabaseConfig struct {
+	Driver      string `yaml:"driver"` // mysql（默认）或 sqlite
+	Path        string `yaml:"path"`   // SQLite 数据库文件
+	Host        string `yaml:"host"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	Name        string `yaml:"name"`
+	AutoMigrate bool   `yaml:"auto_migrate"`
+}
+
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret"`
+	TokenTTL        time.Duration `yaml:"token_ttl"`         // 访问令牌（JWT）有效期
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"` // 刷新令牌有效期，每次刷新后重新计算
+	BcryptCost      int           `yaml:"bcrypt_cost"`
+}
+
+type CORSConfig struct {
+	AllowOrigins     []string `yaml:"allow_origins"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+}
+
+type UploadConfig struct {
+	MaxUploadMB int64 `yaml:"max_upload_mb"` // 题库文件
+	MaxMediaMB  int64 `yaml:"max_media_mb"`  // 单个媒体文件
+}
+
+type MediaConfig struct {
+	Storage string   `yaml:"storage"` // local 或 s3
+	Dir     string   `yaml:"dir"`
+	S3      S3Config `yaml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	Region    string `yaml:"region"`
+	Prefix    string `yaml:"prefix"`
+	PathStyle bool   `yaml:"path_style"`
+}
+
+type ImportConfig struct {
+	JobDir  string `yaml:"job_dir"`
+	Workers int    `yaml:"workers"`
+}
+
+const (
+	envDevelopment = "development"
+	envProduction  = "production"
+
+	// 默认的 JWT 密钥，只能用于开发环境
+	defaultJWTSecret = "your-secret-key-change-in-production"
+)
+
+// 当前配置，main 启动时由 loadConfig 替换
+var cfg = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		Env:    envDevelopment,
+		Server: ServerConfig{Port: 3005},
+		Database: DatabaseConfig{
+			Driver:      "mysql",
+			Path:        "./exam.db",
+			User:        "root",
+			Name:        "exam_db",
+			AutoMigrate: true,
+		},
+		Auth: AuthConfig{
+			JWTSecret:       defaultJWTSecret,
+			TokenTTL:        15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			BcryptCost:      14,
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{
+				"http://localhost:5173",
+				"http://localhost:5174",
+				"http://localhost:5175",
+				"http://localhost:5176",
+				"http://localhost:5177",
+				"http://119.91.68.147",
+				"http://119.91.68.147:80",
+				"http://119.91.68.147:5173",
+				"https://examtest.top",
+				"http://examtest.top",
+			},
+			AllowCredentials: true,
+		},
+		Upload: UploadConfig{MaxUploadMB: 50, MaxMediaMB: 10},
+		Media: MediaConfig{
+			Storage: "local",
+			Dir:     "uploads/media",
+			S3:      S3Config{Region: "us-east-1", PathStyle: true},
+		},
+		Import: ImportConfig{JobDir: "uploads/import-jobs", Workers: 2},
+	}
+}
+
+// 加载并校验配置，args 为命令行参数（不含程序名），返回参数之后剩余的部分（如 migrate 子命令）。
+// 配置文件由 -config 或环境变量 CONFIG_FILE 指定，未指定时存在 config.yaml 则读取
+func loadConfig(args []string) (*Config, []string, error) {
+	c := defaultConfig()
+
+	flags := flag.NewFlagSet("exam-server", flag.ContinueOnError)
+	configFile := flags.String("config", getEnv("CONFIG_FILE", ""), "配置文件路径（YAML）")
+	env := flags.String("env", "", "运行环境：development 或 production")
+	port := flags.Int("port", 0, "监听端口")
+	dbDriver := flags.String("db-driver", "", "数据库后端：mysql 或 sqlite")
+	dbPath := flags.String("db-path", "", "SQLite 数据库文件路径")
+	maxUploadMB := flags.Int64("max-upload-mb", 0, "题库文件上传大小上限（MB）")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	path, required := *configFile, true
+	if path == "" {
+		path, required = "config.yaml", false
+	}
+	if err := c.loadFile(path, required); err != nil {
+		return nil, nil, err
+	}
+	if err := c.applyEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	// 只覆盖命令行中给出的参数
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			c.Env = *env
+		case "port":
+			c.Server.Port = *port
+		case "db-driver":
+			c.Database.Driver = *dbDriver
+		case "db-path":
+			c.Database.Path = *dbPath
+		case "max-upload-mb":
+			c.Upload.MaxUploadMB = *maxUploadMB
+		}
+	})
+
+	if err := c.validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, flags.Args(), nil
+}
+
+// 读取 YAML 配置文件，文件中未出现的项保留默认值
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// 环境变量覆盖配置文件，变量名与之前版本保持一致
+func (c *Config) applyEnv() error {
+	var errs []string
+	str := func(key string, dst *string) {
+		if value := os.Getenv(key); value != "" {
+			*dst = value
+		}
+	}
+	num := func(key string, dst *int) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, key+" must be an integer")
+				return
+			}
+			*dst = n
+		}
+	}
+	num64 := func(key string, dst *int64) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, key+" must be an integer")
+				return
+			}
+			*dst = n
+		}
+	}
+	duration := func(key string, dst *time.Duration) {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, key+" must be a duration such as 15m or 720h")
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if value := os.Getenv(key); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, key+" must be true or false")
+				return
+			}
+			*dst = b
+		}
+	}
+
+	str("APP_ENV", &c.Env)
+	num("PORT", &c.Server.Port)
+
+	str("DB_DRIVER", &c.Database.Driver)
+	str("DB_PATH", &c.Database.Path)
+	str("DB_HOST", &c.Database.Host)
+	str("DB_USER", &c.Database.User)
+	str("DB_PASSWORD", &c.Database.Password)
+	str("DB_NAME", &c.Database.Name)
+	boolean("AUTO_MIGRATE", &c.Database.AutoMigrate)
+
+	str("JWT_SECRET", &c.Auth.JWTSecret)
+	duration("JWT_TTL", &c.Auth.TokenTTL)
+	duration("REFRESH_TOKEN_TTL", &c.Auth.RefreshTokenTTL)
+	num("BCRYPT_COST", &c.Auth.BcryptCost)
+
+	if value := os.Getenv("CORS_ALLOW_ORIGINS"); value != "" {
+		c.CORS.AllowOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORS.AllowOrigins = append(c.CORS.AllowOrigins, origin)
+			}
+		}
+	}
+	boolean("CORS_ALLOW_CREDENTIALS", &c.CORS.AllowCredentials)
+
+	num64("MAX_UPLOAD_MB", &c.Upload.MaxUploadMB)
+	num64("MAX_MEDIA_MB", &c.Upload.MaxMediaMB)
+
+	str("MEDIA_STORAGE", &c.Media.Storage)
+	str("MEDIA_DIR", &c.Media.Dir)
+	str("S3_ENDPOINT", &c.Media.S3.Endpoint)
+	str("S3_BUCKET", &c.Media.S3.Bucket)
+	str("S3_ACCESS_KEY", &c.Media.S3.AccessKey)
+	str("S3_SECRET_KEY", &c.Media.S3.SecretKey)
+	str("S3_REGION", &c.Media.S3.Region)
+	str("S3_PREFIX", &c.Media.S3.Prefix)
+	boolean("S3_PATH_STYLE", &c.Media.S3.PathStyle)
+
+	str("IMPORT_JOB_DIR", &c.Import.JobDir)
+	num("IMPORT_WORKERS", &c.Import.Workers)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// 校验配置，全部问题一起返回
+func (c *Config) validate() error {
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if c.Env != envDevelopment && c.Env != envProduction {
+		fail("env must be %s or %s", envDevelopment, envProduction)
+	}
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		fail("server.port must be between 1 and 65535")
+	}
+
+	switch c.Database.Driver {
+	case "mysql":
+		if c.Database.Host == "" {
+			fail("database.host (DB_HOST) is required for mysql, the default driver; set database.driver (DB_DRIVER) to sqlite to use a local file")
+		}
+	case "sqlite":
+		if c.Database.Path == "" {
+			fail("database.path (DB_PATH) is required for sqlite")
+		}
+	default:
+		fail("database.driver must be mysql or sqlite")
+	}
+
+	if c.Auth.JWTSecret == "" {
+		fail("auth.jwt_secret (JWT_SECRET) is required")
+	} else if c.Env == envProduction && c.Auth.JWTSecret == defaultJWTSecret {
+		fail("auth.jwt_secret (JWT_SECRET) must be changed from the default in production")
+	}
+	if c.Auth.TokenTTL <= 0 {
+		fail("auth.token_ttl must be positive")
+	}
+	if c.Auth.RefreshTokenTTL < c.Auth.TokenTTL {
+		fail("auth.refresh_token_ttl must not be shorter than auth.token_ttl")
+	}
+	if c.Auth.BcryptCost < bcrypt.MinCost || c.Auth.BcryptCost > bcrypt.MaxCost {
+		fail("auth.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	// 浏览器不接受 Access-Control-Allow-Origin: * 与凭据同时出现，cors 中间件此时会回显任意来源，等于对所有网站开放凭据
+	for _, origin := range c.CORS.AllowOrigins {
+		if origin == "*" && c.CORS.AllowCredentials {
+			fail("cors.allow_origins cannot contain * when cors.allow_credentials is enabled")
+		}
+	}
+
+	if c.Upload.MaxUploadMB <= 0 {
+		fail("upload.max_upload_mb must be positive")
+	}
+	if c.Upload.MaxMediaMB <= 0 {
+		fail("upload.max_media_mb must be positive")
+	}
+
+	switch c.Media.Storage {
+	case "local":
+		if c.Media.Dir == "" {
+			fail("media.dir (MEDIA_DIR) is required for local storage")
+		}
+	case "s3":
+		s3 := c.Media.S3
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "" {
+			fail("media.s3 endpoint, bucket, access_key and secret_key are required for s3 storage")
+		}
+	default:
+		fail("media.storage must be local or s3")
+	}
+
+	if c.Import.JobDir == "" {
+		fail("import.job_dir is required")
+	}
+	if c.Import.Workers <= 0 {
+		fail("import.workers must be positive")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
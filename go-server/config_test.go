@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 清空会影响配置的环境变量，测试结束后恢复；使用空的配置文件，不读取当前目录的 config.yaml
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{"APP_ENV", "PORT", "DB_DRIVER", "DB_PATH", "DB_HOST", "DB_USER", "DB_PASSWORD", "DB_NAME", "JWT_SECRET", "MAX_UPLOAD_MB"} {
+		t.Setenv(key, "")
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("env: development\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoadConfigDatabaseDriver(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		args       []string
+		wantDriver string
+		wantErr    string
+	}{
+		{"default is mysql", map[string]string{"DB_HOST": "db:3306"}, nil, "mysql", ""},
+		{"mysql without host", nil, nil, "", "DB_HOST"},
+		{"sqlite from env", map[string]string{"DB_DRIVER": "sqlite"}, nil, "sqlite", ""},
+		{"sqlite from flag", nil, []string{"-db-driver", "sqlite"}, "sqlite", ""},
+		{"host does not pick driver", map[string]string{"DB_DRIVER": "sqlite", "DB_HOST": "db:3306"}, nil, "sqlite", ""},
+		{"unknown driver", map[string]string{"DB_DRIVER": "postgres"}, nil, "", "database.driver"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			c, _, err := loadConfig(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Database.Driver != tt.wantDriver {
+				t.Errorf("driver = %s, want %s", c.Database.Driver, tt.wantDriver)
+			}
+		})
+	}
+}
+
+func TestLoadConfigLayering(t *testing.T) {
+	file := "server:\n  port: 4000\nupload:\n  max_upload_mb: 20\ndatabase:\n  driver: sqlite\n"
+	tests := []struct {
+		name       string
+		file       string
+		env        map[string]string
+		args       []string
+		wantPort   int
+		wantUpload int64
+		wantRest   []string
+		wantErr    string
+	}{
+		{"defaults", "", map[string]string{"DB_DRIVER": "sqlite"}, nil, 3005, 50, nil, ""},
+		{"file over defaults", file, nil, nil, 4000, 20, nil, ""},
+		{"env over file", file, map[string]string{"PORT": "5000"}, nil, 5000, 20, nil, ""},
+		{"flag over env", file, map[string]string{"PORT": "5000", "MAX_UPLOAD_MB": "30"}, []string{"-port", "6000"}, 6000, 30, nil, ""},
+		{"remaining args", file, nil, []string{"-max-upload-mb", "40", "migrate", "up"}, 4000, 40, []string{"migrate", "up"}, ""},
+		{"invalid env value", file, map[string]string{"PORT": "abc"}, nil, 0, 0, nil, "PORT must be an integer"},
+		{"invalid file", "server: [", nil, nil, 0, 0, nil, "invalid config file"},
+		{"missing config file", "", nil, []string{"-config", "missing.yaml"}, 0, 0, nil, "failed to read config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("CONFIG_FILE", path)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			c, rest, err := loadConfig(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Server.Port != tt.wantPort {
+				t.Errorf("port = %d, want %d", c.Server.Port, tt.wantPort)
+			}
+			if c.Upload.MaxUploadMB != tt.wantUpload {
+				t.Errorf("max upload = %d, want %d", c.Upload.MaxUploadMB, tt.wantUpload)
+			}
+			if strings.Join(rest, " ") != strings.Join(tt.wantRest, " ") {
+				t.Errorf("remaining args = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"unknown env", func(c *Config) { c.Env = "staging" }, []string{"env must be"}},
+		{"port out of range", func(c *Config) { c.Server.Port = 70000 }, []string{"server.port"}},
+		{"sqlite without path", func(c *Config) { c.Database.Driver, c.Database.Path = "sqlite", "" }, []string{"database.path"}},
+		{"default secret in production", func(c *Config) { c.Env = envProduction }, []string{"must be changed from the default"}},
+		{"custom secret in production", func(c *Config) { c.Env, c.Auth.JWTSecret = envProduction, "s3cret" }, nil},
+		{"refresh shorter than access", func(c *Config) { c.Auth.RefreshTokenTTL = c.Auth.TokenTTL / 2 }, []string{"auth.refresh_token_ttl"}},
+		{"bcrypt cost too high", func(c *Config) { c.Auth.BcryptCost = 40 }, []string{"auth.bcrypt_cost"}},
+		{"wildcard origin with credentials", func(c *Config) { c.CORS.AllowOrigins = []string{"*"} }, []string{"cors.allow_origins"}},
+		{"wildcard origin without credentials", func(c *Config) {
+			c.CORS.AllowOrigins, c.CORS.AllowCredentials = []string{"*"}, false
+		}, nil},
+		{"s3 without bucket", func(c *Config) { c.Media.Storage = "s3" }, []string{"media.s3"}},
+		{"several problems", func(c *Config) {
+			c.Upload.MaxUploadMB, c.Import.Workers = 0, 0
+		}, []string{"upload.max_upload_mb", "import.workers"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			c.Database.Host = "db:3306"
+			tt.modify(c)
+			err := c.validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate = nil, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate = %v, want containing %q", err, want)
+				}
+			}
+		})
+	}
+}
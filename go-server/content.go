@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// 题目内容格式
+const (
+	contentFormatPlain    = "plain"
+	contentFormatMarkdown = "markdown"
+)
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	// 原始 HTML 原样输出，统一由 contentPolicy 过滤；单个换行按换行显示，与纯文本一致
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe(), goldmarkhtml.WithHardWraps()),
+)
+
+// 去掉 script、事件属性和 javascript: 链接等，保留代码块的语言标记供客户端高亮
+var contentPolicy = func() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	return policy
+}()
+
+// 公式：$$...$$、\[...\]、\(...\)，以及首尾不是空白的 $...$（避免把 "$5 和 $10" 当作公式）
+var mathPattern = regexp.MustCompile(`(?s)\$\$.+?\$\$|\\\[.+?\\\]|\\\(.+?\\\)|\$[^\s$](?:[^$\n]*?[^\s$])?\$`)
+
+// 代码块和行内代码，其中的 $ 不是公式
+var codePattern = regexp.MustCompile("(?ms)^ {0,3}```.*?^ {0,3}```|^ {0,3}~~~.*?^ {0,3}~~~|``[^\n]+?``|`[^`\n]+`")
+
+// 公式的占位符，使用私用区字符，不会与正文冲突，也不会被 Markdown 解析
+const formulaPlaceholder = "\ue000%d\ue001"
+
+// 规范化内容格式，空值为 plain
+func normalizeContentFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "", contentFormatPlain:
+		return contentFormatPlain, nil
+	case contentFormatMarkdown, "md":
+		return contentFormatMarkdown, nil
+	}
+	return "", fmt.Errorf("不支持的内容格式: %s", format)
+}
+
+// 将题目内容渲染为安全的 HTML：plain 转义后换行转为 <br>，markdown 渲染后过滤。
+// 公式保持原样（含定界符）输出，由客户端的 KaTeX/MathJax 渲染
+func renderContent(format, text string) string {
+	if format != contentFormatMarkdown {
+		return textToHTML(text)
+	}
+
+	// 渲染前用占位符替换公式，避免 _、*、\ 等字符被当作 Markdown 语法
+	var formulas []string
+	source := replaceOutsideCode(text, func(formula string) string {
+		formulas = append(formulas, formula)
+		return fmt.Sprintf(formulaPlaceholder, len(formulas)-1)
+	})
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return textToHTML(text)
+	}
+	rendered := strings.TrimSpace(contentPolicy.Sanitize(buf.String()))
+
+	for i, formula := range formulas {
+		rendered = strings.ReplaceAll(rendered, fmt.Sprintf(formulaPlaceholder, i), html.EscapeString(formula))
+	}
+	return rendered
+}
+
+// 选项等短文本只有一个段落时去掉外层的 <p>
+func renderInlineContent(format, text string) string {
+	rendered := renderContent(format, text)
+	if strings.HasPrefix(rendered, "<p>") && strings.HasSuffix(rendered, "</p>") && strings.Count(rendered, "<p>") == 1 {
+		rendered = strings.TrimSuffix(strings.TrimPrefix(rendered, "<p>"), "</p>")
+	}
+	return rendered
+}
+
+// 对代码以外的部分替换公式
+func replaceOutsideCode(text string, replace func(formula string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, code := range codePattern.FindAllStringIndex(text, -1) {
+		b.WriteString(mathPattern.ReplaceAllStringFunc(text[last:code[0]], replace))
+		b.WriteString(text[code[0]:code[1]])
+		last = code[1]
+	}
+	b.WriteString(mathPattern.ReplaceAllStringFunc(text[last:], replace))
+	return b.String()
+}
+
+// 生成题干、选项和解析的 HTML，其中的媒体地址以题目所在的题库签名（见 signMediaURLs），
+// 调用者需要已确认可以访问 q.BankID
+func renderQuestion(q *Question) {
+	q.Rendered = &RenderedContent{
+		Question: signMediaURLs(q.BankID, renderContent(q.Format, q.Question)),
+		Options:  renderOptions(q.BankID, q.Format, q.Options),
+	}
+	if q.Explanation != "" {
+		q.Rendered.Explanation = signMediaURLs(q.BankID, renderContent(q.Format, q.Explanation))
+	}
+}
+
+func renderQuestions(questions []Question) {
+	for i := range questions {
+		renderQuestion(&questions[i])
+	}
+}
+
+func renderOptions(bankID, format string, options []string) []string {
+	rendered := make([]string, len(options))
+	for i, option := range options {
+		rendered[i] = signMediaURLs(bankID, renderInlineContent(format, option))
+	}
+	return rendered
+}
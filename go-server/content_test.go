@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 渲染结果中不能出现可执行的脚本：script 标签、事件属性和 javascript: 链接
+func TestRenderContentSanitizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		text    string
+		want    []string
+		wantNot []string
+	}{
+		{
+			name:    "script tag",
+			format:  contentFormatMarkdown,
+			text:    "题目<script>alert(1)</script>",
+			want:    []string{"题目"},
+			wantNot: []string{"<script", "alert(1)"},
+		},
+		{
+			name:    "event attribute",
+			format:  contentFormatMarkdown,
+			text:    `<img src="/x.png" onerror="alert(1)"> <b onclick="alert(2)">粗体</b>`,
+			want:    []string{`<img src="/x.png"`, "<b>粗体</b>"},
+			wantNot: []string{"onerror", "onclick", "alert"},
+		},
+		{
+			name:    "javascript link in markdown",
+			format:  contentFormatMarkdown,
+			text:    "[点击](javascript:alert(1))",
+			want:    []string{"点击"},
+			wantNot: []string{"javascript:"},
+		},
+		{
+			name:    "javascript link in html",
+			format:  contentFormatMarkdown,
+			text:    `<a href="javascript:alert(1)">点击</a>`,
+			want:    []string{"点击"},
+			wantNot: []string{"javascript:"},
+		},
+		{
+			name:    "code language class kept",
+			format:  contentFormatMarkdown,
+			text:    "```go\nfmt.Println(\"<script>\")\n```",
+			want:    []string{`<code class="language-go">`, "&lt;script&gt;"},
+			wantNot: []string{"<script>"},
+		},
+		{
+			name:    "other classes dropped",
+			format:  contentFormatMarkdown,
+			text:    `<span class="evil">文字</span>`,
+			want:    []string{"文字"},
+			wantNot: []string{"evil"},
+		},
+		{
+			name:    "plain text is escaped",
+			format:  contentFormatPlain,
+			text:    "<script>alert(1)</script>\n第二行",
+			want:    []string{"&lt;script&gt;", "<br>"},
+			wantNot: []string{"<script>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderContent(tt.format, tt.text)
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("renderContent(%q) = %q, want containing %q", tt.text, got, s)
+				}
+			}
+			for _, s := range tt.wantNot {
+				if strings.Contains(got, s) {
+					t.Errorf("renderContent(%q) = %q, must not contain %q", tt.text, got, s)
+				}
+			}
+		})
+	}
+}
+
+// 代码中的 $ 不是公式，代码以外的公式替换为占位符
+func TestReplaceOutsideCode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"inline formula", "求 $x^2$ 的值", "求 [$x^2$] 的值"},
+		{"display formulas", "$$a_1$$ 与 \\(b\\) 与 \\[c\\]", "[$$a_1$$] 与 [\\(b\\)] 与 [\\[c\\]]"},
+		{"prices are not formulas", "$5 和 $10", "$5 和 $10"},
+		{"inline code", "变量 `$HOME` 与 $y$", "变量 `$HOME` 与 [$y$]"},
+		{"double backtick code", "``echo $a$`` 后 $b$", "``echo $a$`` 后 [$b$]"},
+		{"fenced code", "前 $a$\n```sh\necho $x$\n```\n后 $b$", "前 [$a$]\n```sh\necho $x$\n```\n后 [$b$]"},
+		{"tilde fence", "~~~\n$x$\n~~~", "~~~\n$x$\n~~~"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := replaceOutsideCode(tt.text, func(formula string) string { return "[" + formula + "]" })
+			if got != tt.want {
+				t.Errorf("replaceOutsideCode(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// 公式原样输出，不被 Markdown 解析；代码中的 $ 保持为代码
+func TestRenderContentFormulas(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"formula keeps markdown characters", "$a_1 * b_2$", "<p>$a_1 * b_2$</p>"},
+		{"formula is escaped", "$a<b$", "<p>$a&lt;b$</p>"},
+		{"dollar in inline code", "`$x$` 和 $y_1$", "<p><code>$x$</code> 和 $y_1$</p>"},
+		{"dollar in fenced code", "```\n$x_1$\n```", "<pre><code>$x_1$\n</code></pre>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderContent(contentFormatMarkdown, tt.text)
+			if got != tt.want {
+				t.Errorf("renderContent(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if strings.ContainsAny(got, "\ue000\ue001") {
+				t.Errorf("placeholder left in %q", got)
+			}
+		})
+	}
+}
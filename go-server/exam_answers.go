@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 客户端随考试结果一起提交的单题作答
+type submittedAnswer struct {
+	QuestionID string      `json:"questionId" binding:"required"`
+	Answer     AnswerValue `json:"answer"`
+	TimeSpent  int         `json:"timeSpent"`
+}
+
+// 根据题库中的正确答案为提交的作答判分。题目必须属于结果所在的题库 bankID 且该题库属于当前用户；
+// 错题练习（wrongQuestionsBankID）的题目可以来自当前用户的任意题库
+func gradeSubmittedAnswers(userID, bankID string, answers []submittedAnswer, scoringMode string) ([]ExamAnswer, error) {
+	if len(answers) == 0 {
+		return nil, nil
+	}
+
+	clause := "JOIN question_banks qb ON q.bank_id = qb.id WHERE qb.user_id = ?"
+	args := []interface{}{userID}
+	if bankID != wrongQuestionsBankID {
+		clause += " AND q.bank_id = ?"
+		args = append(args, bankID)
+	}
+	placeholders := make([]string, len(answers))
+	for i, a := range answers {
+		placeholders[i] = "?"
+		args = append(args, a.QuestionID)
+	}
+
+	questions, err := queryQuestions(clause+" AND q.id IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+
+	graded := make([]ExamAnswer, 0, len(answers))
+	seen := make(map[string]bool, len(answers))
+	for i, a := range answers {
+		q, ok := byID[a.QuestionID]
+		if !ok {
+			return nil, fmt.Errorf("题目 %s 不存在、不属于该题库或无权访问", a.QuestionID)
+		}
+		if seen[a.QuestionID] {
+			return nil, fmt.Errorf("题目 %s 重复作答", a.QuestionID)
+		}
+		seen[a.QuestionID] = true
+
+		// 未作答时 answer 为 null
+		chosen := a.Answer
+		if !chosen.IsEmpty() {
+			if chosen, err = validateAnswer(q, chosen); err != nil {
+				return nil, fmt.Errorf("题目 %s %v", a.QuestionID, err)
+			}
+		}
+
+		credit := gradeAnswer(q, chosen, scoringMode)
+		graded = append(graded, ExamAnswer{
+			QuestionID: q.ID,
+			Position:   i,
+			Chosen:     chosen,
+			Correct:    credit == 1,
+			Credit:     credit,
+			TimeSpent:  a.TimeSpent,
+		})
+	}
+
+	return graded, nil
+}
+
+// 写入考试作答明细
+func writeExamAnswers(tx *sql.Tx, resultID string, answers []ExamAnswer) error {
+	for _, a := range answers {
+		var chosen interface{}
+		if !a.Chosen.IsEmpty() {
+			chosenJSON, err := json.Marshal(a.Chosen)
+			if err != nil {
+				return err
+			}
+			chosen = string(chosenJSON)
+		}
+
+		_, err := tx.Exec(`INSERT INTO exam_answers
+			(result_id, question_id, position, chosen, correct, credit, time_spent)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			resultID, a.QuestionID, a.Position, chosen, a.Correct, a.Credit, a.TimeSpent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 考试复盘：考生本人、题库所有者或管理员可以查看每道题的作答情况
+func getExamResultReview(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	result, err := loadExamResult(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam result not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if result.UserID != userID {
+		var allowed bool
+		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM question_banks WHERE id = ? AND user_id = ?)
+			OR EXISTS(SELECT 1 FROM users WHERE id = ? AND is_admin = 1)`, result.BankID, userID, userID).Scan(&allowed)
+		if err != nil || !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exam result not found"})
+			return
+		}
+	}
+
+	answers, err := loadExamAnswers(result)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result":  result,
+		"answers": answers,
+	})
+}
+
+// 按作答顺序加载作答明细，并附带题目内容与正确答案
+func loadExamAnswers(result *ExamResult) ([]ExamAnswer, error) {
+	resultID := result.ID
+	rows, err := db.Query(`SELECT question_id, position, chosen, correct, credit, time_spent
+		FROM exam_answers WHERE result_id = ? ORDER BY position`, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	answers := []ExamAnswer{}
+	for rows.Next() {
+		var a ExamAnswer
+		var chosenJSON sql.NullString
+		if err := rows.Scan(&a.QuestionID, &a.Position, &chosenJSON, &a.Correct, &a.Credit, &a.TimeSpent); err != nil {
+			return nil, err
+		}
+
+		a.ResultID = resultID
+		if chosenJSON.Valid {
+			if err := json.Unmarshal([]byte(chosenJSON.String), &a.Chosen); err != nil {
+				return nil, fmt.Errorf("Failed to parse chosen answer: %v", err)
+			}
+		}
+		answers = append(answers, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 只补全结果所在题库中的题目（错题练习为考生自己题库中的题目），其他题目按已删除处理
+	clause, args := "WHERE q.bank_id = ?", []interface{}{result.BankID}
+	if result.BankID == wrongQuestionsBankID {
+		clause, args = "JOIN question_banks qb ON q.bank_id = qb.id WHERE qb.user_id = ?", []interface{}{result.UserID}
+	}
+	questions, err := queryQuestions(clause+" AND q.id IN (SELECT question_id FROM exam_answers WHERE result_id = ?)", append(args, resultID)...)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+
+	// 题目已被删除时只保留作答信息
+	for i := range answers {
+		q, ok := byID[answers[i].QuestionID]
+		if !ok {
+			continue
+		}
+		answers[i].Type = q.Type
+		answers[i].Question = q.Question
+		answers[i].Options = q.Options
+		answers[i].Blanks = q.Blanks
+		answers[i].AcceptedAnswers = q.AcceptedAnswers
+		answers[i].Explanation = q.Explanation
+		answers[i].Format = q.Format
+		renderQuestion(&q)
+		answers[i].Rendered = q.Rendered
+		if isChoiceType(q.Type) {
+			answers[i].Answer = correctAnswers(q)
+		}
+	}
+
+	return answers, nil
+}
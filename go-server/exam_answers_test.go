@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 考试复盘的访问权限：考生本人、题库所有者和管理员可以查看，其他用户返回 404
+func TestExamResultReviewAccess(t *testing.T) {
+	r := setupTestServer(t)
+	ownerToken, _ := registerTestUser(t, r, "alice")
+	takerToken, _ := registerTestUser(t, r, "bob")
+	strangerToken, _ := registerTestUser(t, r, "carol")
+	adminToken, adminID := registerTestUser(t, r, "dave")
+	if _, err := db.Exec("UPDATE users SET is_admin = 1 WHERE id = ?", adminID); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob 在 alice 的题库上保存了一次只有分数的结果
+	bankID := createTestBank(t, r, ownerToken, sampleQuestions())
+	w := doJSON(r, "POST", "/api/exam-results", takerToken, gin.H{"bankId": bankID, "score": 50, "totalQuestions": 2})
+	if w.Code != http.StatusOK {
+		t.Fatalf("save result: %d %s", w.Code, w.Body.String())
+	}
+	var saved struct {
+		ID string `json:"id"`
+	}
+	decodeBody(t, w, &saved)
+
+	tests := []struct {
+		name   string
+		token  string
+		id     string
+		status int
+	}{
+		{"taker", takerToken, saved.ID, http.StatusOK},
+		{"bank owner", ownerToken, saved.ID, http.StatusOK},
+		{"admin", adminToken, saved.ID, http.StatusOK},
+		{"other user", strangerToken, saved.ID, http.StatusNotFound},
+		{"unknown result", takerToken, "missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doJSON(r, "GET", "/api/exam-results/"+tt.id+"/review", tt.token, nil)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+// 复盘按作答顺序返回每道题的作答、判分、题目内容和正确答案
+func TestExamResultReviewAnswers(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	otherToken, _ := registerTestUser(t, r, "bob")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+	foreignBankID := createTestBank(t, r, otherToken, []Question{{
+		Type: questionTypeSingle, Question: "secret", Options: []string{"a", "b"}, Answer: 1,
+	}})
+
+	result := submitTestSession(t, r, token, bankID, []int{0, 1, 0})
+
+	// 早期保存的作答明细可能引用了其他题库的题目，复盘时不能带出其内容
+	var foreign []ExamQuestion
+	decodeBody(t, doJSON(r, "GET", "/api/question-banks/"+foreignBankID+"/questions", otherToken, nil), &foreign)
+	if _, err := db.Exec("INSERT INTO exam_answers (result_id, question_id, position, chosen, correct, credit, time_spent) VALUES (?, ?, 3, '[1]', 1, 1, 0)",
+		result.ID, foreign[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doJSON(r, "GET", "/api/exam-results/"+result.ID+"/review", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("review: %d %s", w.Code, w.Body.String())
+	}
+	var review struct {
+		Result  ExamResult   `json:"result"`
+		Answers []ExamAnswer `json:"answers"`
+	}
+	decodeBody(t, w, &review)
+	if review.Result.ID != result.ID || review.Result.Score != 67 {
+		t.Errorf("result = %+v", review.Result)
+	}
+
+	samples := sampleQuestions()
+	tests := []struct {
+		name     string
+		question string
+		chosen   []int
+		correct  bool
+		answer   []int
+	}{
+		{"correct", samples[0].Question, []int{0}, true, []int{0}},
+		{"wrong", samples[1].Question, []int{1}, false, []int{0}},
+		{"correct again", samples[2].Question, []int{0}, true, []int{0}},
+		{"question from other bank", "", []int{1}, true, nil},
+	}
+	if len(review.Answers) != len(tests) {
+		t.Fatalf("got %d answers, want %d: %+v", len(review.Answers), len(tests), review.Answers)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := review.Answers[i]
+			if a.Position != i || a.Question != tt.question || a.Correct != tt.correct {
+				t.Errorf("answer %d = %+v", i, a)
+			}
+			if !equalInts(a.Chosen.Choices, tt.chosen) || !equalInts(a.Answer, tt.answer) {
+				t.Errorf("chosen %v answer %v, want %v %v", a.Chosen.Choices, a.Answer, tt.chosen, tt.answer)
+			}
+			if (a.Rendered != nil) != (tt.question != "") {
+				t.Errorf("rendered = %+v", a.Rendered)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
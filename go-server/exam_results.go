@@ -1,7 +1,12 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,6 +22,9 @@ func saveExamResult(c *gin.Context) {
 		WrongCount     int    `json:"wrongCount"`
 		TotalQuestions int    `json:"totalQuestions"`
 		TotalTime      int    `json:"totalTime"`
+		// 可选的逐题作答，提供时由服务端判分并记录作答明细
+		Answers     []submittedAnswer `json:"answers" binding:"dive"`
+		ScoringMode string            `json:"scoringMode"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -30,7 +38,7 @@ func saveExamResult(c *gin.Context) {
 
 	if req.BankID == "wrong-questions-all" || req.BankID == "wrong-questions" {
 		// 错题练习使用特殊标识，跳过题库验证
-		req.BankID = "wrong-questions-practice"
+		req.BankID = wrongQuestionsBankID
 		bankExists = true
 	} else {
 		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM question_banks WHERE id = ?)", req.BankID).Scan(&bankExists)
@@ -45,8 +53,44 @@ func saveExamResult(c *gin.Context) {
 		}
 	}
 
+	if req.ScoringMode == "" {
+		req.ScoringMode = scoringAllOrNothing
+	}
+	if !validScoringMode(req.ScoringMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scoringMode 只能为 all_or_nothing 或 partial"})
+		return
+	}
+
+	answers, err := gradeSubmittedAnswers(userID, req.BankID, req.Answers, req.ScoringMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 有逐题作答时以服务端判分结果为准
+	if len(answers) > 0 {
+		credits := 0.0
+		req.CorrectCount = 0
+		for _, a := range answers {
+			credits += a.Credit
+			if a.Correct {
+				req.CorrectCount++
+			}
+		}
+		req.TotalQuestions = len(answers)
+		req.WrongCount = req.TotalQuestions - req.CorrectCount
+		req.Score = percentScore(credits, req.TotalQuestions)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
 	resultID := generateUUID()
-	_, err = db.Exec(`INSERT INTO exam_results 
+	_, err = tx.Exec(`INSERT INTO exam_results 
 		(id, user_id, bank_id, score, correct_count, wrong_count, total_questions, total_time) 
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		resultID, userID, req.BankID, req.Score, req.CorrectCount, req.WrongCount, req.TotalQuestions, req.TotalTime)
@@ -55,6 +99,16 @@ func saveExamResult(c *gin.Context) {
 		return
 	}
 
+	if err := writeExamAnswers(tx, resultID, answers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exam answers"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"id":      resultID,
 		"message": "Exam result saved successfully",
@@ -64,8 +118,9 @@ func saveExamResult(c *gin.Context) {
 func getExamStats(c *gin.Context) {
 	userID := c.GetString("userID")
 
-	var stats ExamStats
-	err := db.QueryRow(`
+	// 默认只统计来自考试会话的结果：题目由服务端抽取并判分。直接保存的结果即使附带逐题作答，
+	// 作答哪些题目仍由客户端决定，无法核实，verified=false 时才一并统计
+	query := `
 		SELECT 
 			COUNT(*) as total_exams,
 			COALESCE(AVG(score), 0) as avg_score,
@@ -73,7 +128,13 @@ func getExamStats(c *gin.Context) {
 			COALESCE(SUM(total_questions), 0) as total_questions_answered
 		FROM exam_results
 		WHERE user_id = ?
-	`, userID).Scan(&stats.TotalExams, &stats.AvgScore, &stats.BestScore, &stats.TotalQuestionsAnswered)
+	`
+	if c.Query("verified") != "false" {
+		query += " AND " + verifiedResultCondition
+	}
+
+	var stats ExamStats
+	err := db.QueryRow(query, userID).Scan(&stats.TotalExams, &stats.AvgScore, &stats.BestScore, &stats.TotalQuestionsAnswered)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -81,3 +142,275 @@ func getExamStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// 考试历史列表，支持按题库、时间范围、分数范围筛选并分页
+func getExamResults(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	where := []string{"er.user_id = ?"}
+	args := []interface{}{userID}
+
+	if bankID := c.Query("bankId"); bankID != "" {
+		where = append(where, "er.bank_id = ?")
+		args = append(args, bankID)
+	}
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseDateParam(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 参数格式错误，应为 YYYY-MM-DD 或 RFC3339"})
+			return
+		}
+		where = append(where, "er.created_at >= ?")
+		args = append(args, backend.timeValue(t))
+	}
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseDateParam(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 参数格式错误，应为 YYYY-MM-DD 或 RFC3339"})
+			return
+		}
+		// 只给出日期时包含当天
+		if dateOnly {
+			where = append(where, "er.created_at < ?")
+			args = append(args, backend.timeValue(t.AddDate(0, 0, 1)))
+		} else {
+			where = append(where, "er.created_at <= ?")
+			args = append(args, backend.timeValue(t))
+		}
+	}
+	if minScore := c.Query("minScore"); minScore != "" {
+		score, err := strconv.Atoi(minScore)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minScore 参数必须为整数"})
+			return
+		}
+		where = append(where, "er.score >= ?")
+		args = append(args, score)
+	}
+	if maxScore := c.Query("maxScore"); maxScore != "" {
+		score, err := strconv.Atoi(maxScore)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "maxScore 参数必须为整数"})
+			return
+		}
+		where = append(where, "er.score <= ?")
+		args = append(args, score)
+	}
+
+	whereClause := " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM exam_results er"+whereClause, args...).Scan(&total)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(examResultSelect+whereClause+" ORDER BY er.created_at DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	results := []ExamResult{}
+	for rows.Next() {
+		result, err := scanExamResult(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":     results,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 获取单次考试结果详情
+func getExamResult(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	result, err := loadExamResult(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && result.UserID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam result not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// 删除考试结果，作答明细随外键级联删除
+func deleteExamResult(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	result, err := db.Exec("DELETE FROM exam_results WHERE id = ? AND user_id = ?", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exam result deleted successfully"})
+}
+
+// 对比同一题库的两次考试：总体差值以及逐题的进步/退步情况
+func compareExamResults(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	baseID, targetID := c.Query("base"), c.Query("target")
+	if baseID == "" || targetID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base 和 target 参数不能为空"})
+		return
+	}
+
+	var results [2]ExamResult
+	for i, id := range []string{baseID, targetID} {
+		result, err := loadExamResult(id)
+		if err == sql.ErrNoRows || (err == nil && result.UserID != userID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Exam result %s not found", id)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		results[i] = *result
+	}
+	base, target := results[0], results[1]
+
+	if base.BankID != target.BankID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能对比同一题库的考试结果"})
+		return
+	}
+
+	baseAnswers, err := loadExamAnswers(&base)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	targetAnswers, err := loadExamAnswers(&target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	type questionDiff struct {
+		QuestionID    string `json:"question_id"`
+		Question      string `json:"question"`
+		BaseCorrect   *bool  `json:"base_correct"`
+		TargetCorrect *bool  `json:"target_correct"`
+		Change        string `json:"change"`
+	}
+
+	diffs := []questionDiff{}
+	index := make(map[string]int)
+	for _, a := range baseAnswers {
+		correct := a.Correct
+		index[a.QuestionID] = len(diffs)
+		diffs = append(diffs, questionDiff{QuestionID: a.QuestionID, Question: a.Question, BaseCorrect: &correct})
+	}
+	for _, a := range targetAnswers {
+		correct := a.Correct
+		if i, ok := index[a.QuestionID]; ok {
+			diffs[i].TargetCorrect = &correct
+			continue
+		}
+		diffs = append(diffs, questionDiff{QuestionID: a.QuestionID, Question: a.Question, TargetCorrect: &correct})
+	}
+
+	// improved: 错→对，regressed: 对→错，added/removed: 只在其中一次考试中出现
+	summary := map[string]int{"improved": 0, "regressed": 0, "unchanged": 0, "added": 0, "removed": 0}
+	for i := range diffs {
+		d := &diffs[i]
+		switch {
+		case d.BaseCorrect == nil:
+			d.Change = "added"
+		case d.TargetCorrect == nil:
+			d.Change = "removed"
+		case !*d.BaseCorrect && *d.TargetCorrect:
+			d.Change = "improved"
+		case *d.BaseCorrect && !*d.TargetCorrect:
+			d.Change = "regressed"
+		default:
+			d.Change = "unchanged"
+		}
+		summary[d.Change]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"base":         base,
+		"target":       target,
+		"score_diff":   target.Score - base.Score,
+		"correct_diff": target.CorrectCount - base.CorrectCount,
+		"time_diff":    target.TotalTime - base.TotalTime,
+		"questions":    diffs,
+		"summary":      summary,
+	})
+}
+
+// 来自考试会话的考试结果，题目和判分都由服务端决定
+const verifiedResultCondition = "session_id IS NOT NULL"
+
+// 错题练习的考试结果使用的题库 ID
+const wrongQuestionsBankID = "wrong-questions-practice"
+
+const examResultSelect = `SELECT er.id, er.user_id, er.bank_id, er.score, er.correct_count, er.wrong_count,
+		er.total_questions, er.total_time, er.session_id, er.created_at, qb.name
+	FROM exam_results er
+	LEFT JOIN question_banks qb ON er.bank_id = qb.id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// 按 examResultSelect 的字段顺序扫描考试结果
+func scanExamResult(row rowScanner) (ExamResult, error) {
+	var result ExamResult
+	var sessionID, bankName sql.NullString
+	err := row.Scan(&result.ID, &result.UserID, &result.BankID, &result.Score, &result.CorrectCount, &result.WrongCount,
+		&result.TotalQuestions, &result.TotalTime, &sessionID, &result.CreatedAt, &bankName)
+	result.SessionID = sessionID.String
+	result.BankName = bankName.String
+	return result, err
+}
+
+func loadExamResult(resultID string) (*ExamResult, error) {
+	result, err := scanExamResult(db.QueryRow(examResultSelect+" WHERE er.id = ?", resultID))
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// 解析日期参数，支持 YYYY-MM-DD 与 RFC3339，返回值表示是否只包含日期
+func parseDateParam(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
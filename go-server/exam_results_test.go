@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExamStatsCountsOnlyVerifiedResults(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+
+	// 只提交分数的结果无法核实
+	w := doJSON(r, "POST", "/api/exam-results", token, gin.H{
+		"bankId": bankID, "score": 100, "correctCount": 3, "totalQuestions": 3,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("save unverified result: %d %s", w.Code, w.Body.String())
+	}
+
+	// 附带逐题作答的结果由服务端判分（一题答对），但作答哪些题目由客户端决定，同样无法核实
+	var bank QuestionBank
+	decodeBody(t, doJSON(r, "GET", "/api/question-banks/"+bankID+"/questions", token, nil), &bank.Questions)
+	answers := []gin.H{
+		{"questionId": bank.Questions[0].ID, "answer": 0},
+		{"questionId": bank.Questions[1].ID, "answer": 1},
+		{"questionId": bank.Questions[2].ID, "answer": 1},
+	}
+	w = doJSON(r, "POST", "/api/exam-results", token, gin.H{"bankId": bankID, "score": 100, "answers": answers})
+	if w.Code != http.StatusOK {
+		t.Fatalf("save graded result: %d %s", w.Code, w.Body.String())
+	}
+
+	// 来自考试会话的结果：全部答对
+	sessionID, questions := startTestSession(t, r, token, bankID, viewModeExam)
+	sessionAnswers := make([]gin.H, len(questions))
+	for i, q := range questions {
+		sessionAnswers[i] = gin.H{"questionId": q.ID, "answer": 0}
+	}
+	if w := doJSON(r, "POST", "/api/exam-sessions/"+sessionID+"/submit", token, gin.H{"answers": sessionAnswers}); w.Code != http.StatusOK {
+		t.Fatalf("submit: %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		query      string
+		totalExams int
+		bestScore  int
+	}{
+		{"", 1, 100},
+		{"?verified=true", 1, 100},
+		{"?verified=false", 3, 100},
+	}
+	for _, tt := range tests {
+		var stats ExamStats
+		decodeBody(t, doJSON(r, "GET", "/api/exam-results/stats"+tt.query, token, nil), &stats)
+		if stats.TotalExams != tt.totalExams || stats.BestScore != tt.bestScore {
+			t.Errorf("stats%s = %+v, want %d exams, best %d", tt.query, stats, tt.totalExams, tt.bestScore)
+		}
+	}
+
+	var stats ExamStats
+	decodeBody(t, doJSON(r, "GET", "/api/exam-results/stats", token, nil), &stats)
+	if stats.AvgScore != 100 {
+		t.Errorf("avg score = %v, want 100 (only the session result counts)", stats.AvgScore)
+	}
+}
+
+// 随结果提交的作答只能引用该题库中的题目
+func TestSaveExamResultAnswersMustBelongToBank(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	otherToken, _ := registerTestUser(t, r, "bob")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+	ownOtherBankID := createTestBank(t, r, token, sampleQuestions())
+	foreignBankID := createTestBank(t, r, otherToken, sampleQuestions())
+
+	questionID := func(token, bankID string) string {
+		var questions []ExamQuestion
+		decodeBody(t, doJSON(r, "GET", "/api/question-banks/"+bankID+"/questions", token, nil), &questions)
+		return questions[0].ID
+	}
+
+	tests := []struct {
+		name       string
+		questionID string
+		wantStatus int
+	}{
+		{"same bank", questionID(token, bankID), http.StatusOK},
+		{"own other bank", questionID(token, ownOtherBankID), http.StatusBadRequest},
+		{"other user's bank", questionID(otherToken, foreignBankID), http.StatusBadRequest},
+		{"unknown question", "missing", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doJSON(r, "POST", "/api/exam-results", token, gin.H{
+				"bankId": bankID, "answers": []gin.H{{"questionId": tt.questionID, "answer": 0}},
+			})
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+// 只能查看、删除和对比自己的考试结果，其他用户的结果返回 404
+func TestExamResultOwnership(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	otherToken, _ := registerTestUser(t, r, "bob")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+	otherBankID := createTestBank(t, r, otherToken, sampleQuestions())
+
+	own := submitTestSession(t, r, token, bankID, []int{0, 0, 0}).ID
+	ownAgain := submitTestSession(t, r, token, bankID, []int{1, 0, 0}).ID
+	other := submitTestSession(t, r, otherToken, otherBankID, []int{0, 0, 0}).ID
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"detail of own result", "GET", "/api/exam-results/" + own, http.StatusOK},
+		{"detail of other user's result", "GET", "/api/exam-results/" + other, http.StatusNotFound},
+		{"compare own results", "GET", "/api/exam-results/compare?base=" + own + "&target=" + ownAgain, http.StatusOK},
+		{"compare with other user's base", "GET", "/api/exam-results/compare?base=" + other + "&target=" + own, http.StatusNotFound},
+		{"compare with other user's target", "GET", "/api/exam-results/compare?base=" + own + "&target=" + other, http.StatusNotFound},
+		{"delete other user's result", "DELETE", "/api/exam-results/" + other, http.StatusNotFound},
+		{"delete own result", "DELETE", "/api/exam-results/" + ownAgain, http.StatusOK},
+		{"deleted result is gone", "GET", "/api/exam-results/" + ownAgain, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doJSON(r, tt.method, tt.path, token, nil)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	// 删除失败的结果仍然存在
+	if w := doJSON(r, "GET", "/api/exam-results/"+other, otherToken, nil); w.Code != http.StatusOK {
+		t.Errorf("other user's result after delete attempt: status %d", w.Code)
+	}
+}
+
+// 分页参数：page 小于 1 按 1 处理，pageSize 不在 1~100 之间时使用默认值 20，只列出自己的结果
+func TestExamResultsPagination(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	otherToken, _ := registerTestUser(t, r, "bob")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+
+	for i := 0; i < 5; i++ {
+		if w := doJSON(r, "POST", "/api/exam-results", token, gin.H{"bankId": bankID, "score": i * 10, "totalQuestions": 3}); w.Code != http.StatusOK {
+			t.Fatalf("save result: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if w := doJSON(r, "POST", "/api/exam-results", otherToken, gin.H{"bankId": bankID, "score": 90, "totalQuestions": 3}); w.Code != http.StatusOK {
+		t.Fatalf("save other result: %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		query        string
+		wantPage     int
+		wantPageSize int
+		wantItems    int
+	}{
+		{"", 1, 20, 5},
+		{"?page=1&pageSize=2", 1, 2, 2},
+		{"?page=3&pageSize=2", 3, 2, 1},
+		{"?page=4&pageSize=2", 4, 2, 0},
+		{"?page=0&pageSize=2", 1, 2, 2},
+		{"?page=-1", 1, 20, 5},
+		{"?page=abc", 1, 20, 5},
+		{"?pageSize=0", 1, 20, 5},
+		{"?pageSize=100", 1, 100, 5},
+		{"?pageSize=101", 1, 20, 5},
+		{"?pageSize=-5", 1, 20, 5},
+	}
+	for _, tt := range tests {
+		t.Run("list"+tt.query, func(t *testing.T) {
+			w := doJSON(r, "GET", "/api/exam-results"+tt.query, token, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Items    []ExamResult `json:"items"`
+				Total    int          `json:"total"`
+				Page     int          `json:"page"`
+				PageSize int          `json:"page_size"`
+			}
+			decodeBody(t, w, &resp)
+			if resp.Total != 5 || resp.Page != tt.wantPage || resp.PageSize != tt.wantPageSize || len(resp.Items) != tt.wantItems {
+				t.Errorf("total %d page %d pageSize %d items %d, want 5 %d %d %d",
+					resp.Total, resp.Page, resp.PageSize, len(resp.Items), tt.wantPage, tt.wantPageSize, tt.wantItems)
+			}
+		})
+	}
+}
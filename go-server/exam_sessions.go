@@ -0,0 +1,635 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 考试会话状态
+const (
+	examSessionInProgress = "in_progress"
+	examSessionSubmitted  = "submitted"
+)
+
+// 题目查看模式：exam 交卷后才揭晓答案，practice 每题作答后即可揭晓答案
+const (
+	viewModeExam     = "exam"
+	viewModePractice = "practice"
+)
+
+// 考试时间限制的上限（分钟）
+const maxExamTimeLimit = 24 * 60
+
+// 到达截止时间后仍接受作答的宽限时间，抵消网络延迟
+const examDeadlineGrace = 30 * time.Second
+
+// 题库所有者编辑题目时使用的查看模式，返回答案和解析
+const viewModeManage = "manage"
+
+// exam 和 practice 模式下题目不携带答案和解析
+func hidesAnswerKey(mode string) bool {
+	return mode == viewModeExam || mode == viewModePractice
+}
+
+// 练习模式下作答后即可查看答案，已作答的题目不能再修改答案
+var errAnswerRevealed = errors.New("练习模式下已作答的题目可以查看答案，不能再修改")
+
+type sessionAnswer struct {
+	QuestionID string      `json:"questionId" binding:"required"`
+	Answer     AnswerValue `json:"answer"`
+	TimeSpent  int         `json:"timeSpent"`
+}
+
+// 开始考试：从题库抽题并创建会话，返回不含答案的题目
+func startExamSession(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req struct {
+		BankID        string   `json:"bankId" binding:"required"`
+		QuestionCount int      `json:"questionCount"`
+		Shuffle       bool     `json:"shuffle"`
+		Mode          string   `json:"mode"`
+		ScoringMode   string   `json:"scoringMode"`
+		Chapters      []string `json:"chapters"`  // 只从这些章节中出题
+		TimeLimit     *int     `json:"timeLimit"` // 分钟，0 不限时；未提供时使用系统设置的默认值
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = viewModeExam
+	}
+	if !hidesAnswerKey(req.Mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode 只能为 exam 或 practice"})
+		return
+	}
+	if req.ScoringMode == "" {
+		req.ScoringMode = scoringAllOrNothing
+	}
+	if !validScoringMode(req.ScoringMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scoringMode 只能为 all_or_nothing 或 partial"})
+		return
+	}
+
+	timeLimit := currentSettings().DefaultTimeLimit
+	if req.TimeLimit != nil {
+		timeLimit = *req.TimeLimit
+	}
+	if timeLimit < 0 || timeLimit > maxExamTimeLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeLimit 应在 0~%d 分钟之间", maxExamTimeLimit)})
+		return
+	}
+
+	// 检查题库是否属于当前用户
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM question_banks WHERE id = ? AND user_id = ?)", req.BankID, userID).Scan(&exists)
+	if err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "题库不存在或无权访问"})
+		return
+	}
+
+	chapterFilter, chapterArgs := chapterClause(req.Chapters)
+	questions, err := queryQuestions("WHERE q.bank_id = ?"+chapterFilter, append([]interface{}{req.BankID}, chapterArgs...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(questions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "题库（或所选章节）中没有题目"})
+		return
+	}
+
+	if req.Shuffle {
+		rand.Shuffle(len(questions), func(i, j int) {
+			questions[i], questions[j] = questions[j], questions[i]
+		})
+	}
+	if req.QuestionCount > 0 && req.QuestionCount < len(questions) {
+		questions = questions[:req.QuestionCount]
+	}
+
+	questionIDs := make([]string, len(questions))
+	examQuestions := make([]ExamQuestion, len(questions))
+	for i, q := range questions {
+		questionIDs[i] = q.ID
+		examQuestions[i] = toExamQuestion(q)
+	}
+
+	questionIDsJSON, err := json.Marshal(questionIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal question ids"})
+		return
+	}
+
+	sessionID := generateUUID()
+	_, err = db.Exec("INSERT INTO exam_sessions (id, user_id, bank_id, status, mode, scoring_mode, time_limit, question_ids) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		sessionID, userID, req.BankID, examSessionInProgress, req.Mode, req.ScoringMode, timeLimit, string(questionIDsJSON))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create exam session"})
+		return
+	}
+
+	session := ExamSession{
+		ID:          sessionID,
+		UserID:      userID,
+		BankID:      req.BankID,
+		Status:      examSessionInProgress,
+		Mode:        req.Mode,
+		ScoringMode: req.ScoringMode,
+		TimeLimit:   timeLimit,
+		QuestionIDs: questionIDs,
+		StartedAt:   time.Now(),
+		Questions:   examQuestions,
+		Answers:     map[string]AnswerValue{},
+	}
+	session.setDeadline()
+	c.JSON(http.StatusOK, session)
+}
+
+// 获取考试会话（题目不含答案，附带已作答记录）
+func getExamSession(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	session, err := loadExamSession(c.Param("id"), userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	questions, err := loadSessionQuestions(session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	session.Questions = toExamQuestions(questions)
+
+	c.JSON(http.StatusOK, session)
+}
+
+// 提交单题答案
+func answerExamQuestion(c *gin.Context) {
+	var req struct {
+		Answer    AnswerValue `json:"answer"`
+		TimeSpent int         `json:"timeSpent"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveSessionAnswers(c, []sessionAnswer{{QuestionID: c.Param("questionId"), Answer: req.Answer, TimeSpent: req.TimeSpent}})
+}
+
+// 批量提交答案
+func answerExamQuestions(c *gin.Context) {
+	var req struct {
+		Answers []sessionAnswer `json:"answers" binding:"required,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveSessionAnswers(c, req.Answers)
+}
+
+func saveSessionAnswers(c *gin.Context, answers []sessionAnswer) {
+	userID := c.GetString("userID")
+
+	session, err := loadExamSession(c.Param("id"), userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if session.Status != examSessionInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Exam session already submitted"})
+		return
+	}
+	if session.timeUp() {
+		c.JSON(http.StatusConflict, gin.H{"error": "考试时间已到，请交卷", "deadline": session.Deadline})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := writeSessionAnswers(tx, session, answers); err != nil {
+		c.JSON(answerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Answers saved successfully",
+		"answeredCount": len(session.Answers),
+	})
+}
+
+// 交卷：服务端判分并写入考试结果
+func submitExamSession(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req struct {
+		Answers []sessionAnswer `json:"answers" binding:"dive"`
+	}
+
+	// 交卷时可以附带最后一批答案，请求体为空也允许
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	session, err := loadExamSession(c.Param("id"), userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if session.Status != examSessionInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Exam session already submitted", "resultId": session.ResultID})
+		return
+	}
+	// 超时后仍可交卷，但交卷时附带的答案不再计入
+	if session.timeUp() {
+		req.Answers = nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// 先将会话标记为已交卷：并发交卷时只有一个请求能更新成功，其余返回 409，避免重复写入考试结果
+	resultID := generateUUID()
+	updated, err := tx.Exec("UPDATE exam_sessions SET status = ?, result_id = ?, submitted_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		examSessionSubmitted, resultID, session.ID, examSessionInProgress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update exam session"})
+		return
+	}
+	if n, err := updated.RowsAffected(); err != nil || n != 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Exam session already submitted"})
+		return
+	}
+
+	if err := writeSessionAnswers(tx, session, req.Answers); err != nil {
+		c.JSON(answerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	questions, err := loadSessionQuestions(session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 判分：未作答的题目计为错误，完全答对才计入正确题数
+	correctCount := 0
+	credits := 0.0
+	results := make(map[string]bool, len(questions))
+	answers := make([]ExamAnswer, 0, len(questions))
+	for i, q := range questions {
+		answer := session.Answers[q.ID]
+		credit := gradeAnswer(q, answer, session.ScoringMode)
+		correct := credit == 1
+		if correct {
+			correctCount++
+		}
+		credits += credit
+		results[q.ID] = correct
+
+		answers = append(answers, ExamAnswer{
+			QuestionID: q.ID,
+			Position:   i,
+			Chosen:     answer,
+			Correct:    correct,
+			Credit:     credit,
+			TimeSpent:  session.timeSpent[q.ID],
+		})
+	}
+
+	totalQuestions := len(questions)
+	wrongCount := totalQuestions - correctCount
+	score := percentScore(credits, totalQuestions)
+	totalTime := int(time.Since(session.StartedAt).Seconds())
+	if session.TimeLimit > 0 && totalTime > session.TimeLimit*60 {
+		totalTime = session.TimeLimit * 60
+	}
+
+	_, err = tx.Exec(`INSERT INTO exam_results
+		(id, user_id, bank_id, score, correct_count, wrong_count, total_questions, total_time, session_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		resultID, userID, session.BankID, score, correctCount, wrongCount, totalQuestions, totalTime, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exam result"})
+		return
+	}
+
+	if err := writeExamAnswers(tx, resultID, answers); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exam answers"})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Exam submitted successfully",
+		"result": ExamResult{
+			ID:             resultID,
+			UserID:         userID,
+			BankID:         session.BankID,
+			Score:          score,
+			CorrectCount:   correctCount,
+			WrongCount:     wrongCount,
+			TotalQuestions: totalQuestions,
+			TotalTime:      totalTime,
+			SessionID:      session.ID,
+			CreatedAt:      time.Now(),
+		},
+		"results": results,
+	})
+}
+
+// 揭晓答案：交卷后可查看全部题目；练习模式下作答后即可查看该题
+func revealExamAnswers(c *gin.Context) {
+	userID := c.GetString("userID")
+	questionID := c.Param("questionId")
+
+	session, err := loadExamSession(c.Param("id"), userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	questions, err := loadSessionQuestions(session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	submitted := session.Status == examSessionSubmitted
+	revealed := []RevealedAnswer{}
+	for _, q := range questions {
+		if questionID != "" && q.ID != questionID {
+			continue
+		}
+
+		yourAnswer, answered := session.Answers[q.ID]
+		if !submitted && !(session.Mode == viewModePractice && answered) {
+			if questionID != "" {
+				c.JSON(http.StatusForbidden, gin.H{"error": "作答或交卷后才能查看答案"})
+				return
+			}
+			continue
+		}
+
+		_, explanationMedia := splitMediaRefs(q.Media)
+		r := RevealedAnswer{
+			QuestionID:       q.ID,
+			Answer:           q.Answer,
+			Answers:          q.Answers,
+			Blanks:           q.Blanks,
+			AcceptedAnswers:  q.AcceptedAnswers,
+			Explanation:      q.Explanation,
+			ExplanationMedia: explanationMedia,
+			YourAnswer:       yourAnswer,
+		}
+		if q.Explanation != "" {
+			r.ExplanationHTML = signMediaURLs(q.BankID, renderContent(q.Format, q.Explanation))
+		}
+		if answered {
+			r.Credit = gradeAnswer(q, yourAnswer, session.ScoringMode)
+			r.Correct = r.Credit == 1
+		}
+		revealed = append(revealed, r)
+	}
+
+	if questionID != "" {
+		if len(revealed) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "题目不在本次考试中"})
+			return
+		}
+		c.JSON(http.StatusOK, revealed[0])
+		return
+	}
+
+	c.JSON(http.StatusOK, revealed)
+}
+
+// 有时间限制的会话根据开始时间计算截止时间
+func (s *ExamSession) setDeadline() {
+	if s.TimeLimit > 0 {
+		deadline := s.StartedAt.Add(time.Duration(s.TimeLimit) * time.Minute)
+		s.Deadline = &deadline
+	}
+}
+
+// 是否已超过截止时间（含宽限时间）
+func (s *ExamSession) timeUp() bool {
+	return s.Deadline != nil && time.Now().After(s.Deadline.Add(examDeadlineGrace))
+}
+
+// 加载属于当前用户的考试会话及已作答记录
+func loadExamSession(sessionID, userID string) (*ExamSession, error) {
+	var session ExamSession
+	var questionIDsJSON string
+	var resultID sql.NullString
+	var submittedAt sql.NullTime
+	err := db.QueryRow(`SELECT id, user_id, bank_id, status, mode, scoring_mode, time_limit, question_ids, result_id, started_at, submitted_at
+		FROM exam_sessions WHERE id = ? AND user_id = ?`, sessionID, userID).
+		Scan(&session.ID, &session.UserID, &session.BankID, &session.Status, &session.Mode, &session.ScoringMode,
+			&session.TimeLimit, &questionIDsJSON, &resultID, &session.StartedAt, &submittedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(questionIDsJSON), &session.QuestionIDs); err != nil {
+		return nil, err
+	}
+	session.ResultID = resultID.String
+	if submittedAt.Valid {
+		session.SubmittedAt = &submittedAt.Time
+	}
+	session.setDeadline()
+
+	rows, err := db.Query("SELECT question_id, answer, time_spent FROM exam_session_answers WHERE session_id = ?", session.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session.Answers = make(map[string]AnswerValue)
+	session.timeSpent = make(map[string]int)
+	for rows.Next() {
+		var questionID, answerJSON string
+		var timeSpent int
+		if err := rows.Scan(&questionID, &answerJSON, &timeSpent); err != nil {
+			return nil, err
+		}
+		session.timeSpent[questionID] = timeSpent
+
+		var answer AnswerValue
+		if err := json.Unmarshal([]byte(answerJSON), &answer); err != nil {
+			return nil, err
+		}
+		session.Answers[questionID] = answer
+	}
+
+	return &session, rows.Err()
+}
+
+// 按会话中的顺序加载题目，已被删除的题目会被跳过
+func loadSessionQuestions(session *ExamSession) ([]Question, error) {
+	questions, err := queryQuestions("WHERE q.bank_id = ?", session.BankID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+
+	ordered := make([]Question, 0, len(session.QuestionIDs))
+	for _, id := range session.QuestionIDs {
+		if q, ok := byID[id]; ok {
+			ordered = append(ordered, q)
+		}
+	}
+
+	return ordered, nil
+}
+
+// 写入作答失败时的状态码：修改已可查看答案的题目返回 409，其他为请求错误
+func answerErrorStatus(err error) int {
+	if errors.Is(err, errAnswerRevealed) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// 校验并写入作答记录，同一道题重复作答时覆盖之前的答案并累计用时；
+// 练习模式下题目作答后答案即可查看，不允许覆盖
+func writeSessionAnswers(tx *sql.Tx, session *ExamSession, answers []sessionAnswer) error {
+	if len(answers) == 0 {
+		return nil
+	}
+
+	questions, err := loadSessionQuestions(session)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+
+	for _, a := range answers {
+		q, ok := byID[a.QuestionID]
+		if !ok {
+			return fmt.Errorf("题目 %s 不在本次考试中", a.QuestionID)
+		}
+		if _, answered := session.Answers[a.QuestionID]; answered && session.Mode == viewModePractice {
+			return fmt.Errorf("题目 %s %w", a.QuestionID, errAnswerRevealed)
+		}
+		answer, err := validateAnswer(q, a.Answer)
+		if err != nil {
+			return fmt.Errorf("题目 %s %v", a.QuestionID, err)
+		}
+
+		answerJSON, err := json.Marshal(answer)
+		if err != nil {
+			return err
+		}
+
+		// 练习模式不删除旧答案，并发提交同一题时由主键拒绝第二次写入
+		if session.Mode != viewModePractice {
+			if _, err := tx.Exec("DELETE FROM exam_session_answers WHERE session_id = ? AND question_id = ?", session.ID, a.QuestionID); err != nil {
+				return err
+			}
+		}
+		timeSpent := session.timeSpent[a.QuestionID] + a.TimeSpent
+		if _, err := tx.Exec("INSERT INTO exam_session_answers (session_id, question_id, answer, time_spent) VALUES (?, ?, ?, ?)",
+			session.ID, a.QuestionID, string(answerJSON), timeSpent); err != nil {
+			return err
+		}
+		session.Answers[a.QuestionID] = answer
+		session.timeSpent[a.QuestionID] = timeSpent
+	}
+
+	return nil
+}
+
+func toExamQuestions(questions []Question) []ExamQuestion {
+	examQuestions := make([]ExamQuestion, 0, len(questions))
+	for _, q := range questions {
+		examQuestions = append(examQuestions, toExamQuestion(q))
+	}
+	return examQuestions
+}
+
+func toExamQuestion(q Question) ExamQuestion {
+	media, _ := splitMediaRefs(q.Media)
+	return ExamQuestion{
+		ID:         q.ID,
+		BankID:     q.BankID,
+		Type:       q.Type,
+		Question:   q.Question,
+		Options:    q.Options,
+		Multiple:   q.Type == questionTypeMultiple,
+		BlankCount: len(q.Blanks),
+		Chapter:    q.Chapter,
+		Media:      media,
+		Format:     q.Format,
+		Rendered: &RenderedContent{
+			Question: signMediaURLs(q.BankID, renderContent(q.Format, q.Question)),
+			Options:  renderOptions(q.BankID, q.Format, q.Options),
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 开始考试并返回会话 ID
+func startTestSession(t *testing.T, r http.Handler, token, bankID, mode string) (string, []ExamQuestion) {
+	t.Helper()
+	w := doJSON(r, "POST", "/api/exam-sessions", token, gin.H{"bankId": bankID, "mode": mode})
+	if w.Code != http.StatusOK {
+		t.Fatalf("start session: %d %s", w.Code, w.Body.String())
+	}
+	var session ExamSession
+	decodeBody(t, w, &session)
+	return session.ID, session.Questions
+}
+
+// 开始考试并按 chosen 依次作答后交卷，返回考试结果
+func submitTestSession(t *testing.T, r http.Handler, token, bankID string, chosen []int) ExamResult {
+	t.Helper()
+	sessionID, questions := startTestSession(t, r, token, bankID, viewModeExam)
+	answers := make([]gin.H, len(chosen))
+	for i, choice := range chosen {
+		answers[i] = gin.H{"questionId": questions[i].ID, "answer": choice}
+	}
+	w := doJSON(r, "POST", "/api/exam-sessions/"+sessionID+"/submit", token, gin.H{"answers": answers})
+	if w.Code != http.StatusOK {
+		t.Fatalf("submit: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Result ExamResult `json:"result"`
+	}
+	decodeBody(t, w, &resp)
+	return resp.Result
+}
+
+func TestSubmitExamSessionConcurrently(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+	sessionID, questions := startTestSession(t, r, token, bankID, viewModeExam)
+
+	answers := make([]gin.H, len(questions))
+	for i, q := range questions {
+		answers[i] = gin.H{"questionId": q.ID, "answer": 0}
+	}
+
+	const submits = 20
+	codes := make([]int, submits)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < submits; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			codes[i] = doJSON(r, "POST", "/api/exam-sessions/"+sessionID+"/submit", token, gin.H{"answers": answers}).Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusConflict:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d submits succeeded, want 1 (codes %v)", succeeded, codes)
+	}
+
+	var results int
+	if err := db.QueryRow("SELECT COUNT(*) FROM exam_results WHERE session_id = ?", sessionID).Scan(&results); err != nil {
+		t.Fatal(err)
+	}
+	if results != 1 {
+		t.Errorf("got %d exam results, want 1", results)
+	}
+}
+
+func TestSubmitExamSessionGrades(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+
+	tests := []struct {
+		chosen []int
+		score  int
+	}{
+		{[]int{0, 0, 0}, 100},
+		{[]int{0, 1, 0}, 67},
+		{[]int{1, 1, 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.chosen), func(t *testing.T) {
+			sessionID, questions := startTestSession(t, r, token, bankID, viewModeExam)
+			answers := make([]gin.H, len(questions))
+			for i, q := range questions {
+				answers[i] = gin.H{"questionId": q.ID, "answer": tt.chosen[i]}
+			}
+			w := doJSON(r, "POST", "/api/exam-sessions/"+sessionID+"/submit", token, gin.H{"answers": answers})
+			if w.Code != http.StatusOK {
+				t.Fatalf("submit: %d %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Result ExamResult `json:"result"`
+			}
+			decodeBody(t, w, &resp)
+			if resp.Result.Score != tt.score {
+				t.Errorf("score = %d, want %d", resp.Result.Score, tt.score)
+			}
+		})
+	}
+}
+
+func TestPracticeAnswerLockedAfterAnswering(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+
+	tests := []struct {
+		mode      string
+		overwrite int
+	}{
+		{viewModePractice, http.StatusConflict},
+		{viewModeExam, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			sessionID, questions := startTestSession(t, r, token, bankID, tt.mode)
+			answerURL := "/api/exam-sessions/" + sessionID + "/answers/" + questions[0].ID
+
+			if w := doJSON(r, "PUT", answerURL, token, gin.H{"answer": 1}); w.Code != http.StatusOK {
+				t.Fatalf("first answer: %d %s", w.Code, w.Body.String())
+			}
+			if tt.mode == viewModePractice {
+				var revealed RevealedAnswer
+				decodeBody(t, doJSON(r, "GET", "/api/exam-sessions/"+sessionID+"/reveal/"+questions[0].ID, token, nil), &revealed)
+				if revealed.Answer != 0 {
+					t.Fatalf("revealed answer = %d, want 0", revealed.Answer)
+				}
+			}
+
+			if w := doJSON(r, "PUT", answerURL, token, gin.H{"answer": 0}); w.Code != tt.overwrite {
+				t.Fatalf("overwrite: got %d, want %d (%s)", w.Code, tt.overwrite, w.Body.String())
+			}
+			submit := gin.H{"answers": []gin.H{{"questionId": questions[0].ID, "answer": 0}}}
+			w := doJSON(r, "POST", "/api/exam-sessions/"+sessionID+"/submit", token, submit)
+			if w.Code != tt.overwrite {
+				t.Fatalf("submit with overwrite: got %d, want %d (%s)", w.Code, tt.overwrite, w.Body.String())
+			}
+		})
+	}
+}
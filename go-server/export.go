@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tealeg/xlsx/v3"
+)
+
+// 导出题库及全部题目，format 为 json（默认）、csv、xlsx、moodle（Moodle XML）或 gift。
+// json、csv、xlsx 的导出文件可以直接通过上传接口重新导入
+func exportQuestionBank(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	bank, err := loadQuestionBank(userID, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question bank not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	var ext, contentType string
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		err = writeJSONExport(&buf, *bank)
+		ext, contentType = ".json", "application/json; charset=utf-8"
+	case "csv":
+		err = writeCSVExport(&buf, *bank)
+		ext, contentType = ".csv", "text/csv; charset=utf-8"
+	case "xlsx":
+		err = writeXLSXExport(&buf, *bank)
+		ext, contentType = ".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case "moodle", "xml":
+		err = writeMoodleXML(&buf, *bank)
+		ext, contentType = ".xml", "application/xml; charset=utf-8"
+	case "gift":
+		err = writeGIFT(&buf, *bank)
+		ext, contentType = ".gift", "text/plain; charset=utf-8"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式，可选 json、csv、xlsx、moodle、gift"})
+		return
+	}
+	if err == errTooManyOptions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败: " + err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": bank.Name + ext}))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// JSON 导出与上传接口的 JSON 格式一致，额外包含题库名称和描述
+func writeJSONExport(w io.Writer, bank QuestionBank) error {
+	data := struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description"`
+		Questions   []Question `json:"questions"`
+	}{bank.Name, bank.Description, bank.Questions}
+	if data.Questions == nil {
+		data.Questions = []Question{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// CSV 导出带 UTF-8 BOM，便于 Excel 直接打开
+func writeCSVExport(w io.Writer, bank QuestionBank) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	rows, err := exportRows(bank.Questions)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func writeXLSXExport(w io.Writer, bank QuestionBank) error {
+	rows, err := exportRows(bank.Questions)
+	if err != nil {
+		return err
+	}
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("题库")
+	if err != nil {
+		return err
+	}
+	for _, values := range rows {
+		row := sheet.AddRow()
+		for _, value := range values {
+			row.AddCell().SetString(value)
+		}
+	}
+	return file.Write(w)
+}
+
+// 表格导入按 选项A…选项Z 识别选项列，选项更多的题库只能导出为 JSON
+const maxTableOptions = 26
+
+var errTooManyOptions = errors.New("题目的选项超过 26 个，无法导出为表格，请使用 JSON 格式")
+
+// 按表格导入的列名生成表头和数据行，选项列数取题库中选项最多的题目
+func exportRows(questions []Question) ([][]string, error) {
+	optionCount := 2
+	hasChapter, hasMarkdown, hasMedia := false, false, false
+	for _, q := range questions {
+		if len(q.Options) > maxTableOptions {
+			return nil, errTooManyOptions
+		}
+		if len(q.Options) > optionCount {
+			optionCount = len(q.Options)
+		}
+		if len(q.Media) > 0 {
+			hasMedia = true
+		}
+		if q.Chapter != "" {
+			hasChapter = true
+		}
+		if q.Format == contentFormatMarkdown {
+			hasMarkdown = true
+		}
+	}
+
+	header := []string{"题目", "题型"}
+	for i := 0; i < optionCount; i++ {
+		header = append(header, fmt.Sprintf("选项%c", 'A'+i))
+	}
+	header = append(header, "正确答案", "解析")
+	// 只有题目分了章节时才导出章节列
+	if hasChapter {
+		header = append(header, "章节")
+	}
+	// 有 Markdown 题目时导出格式列，重新导入时保持格式
+	if hasMarkdown {
+		header = append(header, "格式")
+	}
+	// 引用了媒体文件时导出媒体列，重新导入到同一题库时保留引用
+	if hasMedia {
+		header = append(header, "媒体")
+	}
+
+	rows := [][]string{header}
+	for _, q := range questions {
+		row := []string{q.Question, q.Type}
+		for i := 0; i < optionCount; i++ {
+			option := ""
+			if i < len(q.Options) {
+				option = q.Options[i]
+			}
+			row = append(row, option)
+		}
+		row = append(row, exportAnswer(q), q.Explanation)
+		if hasChapter {
+			row = append(row, q.Chapter)
+		}
+		if hasMarkdown {
+			row = append(row, q.Format)
+		}
+		if hasMedia {
+			media, err := exportMedia(q.Media)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, media)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// 媒体列为引用的 JSON 数组，只保留 id、target、option，文件信息在导入时补全
+func exportMedia(media []MediaRef) (string, error) {
+	if len(media) == 0 {
+		return "", nil
+	}
+	refs := make([]MediaRef, len(media))
+	for i, ref := range media {
+		refs[i] = MediaRef{ID: ref.ID, Target: ref.Target, Option: ref.Option}
+	}
+	data, err := json.Marshal(refs)
+	return string(data), err
+}
+
+// 按 parseRowAnswer 的格式写出答案列
+func exportAnswer(q Question) string {
+	switch q.Type {
+	case questionTypeTrueFalse:
+		if q.Answer == 1 {
+			return "错"
+		}
+		return "对"
+	case questionTypeFillBlank:
+		blanks := make([]string, len(q.Blanks))
+		for i, accepted := range q.Blanks {
+			blanks[i] = joinEscaped(accepted, blankEscaper)
+		}
+		return strings.Join(blanks, ";")
+	case questionTypeShortAnswer:
+		return joinEscaped(q.AcceptedAnswers, answerEscaper)
+	}
+
+	letters := make([]byte, 0, len(q.Options))
+	for _, index := range correctAnswers(q) {
+		letters = append(letters, byte('A'+index))
+	}
+	return string(letters)
+}
+
+// 答案文本中的分隔符和 "\" 按 splitAnswerCell 的规则转义：填空题还需转义各空之间的分号，简答题只有 "|" 是分隔符
+var (
+	blankEscaper  = strings.NewReplacer(`\`, `\\`, "|", `\|`, ";", `\;`, "；", `\；`)
+	answerEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`)
+)
+
+func joinEscaped(answers []string, escaper *strings.Replacer) string {
+	escaped := make([]string, len(answers))
+	for i, answer := range answers {
+		escaped[i] = escaper.Replace(answer)
+	}
+	return strings.Join(escaped, "|")
+}
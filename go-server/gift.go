@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GIFT 格式中需要用反斜杠转义的字符
+const giftSpecialChars = "~=#{}:"
+
+// 题干中表示填空位置的下划线（两个以上）
+var blankPlaceholder = regexp.MustCompile(`_{2,}`)
+
+// GIFT 文本中的一道题及其起始行号
+type giftBlock struct {
+	line int
+	text string
+}
+
+// GIFT 中的一个答案：prefix 为 '=' 或 '~'，weight 为 %n% 给出的得分比例
+type giftAnswer struct {
+	prefix    rune
+	weight    float64
+	hasWeight bool
+	text      string
+}
+
+// 解析 GIFT 文本文件，报告中的行号为题目在文件中的起始行号
+func parseGIFTFile(file io.Reader) ([]Question, *ImportReport, error) {
+	blocks, err := splitGIFTBlocks(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GIFT文件读取失败: %v", err)
+	}
+	if len(blocks) == 0 {
+		return nil, nil, fmt.Errorf("未找到有效的题目数据")
+	}
+
+	report := &ImportReport{Rows: []ImportRowResult{}}
+	var questions []Question
+	for _, block := range blocks {
+		q, skipReason, err := parseGIFTQuestion(block.text)
+		if err != nil {
+			report.add(block.line, importRowError, q.Question, err.Error())
+			continue
+		}
+		if skipReason != "" {
+			report.add(block.line, importRowSkipped, q.Question, skipReason)
+			continue
+		}
+		if report.check(block.line, &q) {
+			questions = append(questions, q)
+		}
+	}
+
+	return questions, report, nil
+}
+
+// 按空行拆分题目，忽略 // 注释和 $CATEGORY 行
+func splitGIFTBlocks(file io.Reader) ([]giftBlock, error) {
+	var blocks []giftBlock
+	var current []string
+	start := 0
+
+	flush := func() {
+		if len(current) > 0 {
+			blocks = append(blocks, giftBlock{line: start, text: strings.Join(current, "\n")})
+			current = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			continue
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			flush()
+		default:
+			if len(current) == 0 {
+				start = line
+			}
+			current = append(current, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return blocks, nil
+}
+
+// 解析单道 GIFT 题目，不支持的题型（描述、问答、数值、匹配）返回跳过原因
+func parseGIFTQuestion(text string) (Question, string, error) {
+	var q Question
+	text = strings.TrimSpace(text)
+
+	// 标题 ::title::
+	if strings.HasPrefix(text, "::") {
+		end := indexUnescaped(text[2:], "::")
+		if end < 0 {
+			return q, "", fmt.Errorf("标题缺少结束的 ::")
+		}
+		text = strings.TrimSpace(text[2+end+2:])
+	}
+
+	// 格式标记 [html]、[plain]、[markdown]、[moodle]
+	isHTML := false
+	for _, format := range []string{"[html]", "[plain]", "[markdown]", "[moodle]"} {
+		if strings.HasPrefix(text, format) {
+			isHTML = format == "[html]"
+			if format == "[markdown]" {
+				q.Format = contentFormatMarkdown
+			}
+			text = strings.TrimSpace(strings.TrimPrefix(text, format))
+			break
+		}
+	}
+
+	open := indexUnescaped(text, "{")
+	if open < 0 {
+		q.Question = unescapeGIFT(text)
+		return q, "没有答案，描述类题目不导入", nil
+	}
+	end := indexUnescaped(text[open:], "}")
+	if end < 0 {
+		return q, "", fmt.Errorf("答案缺少结束的 }")
+	}
+	end += open
+
+	// 答案块后还有文字时为填空（missing word）格式，答案位置记为 ____
+	body := text[open+1 : end]
+	missingWord := strings.TrimSpace(text[end+1:]) != ""
+	if missingWord {
+		q.Question = text[:open] + "____" + text[end+1:]
+	} else {
+		q.Question = text[:open]
+	}
+	q.Question = strings.TrimSpace(unescapeGIFT(q.Question))
+	if isHTML {
+		q.Question = htmlToText(q.Question)
+	}
+
+	// 总体反馈 ####
+	if i := indexUnescaped(body, "####"); i >= 0 {
+		q.Explanation = strings.TrimSpace(unescapeGIFT(body[i+4:]))
+		body = body[:i]
+	}
+	body = strings.TrimSpace(body)
+
+	switch {
+	case body == "":
+		return q, "不支持的题型: 问答题", nil
+	case strings.HasPrefix(body, "#"):
+		return q, "不支持的题型: 数值题", nil
+	}
+
+	// 判断题 {T} {TRUE} {F} {FALSE}，可带 #反馈
+	answerText := body
+	if i := indexUnescaped(answerText, "#"); i >= 0 {
+		answerText = answerText[:i]
+	}
+	switch strings.ToUpper(strings.TrimSpace(answerText)) {
+	case "T", "TRUE":
+		q.Type, q.Options, q.Answer = questionTypeTrueFalse, trueFalseOptions, 0
+		return q, "", nil
+	case "F", "FALSE":
+		q.Type, q.Options, q.Answer = questionTypeTrueFalse, trueFalseOptions, 1
+		return q, "", nil
+	}
+
+	answers, err := parseGIFTAnswers(body)
+	if err != nil {
+		return q, "", err
+	}
+	hasWrong := false
+	for _, a := range answers {
+		if indexUnescaped(a.text, "->") >= 0 {
+			return q, "不支持的题型: 匹配题", nil
+		}
+		if a.prefix == '~' {
+			hasWrong = true
+		}
+	}
+
+	// 只有 = 答案时为简答题，位于题干中间时为填空题
+	if !hasWrong {
+		var accepted []string
+		for _, a := range answers {
+			accepted = append(accepted, a.text)
+		}
+		if missingWord {
+			q.Type, q.Blanks = questionTypeFillBlank, [][]string{accepted}
+		} else {
+			q.Type, q.AcceptedAnswers = questionTypeShortAnswer, accepted
+		}
+		return q, "", nil
+	}
+
+	// 选择题：= 或正权重的 ~ 为正确选项，带权重或多个正确选项时为多选题
+	weighted := false
+	for i, a := range answers {
+		q.Options = append(q.Options, a.text)
+		if a.prefix == '=' || (a.hasWeight && a.weight > 0) {
+			q.Answers = append(q.Answers, i)
+		}
+		if a.prefix == '~' && a.hasWeight && a.weight > 0 {
+			weighted = true
+		}
+	}
+	if len(q.Answers) == 0 {
+		return q, "", fmt.Errorf("没有正确选项")
+	}
+	if len(q.Answers) > 1 || weighted {
+		q.Type = questionTypeMultiple
+	} else {
+		q.Type, q.Answer, q.Answers = questionTypeSingle, q.Answers[0], nil
+	}
+	return q, "", nil
+}
+
+// 拆分答案块中的各个答案，每个答案以未转义的 = 或 ~ 开头
+func parseGIFTAnswers(body string) ([]giftAnswer, error) {
+	var answers []giftAnswer
+	var current *giftAnswer
+	var text strings.Builder
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		if err := current.parse(text.String()); err != nil {
+			return err
+		}
+		answers = append(answers, *current)
+		text.Reset()
+		return nil
+	}
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			text.WriteRune(r)
+			text.WriteRune(runes[i+1])
+			i++
+		case r == '=' || r == '~':
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			current = &giftAnswer{prefix: r}
+		default:
+			if current == nil {
+				if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+					continue
+				}
+				return nil, fmt.Errorf("答案必须以 = 或 ~ 开头")
+			}
+			text.WriteRune(r)
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if len(answers) == 0 {
+		return nil, fmt.Errorf("没有答案")
+	}
+	return answers, nil
+}
+
+// 解析答案的 %权重%、文本和 #反馈（反馈不导入）
+func (a *giftAnswer) parse(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "%") {
+		end := strings.Index(raw[1:], "%")
+		if end < 0 {
+			return fmt.Errorf("答案权重缺少结束的 %%")
+		}
+		weight, err := strconv.ParseFloat(raw[1:1+end], 64)
+		if err != nil {
+			return fmt.Errorf("无效的答案权重: %s", raw[1:1+end])
+		}
+		a.weight, a.hasWeight = weight, true
+		raw = raw[end+2:]
+	}
+	if i := indexUnescaped(raw, "#"); i >= 0 {
+		raw = raw[:i]
+	}
+	a.text = strings.TrimSpace(unescapeGIFT(raw))
+	if a.text == "" {
+		return fmt.Errorf("答案不能为空")
+	}
+	return nil
+}
+
+// 将题库导出为 GIFT 文本。GIFT 不支持多空填空题，这类题目以注释形式标出并跳过
+func writeGIFT(w io.Writer, bank QuestionBank) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n", strings.ReplaceAll(bank.Name, "\n", " "))
+	for _, line := range strings.Split(bank.Description, "\n") {
+		if strings.TrimSpace(line) != "" {
+			fmt.Fprintf(&b, "// %s\n", line)
+		}
+	}
+	fmt.Fprintf(&b, "$CATEGORY: $course$/top/%s\n\n", strings.ReplaceAll(bank.Name, "\n", " "))
+
+	for i, q := range bank.Questions {
+		block, ok := formatGIFTQuestion(i+1, q)
+		if !ok {
+			fmt.Fprintf(&b, "// 第 %d 题为多空填空题，GIFT 格式不支持，已跳过\n\n", i+1)
+			continue
+		}
+		b.WriteString(block)
+		b.WriteString("\n\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatGIFTQuestion(n int, q Question) (string, bool) {
+	title := fmt.Sprintf("::Q%d:: ", n)
+	// Markdown 题目标记为 [markdown] 并导出原文，重新导入时保持格式
+	if q.Format == contentFormatMarkdown {
+		title += "[markdown]"
+	}
+	stem := escapeGIFT(q.Question)
+	feedback := ""
+	if q.Explanation != "" {
+		feedback = " ####" + escapeGIFT(q.Explanation)
+	}
+
+	switch q.Type {
+	case questionTypeTrueFalse:
+		answer := "T"
+		if q.Answer == 1 {
+			answer = "F"
+		}
+		return title + stem + " {" + answer + feedback + "}", true
+	case questionTypeShortAnswer:
+		return title + stem + " {" + giftAlternatives(q.AcceptedAnswers) + feedback + "}", true
+	case questionTypeFillBlank:
+		if len(q.Blanks) != 1 {
+			return "", false
+		}
+		// 题干中的空位替换为答案块；没有空位时追加在末尾，导入后为简答题
+		return title + fillPlaceholders(stem, []string{"{" + giftAlternatives(q.Blanks[0]) + feedback + "}"}), true
+	}
+
+	correct := make(map[int]bool)
+	for _, index := range correctAnswers(q) {
+		correct[index] = true
+	}
+
+	var b strings.Builder
+	b.WriteString(title + stem + " {\n")
+	for i, option := range q.Options {
+		switch {
+		case !correct[i]:
+			b.WriteString("\t~")
+		case q.Type == questionTypeMultiple:
+			b.WriteString("\t~%" + formatFraction(len(correct)) + "%")
+		default:
+			b.WriteString("\t=")
+		}
+		b.WriteString(escapeGIFT(option) + "\n")
+	}
+	if feedback != "" {
+		b.WriteString("\t" + strings.TrimSpace(feedback) + "\n")
+	}
+	b.WriteString("}")
+	return b.String(), true
+}
+
+func giftAlternatives(accepted []string) string {
+	alternatives := make([]string, len(accepted))
+	for i, text := range accepted {
+		alternatives[i] = "=" + escapeGIFT(text)
+	}
+	return strings.Join(alternatives, " ")
+}
+
+// 依次用 markers 替换题干中的空位，空位不足时把剩余的标记追加在题干末尾
+func fillPlaceholders(text string, markers []string) string {
+	used := 0
+	text = blankPlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if used >= len(markers) {
+			return placeholder
+		}
+		used++
+		return markers[used-1]
+	})
+	if used < len(markers) {
+		text += " " + strings.Join(markers[used:], " ")
+	}
+	return text
+}
+
+func escapeGIFT(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+		case strings.ContainsRune(giftSpecialChars, r):
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func unescapeGIFT(text string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			i++
+			if runes[i] == 'n' {
+				b.WriteRune('\n')
+			} else {
+				b.WriteRune(runes[i])
+			}
+			continue
+		}
+		b.WriteRune(runes[i])
+	}
+	return b.String()
+}
+
+// 查找未被反斜杠转义的子串，返回字节偏移，找不到时返回 -1
+func indexUnescaped(text, sub string) int {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(text[i:], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 按未转义的分隔符拆分，保留转义字符
+func splitUnescaped(text string, sep string) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(text, sep)
+		if i < 0 {
+			return append(parts, text)
+		}
+		parts = append(parts, text[:i])
+		text = text[i+len(sep):]
+	}
+}
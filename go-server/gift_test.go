@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// 导出后重新导入的题目应与导出前一致
+func TestGIFTRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		q    Question
+	}{
+		{"single choice", Question{Type: questionTypeSingle, Question: "1 + 1 = ?", Options: []string{"2", "3"}, Answer: 0, Explanation: "算术"}},
+		{"multiple choice", Question{Type: questionTypeMultiple, Question: "偶数", Options: []string{"2", "3", "4"}, Answers: []int{0, 2}}},
+		{"true false", Question{Type: questionTypeTrueFalse, Question: "地球是圆的", Answer: 0}},
+		{"short answer", Question{Type: questionTypeShortAnswer, Question: "首都", AcceptedAnswers: []string{"北京", "Beijing"}}},
+		{"fill blank", Question{Type: questionTypeFillBlank, Question: "____ 是首都", Blanks: [][]string{{"北京"}}}},
+		{"special characters", Question{Type: questionTypeSingle, Question: "a{b}=c~d#e:f", Options: []string{"=x", "~y"}, Answer: 1}},
+		{"markdown", Question{Type: questionTypeSingle, Question: "**粗体** 与 `代码`", Options: []string{"*斜体*", "$x^2$"}, Answer: 1,
+			Explanation: "- 列表", Format: contentFormatMarkdown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.q
+			if err := normalizeQuestion(&want); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := writeGIFT(&buf, QuestionBank{Name: "bank", Questions: []Question{tt.q}}); err != nil {
+				t.Fatal(err)
+			}
+			questions, report, err := parseGIFTFile(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(questions) != 1 {
+				t.Fatalf("got %d questions, report %+v\n%s", len(questions), report.Rows, buf.String())
+			}
+			if got := questions[0]; !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// 题型
+const (
+	questionTypeSingle      = "single_choice"
+	questionTypeMultiple    = "multiple_choice"
+	questionTypeTrueFalse   = "true_false"
+	questionTypeFillBlank   = "fill_blank"
+	questionTypeShortAnswer = "short_answer"
+)
+
+// 判断题未提供选项时使用的默认选项
+var trueFalseOptions = []string{"正确", "错误"}
+
+// 评分模式：all_or_nothing 多选题、填空题须完全答对才得分，partial 按答对比例得分
+const (
+	scoringAllOrNothing = "all_or_nothing"
+	scoringPartial      = "partial"
+)
+
+// 作答内容：选择题和判断题为选项索引列表，填空题和简答题为文本列表。
+// 反序列化时兼容数字（单选）、数字数组（多选）、布尔值（判断）、字符串（简答）和字符串数组（填空）。
+type AnswerValue struct {
+	Choices []int
+	Texts   []string
+}
+
+func (a *AnswerValue) UnmarshalJSON(data []byte) error {
+	*a = AnswerValue{}
+
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case nil:
+		return nil
+	case float64:
+		a.Choices = []int{int(v)}
+	case bool:
+		// true 对应第一个选项“正确”，false 对应第二个选项“错误”
+		if v {
+			a.Choices = []int{0}
+		} else {
+			a.Choices = []int{1}
+		}
+	case string:
+		a.Texts = []string{v}
+	case []interface{}:
+		if len(v) > 0 {
+			if _, isText := v[0].(string); isText {
+				return json.Unmarshal(data, &a.Texts)
+			}
+		}
+		if err := json.Unmarshal(data, &a.Choices); err != nil {
+			return fmt.Errorf("答案数组中的元素类型必须一致")
+		}
+	default:
+		return fmt.Errorf("不支持的答案格式")
+	}
+	return nil
+}
+
+func (a AnswerValue) MarshalJSON() ([]byte, error) {
+	switch {
+	case a.Texts != nil:
+		return json.Marshal(a.Texts)
+	case a.Choices != nil:
+		return json.Marshal(a.Choices)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+func (a AnswerValue) IsEmpty() bool {
+	return len(a.Choices) == 0 && len(a.Texts) == 0
+}
+
+// 选择题和判断题按选项作答
+func isChoiceType(questionType string) bool {
+	return questionType == questionTypeSingle || questionType == questionTypeMultiple || questionType == questionTypeTrueFalse
+}
+
+// 题目的正确答案：多选题为 Answers，单选题和判断题为 Answer
+func correctAnswers(q Question) []int {
+	if len(q.Answers) > 0 {
+		return q.Answers
+	}
+	return []int{q.Answer}
+}
+
+// 规范化并校验题目：未指定题型时根据答案推断，并按题型校验选项和答案
+func normalizeQuestion(q *Question) error {
+	q.Chapter = strings.TrimSpace(q.Chapter)
+	format, err := normalizeContentFormat(q.Format)
+	if err != nil {
+		return err
+	}
+	q.Format = format
+	if q.Type == "" {
+		q.Type = questionTypeSingle
+		if len(q.Answers) > 0 {
+			q.Type = questionTypeMultiple
+		}
+	}
+
+	// 与表格导入一致：题干、选项和解析去掉首尾空白，不允许空选项，导出后再导入内容不变
+	q.Question = strings.TrimSpace(q.Question)
+	if q.Question == "" {
+		return fmt.Errorf("题目不能为空")
+	}
+	q.Explanation = strings.TrimSpace(q.Explanation)
+	if len(q.Options) > 0 {
+		options := make([]string, len(q.Options))
+		for i, option := range q.Options {
+			if options[i] = strings.TrimSpace(option); options[i] == "" {
+				return fmt.Errorf("选项%c为空", 'A'+i)
+			}
+		}
+		q.Options = options
+	}
+
+	switch q.Type {
+	case questionTypeSingle:
+		q.Answers = nil
+		if len(q.Options) < 2 {
+			return fmt.Errorf("选择题至少需要两个选项")
+		}
+		if q.Answer < 0 || q.Answer >= len(q.Options) {
+			return fmt.Errorf("答案索引超出选项范围")
+		}
+	case questionTypeMultiple:
+		if len(q.Options) < 2 {
+			return fmt.Errorf("选择题至少需要两个选项")
+		}
+		if len(q.Answers) == 0 {
+			q.Answers = []int{q.Answer}
+		}
+		answers, err := normalizeChoice(q.Answers, len(q.Options))
+		if err != nil {
+			return err
+		}
+		// Answer 同步为第一个正确选项以兼容旧客户端
+		q.Answers = answers
+		q.Answer = answers[0]
+	case questionTypeTrueFalse:
+		q.Answers = nil
+		if len(q.Options) == 0 {
+			q.Options = trueFalseOptions
+		}
+		if len(q.Options) != 2 {
+			return fmt.Errorf("判断题只能有两个选项")
+		}
+		if q.Answer != 0 && q.Answer != 1 {
+			return fmt.Errorf("判断题答案只能为 0（正确）或 1（错误）")
+		}
+	case questionTypeFillBlank:
+		if len(q.Blanks) == 0 {
+			return fmt.Errorf("填空题至少需要一个空")
+		}
+		for i, accepted := range q.Blanks {
+			q.Blanks[i] = trimTexts(accepted)
+			if len(q.Blanks[i]) == 0 {
+				return fmt.Errorf("第 %d 个空缺少参考答案", i+1)
+			}
+		}
+		q.Options, q.Answer, q.Answers, q.AcceptedAnswers = []string{}, 0, nil, nil
+	case questionTypeShortAnswer:
+		q.AcceptedAnswers = trimTexts(q.AcceptedAnswers)
+		if len(q.AcceptedAnswers) == 0 {
+			return fmt.Errorf("简答题至少需要一个参考答案")
+		}
+		q.Options, q.Answer, q.Answers, q.Blanks = []string{}, 0, nil, nil
+	default:
+		return fmt.Errorf("不支持的题型: %s", q.Type)
+	}
+
+	return normalizeMediaRefs(q)
+}
+
+// 校验作答是否符合题型，返回规范化后的作答
+func validateAnswer(q Question, answer AnswerValue) (AnswerValue, error) {
+	if isChoiceType(q.Type) {
+		if answer.Choices == nil {
+			return AnswerValue{}, fmt.Errorf("请选择选项")
+		}
+		choices, err := normalizeChoice(answer.Choices, len(q.Options))
+		if err != nil {
+			return AnswerValue{}, err
+		}
+		if q.Type != questionTypeMultiple && len(choices) != 1 {
+			return AnswerValue{}, fmt.Errorf("该题只能选择一个选项")
+		}
+		return AnswerValue{Choices: choices}, nil
+	}
+
+	if answer.Texts == nil {
+		return AnswerValue{}, fmt.Errorf("请填写答案")
+	}
+	if q.Type == questionTypeFillBlank && len(answer.Texts) > len(q.Blanks) {
+		return AnswerValue{}, fmt.Errorf("填写的空数超过题目的空数")
+	}
+	if q.Type == questionTypeShortAnswer && len(answer.Texts) != 1 {
+		return AnswerValue{}, fmt.Errorf("简答题只能提交一个答案")
+	}
+	return answer, nil
+}
+
+func normalizeChoice(choice []int, optionCount int) ([]int, error) {
+	if len(choice) == 0 {
+		return nil, fmt.Errorf("至少需要选择一个选项")
+	}
+
+	seen := make(map[int]bool, len(choice))
+	normalized := make([]int, 0, len(choice))
+	for _, index := range choice {
+		if index < 0 || index >= optionCount {
+			return nil, fmt.Errorf("答案索引超出选项范围")
+		}
+		if !seen[index] {
+			seen[index] = true
+			normalized = append(normalized, index)
+		}
+	}
+	sort.Ints(normalized)
+	return normalized, nil
+}
+
+// 计算单题得分（0~1）
+func gradeAnswer(q Question, answer AnswerValue, scoringMode string) float64 {
+	if answer.IsEmpty() {
+		return 0
+	}
+
+	switch q.Type {
+	case questionTypeFillBlank:
+		return gradeBlanks(q.Blanks, answer.Texts, scoringMode)
+	case questionTypeShortAnswer:
+		if len(answer.Texts) > 0 && matchesAccepted(answer.Texts[0], q.AcceptedAnswers) {
+			return 1
+		}
+		return 0
+	default:
+		return gradeChoice(q, answer.Choices, scoringMode)
+	}
+}
+
+// 选择题：选错任一选项不得分；partial 模式下按选对的比例给分
+func gradeChoice(q Question, choice []int, scoringMode string) float64 {
+	correct := make(map[int]bool)
+	for _, index := range correctAnswers(q) {
+		correct[index] = true
+	}
+
+	hits := 0
+	for _, index := range choice {
+		if !correct[index] {
+			return 0
+		}
+		hits++
+	}
+
+	if hits == len(correct) {
+		return 1
+	}
+	if scoringMode == scoringPartial {
+		return float64(hits) / float64(len(correct))
+	}
+	return 0
+}
+
+// 填空题：每个空与该空的任一参考答案匹配即为答对；partial 模式下按答对的空数比例给分
+func gradeBlanks(blanks [][]string, texts []string, scoringMode string) float64 {
+	hits := 0
+	for i, accepted := range blanks {
+		if i < len(texts) && matchesAccepted(texts[i], accepted) {
+			hits++
+		}
+	}
+
+	if hits == len(blanks) {
+		return 1
+	}
+	if scoringMode == scoringPartial {
+		return float64(hits) / float64(len(blanks))
+	}
+	return 0
+}
+
+// 文本答案比较时忽略大小写、首尾空白和多余的空白
+func matchesAccepted(text string, accepted []string) bool {
+	normalized := normalizeText(text)
+	if normalized == "" {
+		return false
+	}
+	for _, candidate := range accepted {
+		if normalizeText(candidate) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+func trimTexts(texts []string) []string {
+	trimmed := make([]string, 0, len(texts))
+	for _, text := range texts {
+		if text = strings.TrimSpace(text); text != "" {
+			trimmed = append(trimmed, text)
+		}
+	}
+	return trimmed
+}
+
+// 按得分总和换算为百分制成绩
+func percentScore(credits float64, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return int(math.Round(credits / float64(total) * 100))
+}
+
+func validScoringMode(mode string) bool {
+	return mode == scoringAllOrNothing || mode == scoringPartial
+}
@@ -0,0 +1,108 @@
+package main
+
+import "testing"
+
+func TestGradeChoice(t *testing.T) {
+	single := Question{Type: questionTypeSingle, Options: []string{"A", "B", "C"}, Answer: 1}
+	multiple := Question{Type: questionTypeMultiple, Options: []string{"A", "B", "C", "D"}, Answers: []int{0, 2, 3}}
+
+	tests := []struct {
+		name   string
+		q      Question
+		choice []int
+		mode   string
+		want   float64
+	}{
+		{"single correct", single, []int{1}, scoringAllOrNothing, 1},
+		{"single wrong", single, []int{0}, scoringAllOrNothing, 0},
+		{"single wrong partial", single, []int{2}, scoringPartial, 0},
+		{"multiple all correct", multiple, []int{0, 2, 3}, scoringAllOrNothing, 1},
+		{"multiple all correct partial", multiple, []int{0, 2, 3}, scoringPartial, 1},
+		{"multiple missing one", multiple, []int{0, 2}, scoringAllOrNothing, 0},
+		{"multiple missing one partial", multiple, []int{0, 2}, scoringPartial, 2.0 / 3},
+		{"multiple one wrong partial", multiple, []int{0, 1}, scoringPartial, 0},
+		{"multiple empty partial", multiple, []int{}, scoringPartial, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gradeChoice(tt.q, tt.choice, tt.mode); got != tt.want {
+				t.Errorf("gradeChoice = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentScore(t *testing.T) {
+	tests := []struct {
+		credits float64
+		total   int
+		want    int
+	}{
+		{0, 0, 0},
+		{0, 3, 0},
+		{3, 3, 100},
+		{1, 3, 33},
+		{2, 3, 67},
+		{0.5, 1, 50},
+		{2.0 / 3, 2, 33},
+	}
+	for _, tt := range tests {
+		if got := percentScore(tt.credits, tt.total); got != tt.want {
+			t.Errorf("percentScore(%v, %d) = %d, want %d", tt.credits, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestGradeBlanks(t *testing.T) {
+	blanks := [][]string{{"北京", "Beijing"}, {"长江"}}
+
+	tests := []struct {
+		name  string
+		texts []string
+		mode  string
+		want  float64
+	}{
+		{"all correct", []string{"北京", "长江"}, scoringAllOrNothing, 1},
+		{"alternative answer", []string{"beijing", "长江"}, scoringAllOrNothing, 1},
+		{"extra whitespace", []string{"  BEIJING ", " 长江"}, scoringAllOrNothing, 1},
+		{"one wrong", []string{"北京", "黄河"}, scoringAllOrNothing, 0},
+		{"one wrong partial", []string{"北京", "黄河"}, scoringPartial, 0.5},
+		{"missing blank partial", []string{"北京"}, scoringPartial, 0.5},
+		{"empty text partial", []string{"", "长江"}, scoringPartial, 0.5},
+		{"none correct partial", []string{"上海", "黄河"}, scoringPartial, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gradeBlanks(blanks, tt.texts, tt.mode); got != tt.want {
+				t.Errorf("gradeBlanks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGradeAnswer(t *testing.T) {
+	trueFalse := Question{Type: questionTypeTrueFalse, Options: trueFalseOptions, Answer: 1}
+	fillBlank := Question{Type: questionTypeFillBlank, Blanks: [][]string{{"a"}, {"b"}}}
+	shortAnswer := Question{Type: questionTypeShortAnswer, AcceptedAnswers: []string{"Hello World"}}
+
+	tests := []struct {
+		name   string
+		q      Question
+		answer AnswerValue
+		want   float64
+	}{
+		{"true false correct", trueFalse, AnswerValue{Choices: []int{1}}, 1},
+		{"true false wrong", trueFalse, AnswerValue{Choices: []int{0}}, 0},
+		{"fill blank partial", fillBlank, AnswerValue{Texts: []string{"a", "x"}}, 0.5},
+		{"short answer normalized", shortAnswer, AnswerValue{Texts: []string{"hello   world"}}, 1},
+		{"short answer wrong", shortAnswer, AnswerValue{Texts: []string{"hello"}}, 0},
+		{"empty answer", shortAnswer, AnswerValue{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gradeAnswer(tt.q, tt.answer, scoringPartial); got != tt.want {
+				t.Errorf("gradeAnswer = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
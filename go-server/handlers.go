@@ -1,13 +1,14 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -54,45 +55,61 @@ func getQuestionBankByID(c *gin.Context) {
 	userID := c.GetString("userID")
 	bankID := c.Param("id")
 
-	// 获取题库信息
-	var bank QuestionBank
-	err := db.QueryRow("SELECT id, user_id, name, description, created_at FROM question_banks WHERE id = ? AND user_id = ?",
-		bankID, userID).Scan(&bank.ID, &bank.UserID, &bank.Name, &bank.Description, &bank.CreatedAt)
-	if err != nil {
+	bank, err := loadQuestionBank(userID, bankID)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question bank not found"})
 		return
 	}
-
-	// 获取题目
-	rows, err := db.Query("SELECT id, bank_id, question, options, answer, explanation FROM questions WHERE bank_id = ?", bankID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var questions []Question
-	for rows.Next() {
-		var q Question
-		var optionsJSON string
-		err := rows.Scan(&q.ID, &q.BankID, &q.Question, &optionsJSON, &q.Answer, &q.Explanation)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	includeAnswers, err := includesAnswerKey(c.Query("mode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !includeAnswers {
+		c.JSON(http.StatusOK, struct {
+			QuestionBank
+			Questions []ExamQuestion `json:"questions"`
+		}{*bank, toExamQuestions(bank.Questions)})
+		return
+	}
 
-		// 解析选项JSON
-		err = json.Unmarshal([]byte(optionsJSON), &q.Options)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse options"})
-			return
-		}
+	renderQuestions(bank.Questions)
+	c.JSON(http.StatusOK, bank)
+}
 
-		questions = append(questions, q)
+// 获取题目时是否下发答案和解析：默认不下发，只有 mode=manage（题库所有者编辑题目）时下发。
+// 考试和练习应通过考试会话进行，答案在作答或交卷后揭晓
+func includesAnswerKey(mode string) (bool, error) {
+	switch {
+	case mode == viewModeManage:
+		return true, nil
+	case mode == "" || hidesAnswerKey(mode):
+		return false, nil
+	}
+	return false, fmt.Errorf("mode 只能为 manage、exam 或 practice")
+}
+
+// 加载当前用户的题库及其全部题目
+func loadQuestionBank(userID, bankID string) (*QuestionBank, error) {
+	var bank QuestionBank
+	err := db.QueryRow("SELECT id, user_id, name, description, created_at FROM question_banks WHERE id = ? AND user_id = ?",
+		bankID, userID).Scan(&bank.ID, &bank.UserID, &bank.Name, &bank.Description, &bank.CreatedAt)
+	if err != nil {
+		return nil, err
 	}
 
+	questions, err := queryQuestions("WHERE q.bank_id = ?", bankID)
+	if err != nil {
+		return nil, err
+	}
 	bank.Questions = questions
-	c.JSON(http.StatusOK, bank)
+	bank.QuestionCount = len(questions)
+	return &bank, nil
 }
 
 func createQuestionBank(c *gin.Context) {
@@ -109,6 +126,19 @@ func createQuestionBank(c *gin.Context) {
 		return
 	}
 
+	// 系统设置中的每用户题库数上限
+	if limit := currentSettings().MaxBanksPerUser; limit > 0 {
+		var bankCount int
+		if err := db.QueryRow("SELECT COUNT(*) FROM question_banks WHERE user_id = ?", userID).Scan(&bankCount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if bankCount >= limit {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("每个用户最多创建 %d 个题库", limit)})
+			return
+		}
+	}
+
 	// 开始事务
 	tx, err := db.Begin()
 	if err != nil {
@@ -127,17 +157,18 @@ func createQuestionBank(c *gin.Context) {
 	}
 
 	// 插入题目
-	for _, q := range req.Questions {
-		optionsJSON, err := json.Marshal(q.Options)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal options"})
+	for i, q := range req.Questions {
+		if err := normalizeQuestion(&q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("第 %d 题%v", i+1, err)})
+			return
+		}
+		// 新题库中还没有媒体文件，带有媒体引用的题目会在这里被拒绝
+		if err := attachMediaRefs(bankID, q.Media); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("第 %d 题%v", i+1, err)})
 			return
 		}
 
-		questionID := generateUUID()
-		_, err = tx.Exec("INSERT INTO questions (id, bank_id, question, options, answer, explanation) VALUES (?, ?, ?, ?, ?, ?)",
-			questionID, bankID, q.Question, string(optionsJSON), q.Answer, q.Explanation)
-		if err != nil {
+		if _, err := insertQuestion(tx, bankID, q); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create question"})
 			return
 		}
@@ -169,49 +200,79 @@ func uploadQuestionBankFile(c *gin.Context) {
 		return
 	}
 
+	// 在解析表单之前限制上传大小
+	limit := maxUploadBytes()
+	if c.Request.ContentLength > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("上传文件不能超过 %d MB", limit>>20)})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
 	// 获取上传的文件
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("上传文件不能超过 %d MB", limit>>20)})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
 		return
 	}
 	defer file.Close()
 
-	// 解析文件
-	questions, err := parseUploadedFile(file, header)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	opts := importOptions{
+		// sheets 可重复，指定要导入的 Excel 工作表，未指定时导入全部工作表
+		Sheets: trimTexts(c.PostFormArray("sheets")),
+		// duplicates 指定重复题目的处理策略：skip（默认）、overwrite 或 keep
+		Duplicates: c.DefaultPostForm("duplicates", duplicateSkip),
+		// 默认任一行出错都不导入；skipInvalid=true 时只导入通过校验的行
+		SkipInvalid: c.PostForm("skipInvalid") == "true",
+		// dryRun=true 时只返回逐行报告，不写入数据库
+		DryRun: c.PostForm("dryRun") == "true",
+	}
+	if !validDuplicatePolicy(opts.Duplicates) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duplicates 只能为 skip、overwrite 或 keep"})
 		return
 	}
 
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-		return
+	// profileId 指定使用已保存的导入配置
+	if profileID := c.PostForm("profileId"); profileID != "" {
+		profile, err := loadImportProfile(userID, profileID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		opts.Mapping = &profile.Mapping
 	}
-	defer tx.Rollback()
 
-	// 插入题目
-	for i, q := range questions {
-		optionsJSON, err := json.Marshal(q.Options)
+	// async=true 时保存文件并创建导入任务，立即返回任务 ID
+	if c.PostForm("async") == "true" {
+		job, err := createImportJob(userID, bankID, file, header, opts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("第 %d 题选项序列化失败", i+1)})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
 
-		questionID := generateUUID()
-		_, err = tx.Exec("INSERT INTO questions (id, bank_id, question, options, answer, explanation) VALUES (?, ?, ?, ?, ?, ?)",
-			questionID, bankID, q.Question, string(optionsJSON), q.Answer, q.Explanation)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("第 %d 题插入失败", i+1)})
+	report := &ImportReport{Rows: []ImportRowResult{}}
+	if err := runImport(bankID, file, header.Filename, header.Size, opts, report, nil, nil); err != nil {
+		if failure, ok := err.(*importError); ok {
+			c.JSON(failure.status, failure.response())
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 提交事务
-	if err = tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+	if opts.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dryRun": true, "report": report})
 		return
 	}
 
@@ -227,8 +288,10 @@ func uploadQuestionBankFile(c *gin.Context) {
 		"id":            bankID,
 		"name":          bankName,
 		"description":   bankDescription,
-		"questionCount": len(questions),
-		"message":       fmt.Sprintf("成功导入 %d 道题目到题库", len(questions)),
+		"questionCount": report.Imported,
+		"message":       importMessage(report),
+		"duplicates":    report.Duplicates,
+		"report":        report,
 	})
 }
 
@@ -236,6 +299,13 @@ func deleteQuestionBank(c *gin.Context) {
 	userID := c.GetString("userID")
 	bankID := c.Param("id")
 
+	// 媒体记录随题库级联删除，存储中的文件在提交后删除
+	mediaKeys, err := bankMediaKeys(bankID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query media files"})
+		return
+	}
+
 	// 开始事务
 	tx, err := db.Begin()
 	if err != nil {
@@ -284,264 +354,581 @@ func deleteQuestionBank(c *gin.Context) {
 		return
 	}
 
+	deleteMediaFiles(mediaKeys)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Question bank deleted successfully"})
 }
 
-// 文件解析函数
-func parseUploadedFile(file multipart.File, header *multipart.FileHeader) ([]Question, error) {
-	ext := strings.ToLower(filepath.Ext(header.Filename))
+// 导入报告中的行状态
+const (
+	importRowAccepted = "accepted"
+	importRowSkipped  = "skipped"
+	importRowError    = "error"
+)
+
+func (r *ImportReport) add(row int, status, question, reason string) {
+	r.Total++
+	switch status {
+	case importRowAccepted:
+		r.Accepted++
+	case importRowSkipped:
+		r.Skipped++
+	case importRowError:
+		r.Errors++
+	}
+	if len(r.Rows) >= maxReportRows {
+		r.Truncated = true
+	} else {
+		r.Rows = append(r.Rows, ImportRowResult{Sheet: r.sheet, Row: row, Status: status, Reason: reason, Question: question})
+	}
+	if r.onRow != nil {
+		r.onRow()
+	}
+}
+
+// 校验解析出的题目并记入报告，返回是否通过
+func (r *ImportReport) check(row int, q *Question) bool {
+	if strings.TrimSpace(q.Question) == "" {
+		r.add(row, importRowSkipped, "", "题目为空")
+		return false
+	}
+	if err := normalizeQuestion(q); err != nil {
+		r.add(row, importRowError, q.Question, err.Error())
+		return false
+	}
+	r.add(row, importRowAccepted, q.Question, "")
+	return true
+}
+
+// 文件解析函数：通过校验的题目逐个交给 emit，逐行结果写入 report，文件本身无法解析时返回错误。
+// emit 返回 *rowError 时该行记为 error 并继续解析，返回其他错误时停止。
+// Excel/CSV 逐行读取，其他格式整体解析后再逐题交给 emit。
+// opts.Mapping 为用户选择的导入配置，为 nil 时按默认表头识别，只对 Excel/CSV 生效；opts.Sheets 只对 Excel 生效
+func parseUploadedFile(file multipart.File, fileName string, size int64, opts importOptions, report *ImportReport, emit func(Question) error) error {
+	ext := strings.ToLower(filepath.Ext(fileName))
 
+	var questions []Question
+	var parsed *ImportReport
+	var err error
 	switch ext {
-	case ".json":
-		return parseJSONFile(file)
 	case ".xlsx", ".xls":
-		return parseExcelFile(file)
+		return parseExcelFile(file, size, opts.Mapping, opts.Sheets, report, emit)
 	case ".csv":
-		return parseCSVFile(file)
+		return parseCSVFile(file, opts.Mapping, report, emit)
+	case ".json":
+		questions, parsed, err = parseJSONFile(file)
+	case ".xml":
+		questions, parsed, err = parseMoodleXMLFile(file)
+	case ".gift", ".txt":
+		questions, parsed, err = parseGIFTFile(file)
 	default:
-		return nil, fmt.Errorf("不支持的文件格式: %s", ext)
+		return fmt.Errorf("不支持的文件格式: %s", ext)
+	}
+	if err != nil {
+		return err
+	}
+
+	parsed.onRow = report.onRow
+	*report = *parsed
+
+	// 整体解析的格式中第 i 道题目对应报告中第 i 个 accepted 行
+	var acceptedRows []int
+	for i, row := range report.Rows {
+		if row.Status == importRowAccepted {
+			acceptedRows = append(acceptedRows, i)
+		}
+	}
+	for i, q := range questions {
+		err := emit(q)
+		var rowErr *rowError
+		if !errors.As(err, &rowErr) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		report.Accepted--
+		report.Errors++
+		if i < len(acceptedRows) {
+			row := &report.Rows[acceptedRows[i]]
+			row.Status, row.Reason = importRowError, rowErr.Error()
+		}
 	}
+	return nil
 }
 
-func parseJSONFile(file multipart.File) ([]Question, error) {
+// JSON 文件中报告的行号为题目序号（从 1 开始）
+func parseJSONFile(file multipart.File) ([]Question, *ImportReport, error) {
 	var data struct {
 		Questions []Question `json:"questions"`
 	}
 
 	decoder := json.NewDecoder(file)
 	if err := decoder.Decode(&data); err != nil {
-		return nil, fmt.Errorf("JSON文件解析失败: %v", err)
+		return nil, nil, fmt.Errorf("JSON文件解析失败: %v", err)
 	}
 
 	if len(data.Questions) == 0 {
-		return nil, fmt.Errorf("未找到有效的题目数据")
+		return nil, nil, fmt.Errorf("未找到有效的题目数据")
+	}
+
+	report := &ImportReport{Rows: []ImportRowResult{}}
+	var questions []Question
+	for i, q := range data.Questions {
+		if report.check(i+1, &q) {
+			questions = append(questions, q)
+		}
 	}
 
-	return data.Questions, nil
+	return questions, report, nil
 }
 
-func parseExcelFile(file multipart.File) ([]Question, error) {
-	// 创建临时文件来保存上传的Excel文件
-	tempFile, err := os.CreateTemp("", "upload_*.xlsx")
+// Excel 中的一个工作表，forEachRow 按顺序逐行读取单元格，fn 返回错误时停止
+type worksheet struct {
+	name       string
+	forEachRow func(fn func(cells []string) error) error
+}
+
+func parseExcelFile(file multipart.File, size int64, mapping *ImportMapping, sheets []string, report *ImportReport, emit func(Question) error) error {
+	workbook, closeWorkbook, err := openExcelSheets(file, size)
 	if err != nil {
-		return nil, fmt.Errorf("创建临时文件失败: %v", err)
+		return err
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
+	defer closeWorkbook()
 
-	// 将上传的文件内容复制到临时文件
-	_, err = io.Copy(tempFile, file)
+	selected, err := selectWorksheets(workbook, sheets)
 	if err != nil {
-		return nil, fmt.Errorf("保存临时文件失败: %v", err)
+		return err
 	}
 
-	// 打开Excel文件
-	xlFile, err := xlsx.OpenFile(tempFile.Name())
+	// 工作簿只有一个工作表时（通常是默认的 Sheet1）不把工作表名称当作章节
+	return parseWorksheets(selected, mapping, len(workbook) > 1, report, emit)
+}
+
+// 打开工作簿，返回全部工作表和释放临时数据的函数
+func openExcelSheets(file multipart.File, size int64) ([]worksheet, func(), error) {
+	// 旧版 .xls（BIFF8）按文件头识别，扩展名与实际格式不符时也能正确读取
+	isXLS, err := isOLE2File(file)
 	if err != nil {
-		return nil, fmt.Errorf("Excel文件打开失败: %v", err)
+		return nil, nil, fmt.Errorf("读取Excel文件失败: %v", err)
+	}
+	if isXLS {
+		sheets, err := readXLSSheets(file)
+		return sheets, func() {}, err
+	}
+
+	// 单元格存放在磁盘上的临时目录中，避免大文件占用过多内存
+	xlFile, err := xlsx.OpenReaderAt(file, size, xlsx.UseDiskVCellStore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Excel文件打开失败: %v", err)
+	}
+	closeWorkbook := func() {
+		for _, sheet := range xlFile.Sheets {
+			sheet.Close()
+		}
 	}
 
 	if len(xlFile.Sheets) == 0 {
-		return nil, fmt.Errorf("Excel文件中没有工作表")
+		closeWorkbook()
+		return nil, nil, fmt.Errorf("Excel文件中没有工作表")
+	}
+
+	var sheets []worksheet
+	for _, sheet := range xlFile.Sheets {
+		sheet := sheet
+		sheets = append(sheets, worksheet{name: sheet.Name, forEachRow: func(fn func([]string) error) error {
+			// 遍历工作表的行
+			return sheet.ForEachRow(func(r *xlsx.Row) error {
+				var rowData []string
+				err := r.ForEachCell(func(c *xlsx.Cell) error {
+					rowData = append(rowData, c.String())
+					return nil
+				})
+				if err != nil {
+					return fmt.Errorf("读取Excel数据失败: %v", err)
+				}
+				return fn(rowData)
+			})
+		}})
+	}
+
+	return sheets, closeWorkbook, nil
+}
+
+// 按名称选出要导入的工作表（保持工作簿中的顺序），names 为空时返回全部
+func selectWorksheets(workbook []worksheet, names []string) ([]worksheet, error) {
+	if len(names) == 0 {
+		return workbook, nil
 	}
 
-	sheet := xlFile.Sheets[0]
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
 
-	// 将sheet转换为二维字符串数组
-	var rows [][]string
+	var selected []worksheet
+	for _, sheet := range workbook {
+		if wanted[strings.TrimSpace(sheet.name)] {
+			selected = append(selected, sheet)
+			delete(wanted, strings.TrimSpace(sheet.name))
+		}
+	}
+	for _, name := range names {
+		if wanted[name] {
+			return nil, fmt.Errorf("工作表不存在: %s", name)
+		}
+	}
+	return selected, nil
+}
 
-	// 遍历工作表的行
-	err = sheet.ForEachRow(func(r *xlsx.Row) error {
-		var rowData []string
-		err := r.ForEachCell(func(c *xlsx.Cell) error {
-			value := c.String()
-			rowData = append(rowData, value)
-			return nil
-		})
-		if err != nil {
-			return err
+// 逐个解析工作表。sheetChapters 为 true 时工作表名称作为题目的章节（表中有章节列时以章节列为准），
+// 报告中记录各行所在的工作表。
+// 只导入一个工作表时表头不完整直接返回错误；导入多个工作表时该工作表记为跳过，空工作表（如说明页）直接忽略
+func parseWorksheets(sheets []worksheet, mapping *ImportMapping, sheetChapters bool, report *ImportReport, emit func(Question) error) error {
+	for _, sheet := range sheets {
+		parser := &rowParser{mapping: mapping, report: report, emit: emit}
+		if sheetChapters {
+			parser.chapter = strings.TrimSpace(sheet.name)
+			report.sheet = sheet.name
 		}
-		rows = append(rows, rowData)
-		return nil
-	})
 
-	if err != nil {
-		return nil, fmt.Errorf("读取Excel数据失败: %v", err)
+		err := sheet.forEachRow(parser.parseRow)
+		if err != nil && parser.headerErr == nil {
+			return err
+		}
+		if len(sheets) == 1 {
+			if parser.rows < 2 {
+				return fmt.Errorf("Excel数据不足")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			report.add(1, importRowSkipped, "", err.Error())
+		}
 	}
 
-	return parseExcelData(rows)
+	if report.Total == 0 {
+		return fmt.Errorf("Excel数据不足")
+	}
+	return nil
 }
 
-func parseCSVFile(file multipart.File) ([]Question, error) {
+// CSV 逐条记录读取，行号为记录序号（表头为第 1 行）
+func parseCSVFile(file multipart.File, mapping *ImportMapping, report *ImportReport, emit func(Question) error) error {
 	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("CSV文件读取失败: %v", err)
+	reader.Comma = csvDelimiter(mapping)
+
+	parser := &rowParser{mapping: mapping, report: report, emit: emit}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("CSV文件读取失败: %v", err)
+		}
+
+		// 去掉 Excel 保存 UTF-8 CSV 时写入的 BOM
+		if parser.rows == 0 && len(record) > 0 {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+		}
+		if err := parser.parseRow(record); err != nil {
+			return err
+		}
 	}
 
-	if len(records) < 2 {
-		return nil, fmt.Errorf("CSV文件数据不足")
+	if parser.rows < 2 {
+		return fmt.Errorf("CSV文件数据不足")
 	}
+	return nil
+}
 
-	return parseCSVData(records)
+// 表格中各列的位置及单元格内的分隔符，列不存在时为 -1
+type rowLayout struct {
+	questionCol          int
+	typeCol              int
+	optionCols           []int
+	optionsCol           int
+	answerCol            int
+	explanationCol       int
+	chapterCol           int
+	formatCol            int
+	mediaCol             int
+	optionDelimiter      string
+	answerDelimiter      string
+	blankDelimiter       string
+	alternativeDelimiter string
 }
 
-func parseExcelData(rows [][]string) ([]Question, error) {
-	if len(rows) < 2 {
-		return nil, fmt.Errorf("Excel数据不足")
+// 所有列均未定位的布局。默认分隔符：选项和可接受答案用 "|"，填空题各空用 ";"（blankDelimiter 为空时兼容全角分号）
+func newRowLayout() rowLayout {
+	return rowLayout{
+		questionCol:          -1,
+		typeCol:              -1,
+		optionsCol:           -1,
+		answerCol:            -1,
+		explanationCol:       -1,
+		chapterCol:           -1,
+		formatCol:            -1,
+		mediaCol:             -1,
+		optionDelimiter:      "|",
+		alternativeDelimiter: "|",
 	}
+}
 
-	// 获取表头
+// 按内置的中英文列名识别表头
+func defaultRowLayout(header []string) (rowLayout, error) {
 	headers := make(map[string]int)
-	for i, header := range rows[0] {
-		headers[strings.TrimSpace(header)] = i
+	for i, name := range header {
+		headers[strings.TrimSpace(name)] = i
 	}
 
-	// 查找列索引
-	questionCol := findColumnIndex(headers, []string{"题目", "question", "Question", "问题"})
-	optionACol := findColumnIndex(headers, []string{"选项A", "A", "optionA", "选择A"})
-	optionBCol := findColumnIndex(headers, []string{"选项B", "B", "optionB", "选择B"})
-	optionCCol := findColumnIndex(headers, []string{"选项C", "C", "optionC", "选择C"})
-	optionDCol := findColumnIndex(headers, []string{"选项D", "D", "optionD", "选择D"})
-	answerCol := findColumnIndex(headers, []string{"正确答案", "answer", "Answer", "答案"})
-	explanationCol := findColumnIndex(headers, []string{"解析", "explanation", "Explanation", "说明"})
+	layout := newRowLayout()
+	layout.questionCol = findColumnIndex(headers, []string{"题目", "question", "Question", "问题"})
+	layout.typeCol = findColumnIndex(headers, []string{"题型", "type", "Type", "类型"})
+	layout.optionCols = findOptionColumns(header)
+	layout.answerCol = findColumnIndex(headers, []string{"正确答案", "answer", "Answer", "答案"})
+	layout.explanationCol = findColumnIndex(headers, []string{"解析", "explanation", "Explanation", "说明"})
+	layout.chapterCol = findColumnIndex(headers, []string{"章节", "chapter", "Chapter", "章"})
+	layout.formatCol = findColumnIndex(headers, []string{"格式", "format", "Format", "内容格式"})
+	layout.mediaCol = findColumnIndex(headers, []string{"媒体", "media", "Media"})
 
-	if questionCol == -1 || optionACol == -1 || optionBCol == -1 || answerCol == -1 {
-		return nil, fmt.Errorf("缺少必要的列：题目、选项A、选项B、正确答案")
+	// 没有题型列时所有题目都是选择题，必须提供选项A、选项B
+	if layout.questionCol == -1 || layout.answerCol == -1 || (layout.typeCol == -1 && len(layout.optionCols) < 2) {
+		return layout, fmt.Errorf("缺少必要的列：题目、选项A、选项B、正确答案")
 	}
+	return layout, nil
+}
 
-	var questions []Question
-	for i := 1; i < len(rows); i++ {
-		row := rows[i]
-
-		question := getExcelValue(row, questionCol)
-		if question == "" {
-			continue
-		}
+// 逐行解析表格数据（第一行为表头），Excel 和 CSV 共用。
+// 数据行逐行校验并记入报告，行号与表格中的行号一致，通过校验的题目交给 emit；章节列为空的行使用 chapter 作为章节
+type rowParser struct {
+	mapping *ImportMapping
+	chapter string
+	report  *ImportReport
+	emit    func(Question) error
+
+	layout    rowLayout
+	rows      int   // 已读取的行数（含表头）
+	headerErr error // 表头不完整时的错误，读到数据行时返回以停止解析
+}
 
-		optionA := getExcelValue(row, optionACol)
-		optionB := getExcelValue(row, optionBCol)
-		if optionA == "" || optionB == "" {
-			continue
+func (p *rowParser) parseRow(row []string) error {
+	p.rows++
+	line := p.rows
+	if line == 1 {
+		if p.mapping != nil {
+			p.layout, p.headerErr = p.mapping.layout(row)
+		} else {
+			p.layout, p.headerErr = defaultRowLayout(row)
 		}
+		return nil
+	}
+	if p.headerErr != nil {
+		return p.headerErr
+	}
 
-		options := []string{optionA, optionB}
-
-		// 添加可选的选项C和D
-		if optionCCol != -1 {
-			if optionC := getExcelValue(row, optionCCol); optionC != "" {
-				options = append(options, optionC)
-			}
-		}
-		if optionDCol != -1 {
-			if optionD := getExcelValue(row, optionDCol); optionD != "" {
-				options = append(options, optionD)
-			}
-		}
+	// 完全空白的行不计入报告
+	if isBlankRow(row) {
+		return nil
+	}
 
-		answerStr := getExcelValue(row, answerCol)
-		answer, err := parseAnswer(answerStr, len(options))
-		if err != nil {
-			return nil, fmt.Errorf("第 %d 行答案格式错误: %v", i+1, err)
-		}
+	layout := p.layout
+	question := getCellValue(row, layout.questionCol)
+	if question == "" {
+		p.report.add(line, importRowSkipped, "", "题目为空")
+		return nil
+	}
 
-		explanation := ""
-		if explanationCol != -1 {
-			explanation = getExcelValue(row, explanationCol)
-		}
+	questionType, err := parseQuestionType(getCellValue(row, layout.typeCol))
+	if err != nil {
+		p.report.add(line, importRowError, question, err.Error())
+		return nil
+	}
 
-		questions = append(questions, Question{
-			Question:    question,
-			Options:     options,
-			Answer:      answer,
-			Explanation: explanation,
-		})
+	options, err := getOptionValues(row, layout)
+	if err != nil {
+		p.report.add(line, importRowError, question, err.Error())
+		return nil
 	}
 
-	if len(questions) == 0 {
-		return nil, fmt.Errorf("未找到有效的题目数据")
+	// 选择题选项不足时跳过该行
+	if (questionType == "" || questionType == questionTypeSingle || questionType == questionTypeMultiple) && len(options) < 2 {
+		p.report.add(line, importRowSkipped, question, "选项不足两个")
+		return nil
 	}
 
-	return questions, nil
-}
+	q := Question{
+		Type:        questionType,
+		Question:    question,
+		Options:     options,
+		Explanation: getCellValue(row, layout.explanationCol),
+		Chapter:     getCellValue(row, layout.chapterCol),
+		Format:      getCellValue(row, layout.formatCol),
+	}
+	if q.Chapter == "" {
+		q.Chapter = p.chapter
+	}
+	// 媒体列为导出时写出的 JSON 数组，引用的文件必须属于导入的题库
+	if media := getCellValue(row, layout.mediaCol); media != "" {
+		if err := json.Unmarshal([]byte(media), &q.Media); err != nil {
+			p.report.add(line, importRowError, question, fmt.Sprintf("媒体格式错误: %v", err))
+			return nil
+		}
+	}
+	if err := parseRowAnswer(&q, getCellValue(row, layout.answerCol), layout); err != nil {
+		p.report.add(line, importRowError, question, fmt.Sprintf("答案格式错误: %v", err))
+		return nil
+	}
+	if err := normalizeQuestion(&q); err != nil {
+		p.report.add(line, importRowError, question, err.Error())
+		return nil
+	}
 
-func parseCSVData(records [][]string) ([]Question, error) {
-	if len(records) < 2 {
-		return nil, fmt.Errorf("CSV数据不足")
+	if err := p.emit(q); err != nil {
+		var rowErr *rowError
+		if !errors.As(err, &rowErr) {
+			return err
+		}
+		p.report.add(line, importRowError, question, rowErr.Error())
+		return nil
 	}
+	p.report.add(line, importRowAccepted, question, "")
+	return nil
+}
 
-	// 获取表头
-	headers := make(map[string]int)
-	for i, header := range records[0] {
-		headers[strings.TrimSpace(header)] = i
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
 	}
+	return true
+}
 
-	// 查找列索引
-	questionCol := findColumnIndex(headers, []string{"题目", "question", "Question", "问题"})
-	optionACol := findColumnIndex(headers, []string{"选项A", "A", "optionA", "选择A"})
-	optionBCol := findColumnIndex(headers, []string{"选项B", "B", "optionB", "选择B"})
-	optionCCol := findColumnIndex(headers, []string{"选项C", "C", "optionC", "选择C"})
-	optionDCol := findColumnIndex(headers, []string{"选项D", "D", "optionD", "选择D"})
-	answerCol := findColumnIndex(headers, []string{"正确答案", "answer", "Answer", "答案"})
-	explanationCol := findColumnIndex(headers, []string{"解析", "explanation", "Explanation", "说明"})
+// 题型列的取值，留空表示按答案推断为单选或多选
+var questionTypeAliases = map[string]string{
+	"单选": questionTypeSingle, "单选题": questionTypeSingle, "single": questionTypeSingle, questionTypeSingle: questionTypeSingle,
+	"多选": questionTypeMultiple, "多选题": questionTypeMultiple, "multiple": questionTypeMultiple, questionTypeMultiple: questionTypeMultiple,
+	"判断": questionTypeTrueFalse, "判断题": questionTypeTrueFalse, "truefalse": questionTypeTrueFalse, "tf": questionTypeTrueFalse, questionTypeTrueFalse: questionTypeTrueFalse,
+	"填空": questionTypeFillBlank, "填空题": questionTypeFillBlank, "blank": questionTypeFillBlank, questionTypeFillBlank: questionTypeFillBlank,
+	"简答": questionTypeShortAnswer, "简答题": questionTypeShortAnswer, "short": questionTypeShortAnswer, questionTypeShortAnswer: questionTypeShortAnswer,
+}
 
-	if questionCol == -1 || optionACol == -1 || optionBCol == -1 || answerCol == -1 {
-		return nil, fmt.Errorf("缺少必要的列：题目、选项A、选项B、正确答案")
+func parseQuestionType(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", nil
 	}
+	if questionType, ok := questionTypeAliases[value]; ok {
+		return questionType, nil
+	}
+	return "", fmt.Errorf("无法识别的题型: %s", value)
+}
 
-	var questions []Question
-	for i := 1; i < len(records); i++ {
-		record := records[i]
-
-		question := getCSVValue(record, questionCol)
-		if question == "" {
-			continue
+// 按题型解析答案列：
+// 选择题为选项字母或序号；判断题为 对/错、正确/错误、T/F 等；
+// 填空题各空之间用 ";" 分隔，同一空的多个可接受答案用 "|" 分隔；简答题多个可接受答案用 "|" 分隔。
+// 分隔符可由导入配置修改，答案文本中的分隔符和 "\" 前加 "\" 转义
+func parseRowAnswer(q *Question, answerStr string, layout rowLayout) error {
+	switch q.Type {
+	case questionTypeTrueFalse:
+		if len(q.Options) == 0 {
+			q.Options = trueFalseOptions
 		}
-
-		optionA := getCSVValue(record, optionACol)
-		optionB := getCSVValue(record, optionBCol)
-		if optionA == "" || optionB == "" {
-			continue
+		answer, err := parseTrueFalse(answerStr)
+		if err != nil {
+			return err
 		}
-
-		options := []string{optionA, optionB}
-
-		// 添加可选的选项C和D
-		if optionCCol != -1 {
-			if optionC := getCSVValue(record, optionCCol); optionC != "" {
-				options = append(options, optionC)
-			}
+		q.Answer = answer
+	case questionTypeFillBlank:
+		if layout.blankDelimiter == "" {
+			q.Blanks = splitAnswerCell(answerStr, []string{";", "；"}, layout.alternativeDelimiter, true)
+		} else {
+			q.Blanks = splitAnswerCell(answerStr, []string{layout.blankDelimiter}, layout.alternativeDelimiter, false)
 		}
-		if optionDCol != -1 {
-			if optionD := getCSVValue(record, optionDCol); optionD != "" {
-				options = append(options, optionD)
-			}
+	case questionTypeShortAnswer:
+		q.AcceptedAnswers = splitAnswerCell(answerStr, nil, layout.alternativeDelimiter, false)[0]
+	default:
+		if layout.answerDelimiter != "" {
+			answerStr = strings.ReplaceAll(answerStr, layout.answerDelimiter, ",")
 		}
-
-		answerStr := getCSVValue(record, answerCol)
-		answer, err := parseAnswer(answerStr, len(options))
+		answers, err := parseAnswers(answerStr, len(q.Options))
 		if err != nil {
-			return nil, fmt.Errorf("第 %d 行答案格式错误: %v", i+1, err)
+			return err
 		}
-
-		explanation := ""
-		if explanationCol != -1 {
-			explanation = getCSVValue(record, explanationCol)
+		q.Answer = answers[0]
+		if len(answers) > 1 || q.Type == questionTypeMultiple {
+			q.Answers = answers
 		}
+	}
+	return nil
+}
 
-		questions = append(questions, Question{
-			Question:    question,
-			Options:     options,
-			Answer:      answer,
-			Explanation: explanation,
-		})
+// 拆分填空题或简答题的答案列：先按 blankSeps 拆分各空，再按 altSep 拆分同一空的可接受答案。
+// "\" 转义其后的分隔符或 "\"，其他位置的 "\" 保持原样；dropEmpty 时忽略空白的空
+func splitAnswerCell(cell string, blankSeps []string, altSep string, dropEmpty bool) [][]string {
+	escapable := append([]string{`\`, altSep}, blankSeps...)
+	match := func(rest string, candidates []string) string {
+		for _, candidate := range candidates {
+			if candidate != "" && strings.HasPrefix(rest, candidate) {
+				return candidate
+			}
+		}
+		return ""
 	}
 
-	if len(questions) == 0 {
-		return nil, fmt.Errorf("未找到有效的题目数据")
+	var blanks [][]string
+	var current []string
+	var b strings.Builder
+	raw := 0 // 当前空中的字符数，含分隔符
+	for i := 0; i < len(cell); {
+		if cell[i] == '\\' {
+			if e := match(cell[i+1:], escapable); e != "" {
+				b.WriteString(e)
+				i += 1 + len(e)
+				raw++
+				continue
+			}
+		}
+		if sep := match(cell[i:], blankSeps); sep != "" {
+			current = append(current, b.String())
+			if !dropEmpty || raw > 0 {
+				blanks = append(blanks, current)
+			}
+			current, raw = nil, 0
+			b.Reset()
+			i += len(sep)
+			continue
+		}
+		if sep := match(cell[i:], []string{altSep}); sep != "" {
+			current = append(current, b.String())
+			b.Reset()
+			i += len(sep)
+			raw++
+			continue
+		}
+		b.WriteByte(cell[i])
+		i++
+		raw++
+	}
+	current = append(current, b.String())
+	if !dropEmpty || raw > 0 {
+		blanks = append(blanks, current)
 	}
+	return blanks
+}
 
-	return questions, nil
+func parseTrueFalse(answerStr string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(answerStr)) {
+	case "对", "正确", "是", "√", "t", "true", "y", "yes", "a", "1":
+		return 0, nil
+	case "错", "错误", "否", "×", "f", "false", "n", "no", "b", "2":
+		return 1, nil
+	}
+	return -1, fmt.Errorf("无效的判断题答案: %s", answerStr)
 }
 
 // 获取题库题目
@@ -557,34 +944,76 @@ func getBankQuestions(c *gin.Context) {
 		return
 	}
 
-	rows, err := db.Query("SELECT id, question, options, answer, explanation FROM questions WHERE bank_id = ?", bankID)
+	// chapter 可重复，只返回这些章节的题目
+	chapterFilter, chapterArgs := chapterClause(c.QueryArray("chapter"))
+	questions, err := queryQuestions("WHERE q.bank_id = ?"+chapterFilter, append([]interface{}{bankID}, chapterArgs...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库查询失败"})
+		return
+	}
+
+	includeAnswers, err := includesAnswerKey(c.Query("mode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !includeAnswers {
+		c.JSON(http.StatusOK, toExamQuestions(questions))
+		return
+	}
+
+	renderQuestions(questions)
+	c.JSON(http.StatusOK, questions)
+}
+
+// 获取题库的章节及各章节题目数，未分章节的题目章节为空字符串
+func getBankChapters(c *gin.Context) {
+	bankID := c.Param("id")
+	userID := c.GetString("userID")
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM question_banks WHERE id = ? AND user_id = ?)", bankID, userID).Scan(&exists)
+	if err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "题库不存在或无权访问"})
+		return
+	}
+
+	rows, err := db.Query("SELECT chapter, COUNT(*) FROM questions WHERE bank_id = ? GROUP BY chapter ORDER BY chapter", bankID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库查询失败"})
 		return
 	}
 	defer rows.Close()
 
-	var questions []Question
+	type chapterCount struct {
+		Chapter       string `json:"chapter"`
+		QuestionCount int    `json:"question_count"`
+	}
+	chapters := []chapterCount{}
 	for rows.Next() {
-		var q Question
-		var optionsJSON string
-		err := rows.Scan(&q.ID, &q.Question, &optionsJSON, &q.Answer, &q.Explanation)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "数据解析失败"})
+		var chapter chapterCount
+		if err := rows.Scan(&chapter.Chapter, &chapter.QuestionCount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库查询失败"})
 			return
 		}
+		chapters = append(chapters, chapter)
+	}
 
-		// 解析选项JSON
-		err = json.Unmarshal([]byte(optionsJSON), &q.Options)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "选项解析失败"})
-			return
-		}
+	c.JSON(http.StatusOK, chapters)
+}
 
-		questions = append(questions, q)
+// 按章节过滤题目的查询条件，chapters 为空时不过滤
+func chapterClause(chapters []string) (string, []interface{}) {
+	if len(chapters) == 0 {
+		return "", nil
 	}
-
-	c.JSON(http.StatusOK, questions)
+	placeholders := make([]string, len(chapters))
+	args := make([]interface{}, len(chapters))
+	for i, chapter := range chapters {
+		placeholders[i] = "?"
+		args[i] = strings.TrimSpace(chapter)
+	}
+	return " AND q.chapter IN (" + strings.Join(placeholders, ", ") + ")", args
 }
 
 // 添加题目
@@ -592,11 +1021,18 @@ func createQuestion(c *gin.Context) {
 	userID := c.GetString("userID")
 
 	var req struct {
-		BankID      string   `json:"bank_id" binding:"required"`
-		Question    string   `json:"question" binding:"required"`
-		Options     []string `json:"options" binding:"required"`
-		answer      int      `json:"answer" binding:"required"`
-		Explanation string   `json:"explanation"`
+		BankID          string     `json:"bank_id" binding:"required"`
+		Type            string     `json:"type"`
+		Question        string     `json:"question" binding:"required"`
+		Options         []string   `json:"options"`
+		Answer          int        `json:"answer"`
+		Answers         []int      `json:"answers"`
+		Blanks          [][]string `json:"blanks"`
+		AcceptedAnswers []string   `json:"accepted_answers"`
+		Explanation     string     `json:"explanation"`
+		Chapter         string     `json:"chapter"`
+		Media           []MediaRef `json:"media"`
+		Format          string     `json:"format"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -612,23 +1048,32 @@ func createQuestion(c *gin.Context) {
 		return
 	}
 
+	q := Question{
+		Type:            req.Type,
+		Question:        req.Question,
+		Options:         req.Options,
+		Answer:          req.Answer,
+		Answers:         req.Answers,
+		Blanks:          req.Blanks,
+		AcceptedAnswers: req.AcceptedAnswers,
+		Explanation:     req.Explanation,
+		Chapter:         req.Chapter,
+		Media:           req.Media,
+		Format:          req.Format,
+	}
+
 	// 验证答案范围
-	if req.answer < 0 || req.answer >= len(req.Options) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "答案索引超出选项范围"})
+	if err := normalizeQuestion(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// 序列化选项
-	optionsJSON, err := json.Marshal(req.Options)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "选项序列化失败"})
+	if err := attachMediaRefs(req.BankID, q.Media); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// 插入题目
-	questionID := generateUUID()
-	_, err = db.Exec("INSERT INTO questions (id, bank_id, question, options, answer, explanation) VALUES (?, ?, ?, ?, ?, ?)",
-		questionID, req.BankID, req.Question, string(optionsJSON), req.answer, req.Explanation)
+	questionID, err := insertQuestion(db, req.BankID, q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建题目失败"})
 		return
@@ -646,10 +1091,17 @@ func updateQuestion(c *gin.Context) {
 	questionID := c.Param("id")
 
 	var req struct {
-		Question    string   `json:"question" binding:"required"`
-		Options     []string `json:"options" binding:"required"`
-		Answer      int      `json:"answer" binding:"required"`
-		Explanation string   `json:"explanation"`
+		Type            string      `json:"type"`
+		Question        string      `json:"question" binding:"required"`
+		Options         []string    `json:"options"`
+		Answer          int         `json:"answer"`
+		Answers         []int       `json:"answers"`
+		Blanks          [][]string  `json:"blanks"`
+		AcceptedAnswers []string    `json:"accepted_answers"`
+		Explanation     string      `json:"explanation"`
+		Chapter         *string     `json:"chapter"` // 未提供时保留原章节
+		Media           *[]MediaRef `json:"media"`   // 未提供时保留原媒体引用
+		Format          *string     `json:"format"`  // 未提供时保留原内容格式
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -657,32 +1109,53 @@ func updateQuestion(c *gin.Context) {
 		return
 	}
 
-	// 验证答案范围
-	if req.Answer < 0 || req.Answer >= len(req.Options) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "答案索引超出选项范围"})
-		return
+	q := Question{
+		Type:            req.Type,
+		Question:        req.Question,
+		Options:         req.Options,
+		Answer:          req.Answer,
+		Answers:         req.Answers,
+		Blanks:          req.Blanks,
+		AcceptedAnswers: req.AcceptedAnswers,
+		Explanation:     req.Explanation,
 	}
 
 	// 检查题目是否属于当前用户的题库
-	var bankID string
-	err := db.QueryRow("SELECT q.bank_id FROM questions q JOIN question_banks qb ON q.bank_id = qb.id WHERE q.id = ? AND qb.user_id = ?",
-		questionID, userID).Scan(&bankID)
+	var bankID, chapter, format string
+	var mediaJSON sql.NullString
+	err := db.QueryRow("SELECT q.bank_id, q.chapter, q.media, q.format FROM questions q JOIN question_banks qb ON q.bank_id = qb.id WHERE q.id = ? AND qb.user_id = ?",
+		questionID, userID).Scan(&bankID, &chapter, &mediaJSON, &format)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "题目不存在或无权修改"})
 		return
 	}
+	if req.Chapter != nil {
+		chapter = strings.TrimSpace(*req.Chapter)
+	}
+	q.Chapter = chapter
+	if req.Format != nil {
+		format = *req.Format
+	}
+	q.Format = format
+	if req.Media != nil {
+		q.Media = *req.Media
+	} else if err := unmarshalMediaRefs(&q, mediaJSON); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	// 序列化选项
-	optionsJSON, err := json.Marshal(req.Options)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "选项序列化失败"})
+	// 验证答案范围和媒体引用
+	if err := normalizeQuestion(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := attachMediaRefs(bankID, q.Media); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// 更新题目
-	_, err = db.Exec("UPDATE questions SET question = ?, options = ?, answer = ?, explanation = ? WHERE id = ?",
-		req.Question, string(optionsJSON), req.Answer, req.Explanation, questionID)
-	if err != nil {
+	if err := updateQuestionRow(db, questionID, q); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新题目失败"})
 		return
 	}
@@ -728,33 +1201,15 @@ func getQuestions(c *gin.Context) {
 		return
 	}
 
-	rows, err := db.Query("SELECT id, question, options, answer, explanation FROM questions WHERE bank_id = ?", bankID)
+	// chapter 可重复，只返回这些章节的题目
+	chapterFilter, chapterArgs := chapterClause(c.QueryArray("chapter"))
+	questions, err := queryQuestions("WHERE q.bank_id = ?"+chapterFilter, append([]interface{}{bankID}, chapterArgs...)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据库查询失败"})
 		return
 	}
-	defer rows.Close()
-
-	var questions []Question
-	for rows.Next() {
-		var q Question
-		var optionsJSON string
-		err := rows.Scan(&q.ID, &q.Question, &optionsJSON, &q.Answer, &q.Explanation)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "数据解析失败"})
-			return
-		}
-
-		// 解析选项JSON
-		err = json.Unmarshal([]byte(optionsJSON), &q.Options)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "选项解析失败"})
-			return
-		}
-
-		questions = append(questions, q)
-	}
 
+	renderQuestions(questions)
 	c.JSON(http.StatusOK, questions)
 }
 
@@ -792,6 +1247,150 @@ func clearWrongQuestions(c *gin.Context) {
 }
 
 // 辅助函数
+// 查询题目列表，clause 为跟在 "FROM questions q" 之后的 JOIN/WHERE 子句，不能包含 ORDER BY 或 LIMIT。
+// 结果按创建顺序（seq，见 idSequence）排列，同一题库内可以使用 (bank_id, seq) 索引
+func queryQuestions(clause string, args ...interface{}) ([]Question, error) {
+	rows, err := db.Query("SELECT q.id, q.bank_id, q.type, q.question, q.options, q.answer, q.answers, q.accepted, q.explanation, q.chapter, q.media, q.format FROM questions q "+
+		clause+" ORDER BY q.seq, q.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []Question
+	for rows.Next() {
+		var q Question
+		var optionsJSON string
+		var answersJSON, acceptedJSON, mediaJSON sql.NullString
+		if err := rows.Scan(&q.ID, &q.BankID, &q.Type, &q.Question, &optionsJSON, &q.Answer, &answersJSON, &acceptedJSON, &q.Explanation, &q.Chapter, &mediaJSON, &q.Format); err != nil {
+			return nil, err
+		}
+
+		if err := unmarshalQuestionJSON(&q, optionsJSON, answersJSON, acceptedJSON); err != nil {
+			return nil, err
+		}
+		if err := unmarshalMediaRefs(&q, mediaJSON); err != nil {
+			return nil, err
+		}
+
+		questions = append(questions, q)
+	}
+
+	return questions, rows.Err()
+}
+
+// *sql.DB 和 *sql.Tx 都满足该接口
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// 插入一道题目并返回题目ID，调用方需先用 normalizeQuestion 校验
+func insertQuestion(exec execer, bankID string, q Question) (string, error) {
+	questionID := generateUUID()
+	return questionID, insertQuestions(exec, bankID, []string{questionID}, []Question{q})
+}
+
+// 用一条多行 INSERT 写入一批题目，ids 与 questions 一一对应
+func insertQuestions(exec execer, bankID string, ids []string, questions []Question) error {
+	if len(questions) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(questions))
+	args := make([]interface{}, 0, len(questions)*13)
+	for i, q := range questions {
+		optionsJSON, answersJSON, acceptedJSON, err := marshalQuestionJSON(q)
+		if err != nil {
+			return err
+		}
+		mediaJSON, err := marshalMediaRefs(q.Media)
+		if err != nil {
+			return err
+		}
+		placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		args = append(args, ids[i], bankID, q.Type, q.Question, optionsJSON, q.Answer, answersJSON, acceptedJSON, q.Explanation, q.Chapter, mediaJSON, q.Format, idSequence(ids[i]))
+	}
+
+	_, err := exec.Exec("INSERT INTO questions (id, bank_id, type, question, options, answer, answers, accepted, explanation, chapter, media, format, seq) VALUES "+
+		strings.Join(placeholders, ", "), args...)
+	return err
+}
+
+func updateQuestionRow(exec execer, questionID string, q Question) error {
+	optionsJSON, answersJSON, acceptedJSON, err := marshalQuestionJSON(q)
+	if err != nil {
+		return err
+	}
+	mediaJSON, err := marshalMediaRefs(q.Media)
+	if err != nil {
+		return err
+	}
+
+	_, err = exec.Exec("UPDATE questions SET type = ?, question = ?, options = ?, answer = ?, answers = ?, accepted = ?, explanation = ?, chapter = ?, media = ?, format = ? WHERE id = ?",
+		q.Type, q.Question, optionsJSON, q.Answer, answersJSON, acceptedJSON, q.Explanation, q.Chapter, mediaJSON, q.Format, questionID)
+	return err
+}
+
+// 序列化选项、多选答案和文本题的参考答案，不适用的字段存为 NULL
+func marshalQuestionJSON(q Question) (string, interface{}, interface{}, error) {
+	optionsJSON, err := json.Marshal(q.Options)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var answersJSON, acceptedJSON interface{}
+	if len(q.Answers) > 0 {
+		data, err := json.Marshal(q.Answers)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		answersJSON = string(data)
+	}
+
+	var accepted interface{}
+	switch q.Type {
+	case questionTypeFillBlank:
+		accepted = q.Blanks
+	case questionTypeShortAnswer:
+		accepted = q.AcceptedAnswers
+	}
+	if accepted != nil {
+		data, err := json.Marshal(accepted)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		acceptedJSON = string(data)
+	}
+
+	return string(optionsJSON), answersJSON, acceptedJSON, nil
+}
+
+// 反序列化 marshalQuestionJSON 写入的字段
+func unmarshalQuestionJSON(q *Question, optionsJSON string, answersJSON, acceptedJSON sql.NullString) error {
+	if err := json.Unmarshal([]byte(optionsJSON), &q.Options); err != nil {
+		return fmt.Errorf("Failed to parse options: %v", err)
+	}
+	if answersJSON.Valid {
+		if err := json.Unmarshal([]byte(answersJSON.String), &q.Answers); err != nil {
+			return fmt.Errorf("Failed to parse answers: %v", err)
+		}
+		// 兼容添加题型字段之前保存的多选题
+		if q.Type == questionTypeSingle {
+			q.Type = questionTypeMultiple
+		}
+	}
+	if acceptedJSON.Valid {
+		var target interface{} = &q.AcceptedAnswers
+		if q.Type == questionTypeFillBlank {
+			target = &q.Blanks
+		}
+		if err := json.Unmarshal([]byte(acceptedJSON.String), target); err != nil {
+			return fmt.Errorf("Failed to parse accepted answers: %v", err)
+		}
+	}
+	return nil
+}
+
 func findColumnIndex(headers map[string]int, candidates []string) int {
 	for _, candidate := range candidates {
 		if index, exists := headers[candidate]; exists {
@@ -801,39 +1400,114 @@ func findColumnIndex(headers map[string]int, candidates []string) int {
 	return -1
 }
 
-func getExcelValue(record []string, colIndex int) string {
-	if colIndex < 0 || colIndex >= len(record) {
-		return ""
+// 识别表头中的选项列（选项A、A、optionA、Option A、选择A 等，字母可为 A~Z），按字母顺序返回列索引。
+// 字母不连续时只保留从 A 开始连续的部分，避免答案字母与选项错位。
+func findOptionColumns(header []string) []int {
+	byLetter := make(map[int]int)
+	for i, name := range header {
+		letter, ok := optionLetter(name)
+		if !ok {
+			continue
+		}
+		if _, exists := byLetter[letter]; !exists {
+			byLetter[letter] = i
+		}
 	}
-	return strings.TrimSpace(record[colIndex])
+
+	var cols []int
+	for letter := 0; letter < 26; letter++ {
+		col, ok := byLetter[letter]
+		if !ok {
+			break
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+func optionLetter(header string) (int, bool) {
+	name := strings.ToUpper(strings.Join(strings.Fields(header), ""))
+	for _, prefix := range []string{"选项", "选择", "OPTION", ""} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, prefix)
+		if len(rest) == 1 && rest[0] >= 'A' && rest[0] <= 'Z' {
+			return int(rest[0] - 'A'), true
+		}
+	}
+	return 0, false
 }
 
-func getCSVValue(record []string, colIndex int) string {
+// 读取一行中的选项（各选项单独成列，或全部写在同一个单元格中），
+// 末尾的空选项会被忽略，中间出现空选项时报错
+func getOptionValues(row []string, layout rowLayout) ([]string, error) {
+	var options []string
+	if layout.optionsCol >= 0 {
+		if cell := getCellValue(row, layout.optionsCol); cell != "" {
+			for _, option := range strings.Split(cell, layout.optionDelimiter) {
+				options = append(options, strings.TrimSpace(option))
+			}
+		}
+	} else {
+		for _, col := range layout.optionCols {
+			options = append(options, getCellValue(row, col))
+		}
+	}
+	for len(options) > 0 && options[len(options)-1] == "" {
+		options = options[:len(options)-1]
+	}
+	for i, option := range options {
+		if option == "" {
+			return nil, fmt.Errorf("选项%c为空", 'A'+i)
+		}
+	}
+	return options, nil
+}
+
+func getCellValue(record []string, colIndex int) string {
 	if colIndex < 0 || colIndex >= len(record) {
 		return ""
 	}
 	return strings.TrimSpace(record[colIndex])
 }
 
+// 解析答案列，多选题可写作 "ACD"、"A,C,D"、"A、C、D" 或 "1,3,4"，返回排序去重后的选项索引
+func parseAnswers(answerStr string, optionCount int) ([]int, error) {
+	answerStr = strings.TrimSpace(strings.ToUpper(answerStr))
+
+	parts := strings.FieldsFunc(answerStr, func(r rune) bool {
+		return strings.ContainsRune(",，、;；/| ", r)
+	})
+	// 纯字母且无分隔符时按单个字母拆分，如 "ACD"
+	if len(parts) == 1 && len(parts[0]) > 1 && strings.Trim(parts[0], "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+		parts = strings.Split(parts[0], "")
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("答案不能为空")
+	}
+
+	answers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		answer, err := parseAnswer(part, optionCount)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, answer)
+	}
+
+	return normalizeChoice(answers, optionCount)
+}
+
 func parseAnswer(answerStr string, optionCount int) (int, error) {
 	answerStr = strings.TrimSpace(strings.ToUpper(answerStr))
 
 	// 尝试解析字母答案
-	switch answerStr {
-	case "A":
-		return 0, nil
-	case "B":
-		return 1, nil
-	case "C":
-		if optionCount > 2 {
-			return 2, nil
-		}
-		return -1, fmt.Errorf("选项C不存在")
-	case "D":
-		if optionCount > 3 {
-			return 3, nil
+	if len(answerStr) == 1 && answerStr[0] >= 'A' && answerStr[0] <= 'Z' {
+		if index := int(answerStr[0] - 'A'); index < optionCount {
+			return index, nil
 		}
-		return -1, fmt.Errorf("选项D不存在")
+		return -1, fmt.Errorf("选项%s不存在", answerStr)
 	}
 
 	// 尝试解析数字答案
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tealeg/xlsx/v3"
+)
+
+// 内存中的上传文件
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error { return nil }
+
+func TestParseCSVFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		mapping     *ImportMapping
+		wantOptions [][]string
+		wantAnswers []int
+		wantErrors  int
+		wantErr     string
+	}{
+		{
+			name:        "chinese headers with BOM",
+			content:     "\ufeff题目,选项A,选项B,选项C,正确答案\n甲,1,2,3,C\n",
+			wantOptions: [][]string{{"1", "2", "3"}},
+			wantAnswers: []int{2},
+		},
+		{
+			name:        "english headers beyond D",
+			content:     "Question,Option A,Option B,Option C,Option D,Option E,Option F,Answer\n甲,1,2,3,4,5,6,F\n",
+			wantOptions: [][]string{{"1", "2", "3", "4", "5", "6"}},
+			wantAnswers: []int{5},
+		},
+		{
+			name:        "letters stop at first gap",
+			content:     "题目,A,B,D,答案\n甲,1,2,4,B\n",
+			wantOptions: [][]string{{"1", "2"}},
+			wantAnswers: []int{1},
+		},
+		{
+			name:        "answer outside options",
+			content:     "题目,选项A,选项B,正确答案\n甲,1,2,A\n乙,1,2,C\n",
+			wantOptions: [][]string{{"1", "2"}},
+			wantAnswers: []int{0},
+			wantErrors:  1,
+		},
+		{
+			name:        "mapping with custom delimiters",
+			content:     "Stem;Choices;Key\n甲;1/2/3;B\n",
+			mapping:     &ImportMapping{QuestionColumn: "Stem", OptionsColumn: "Choices", OptionDelimiter: "/", AnswerColumn: "Key", CSVDelimiter: ";"},
+			wantOptions: [][]string{{"1", "2", "3"}},
+			wantAnswers: []int{1},
+		},
+		{
+			name:    "mapping column missing from header",
+			content: "Stem,X,Y,Key\n甲,1,2,A\n",
+			mapping: &ImportMapping{QuestionColumn: "Stem", OptionColumns: []string{"X", "Y", "Z"}, AnswerColumn: "Key"},
+			wantErr: "表头中缺少列: Z",
+		},
+		{
+			name:    "missing option columns",
+			content: "题目,正确答案\n甲,A\n",
+			wantErr: "缺少必要的列",
+		},
+		{
+			name:    "header only",
+			content: "题目,选项A,选项B,正确答案\n",
+			wantErr: "CSV文件数据不足",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var questions []Question
+			report := &ImportReport{Rows: []ImportRowResult{}}
+			err := parseCSVFile(memFile{bytes.NewReader([]byte(tt.content))}, tt.mapping, report, func(q Question) error {
+				questions = append(questions, q)
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Errors != tt.wantErrors {
+				t.Errorf("errors = %d, want %d: %+v", report.Errors, tt.wantErrors, report.Rows)
+			}
+
+			var options [][]string
+			var answers []int
+			for _, q := range questions {
+				options = append(options, q.Options)
+				answers = append(answers, q.Answer)
+			}
+			if !reflect.DeepEqual(options, tt.wantOptions) {
+				t.Errorf("options = %q, want %q", options, tt.wantOptions)
+			}
+			if !reflect.DeepEqual(answers, tt.wantAnswers) {
+				t.Errorf("answers = %v, want %v", answers, tt.wantAnswers)
+			}
+		})
+	}
+}
+
+func TestBankQuestionsHideAnswersByDefault(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, []Question{
+		{Type: questionTypeSingle, Question: "1 + 1 = ?", Options: []string{"3", "2"}, Answer: 1, Explanation: "basic"},
+	})
+	otherToken, _ := registerTestUser(t, r, "bob")
+
+	tests := []struct {
+		path        string
+		token       string
+		status      int
+		withAnswers bool
+	}{
+		{"/api/question-banks/" + bankID + "/questions", token, http.StatusOK, false},
+		{"/api/question-banks/" + bankID + "/questions?mode=exam", token, http.StatusOK, false},
+		{"/api/question-banks/" + bankID + "/questions?mode=practice", token, http.StatusOK, false},
+		{"/api/question-banks/" + bankID + "/questions?mode=manage", token, http.StatusOK, true},
+		{"/api/question-banks/" + bankID + "/questions?mode=other", token, http.StatusBadRequest, false},
+		{"/api/question-banks/" + bankID + "/questions?mode=manage", otherToken, http.StatusNotFound, false},
+		{"/api/question-banks/" + bankID, token, http.StatusOK, false},
+		{"/api/question-banks/" + bankID + "?mode=manage", token, http.StatusOK, true},
+		{"/api/question-banks/" + bankID + "?mode=manage", otherToken, http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		w := doJSON(r, "GET", tt.path, tt.token, nil)
+		if w.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d", tt.path, w.Code, tt.status)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		body := w.Body.String()
+		if strings.HasPrefix(body, "{") {
+			var bank struct {
+				Questions json.RawMessage `json:"questions"`
+			}
+			decodeBody(t, w, &bank)
+			body = string(bank.Questions)
+		}
+		var questions []map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &questions); err != nil || len(questions) != 1 {
+			t.Fatalf("GET %s: unexpected body %s", tt.path, w.Body.String())
+		}
+		_, hasAnswer := questions[0]["answer"]
+		_, hasExplanation := questions[0]["explanation"]
+		if hasAnswer != tt.withAnswers || hasExplanation != tt.withAnswers {
+			t.Errorf("GET %s: answer present %v, explanation present %v, want %v", tt.path, hasAnswer, hasExplanation, tt.withAnswers)
+		}
+	}
+}
+
+// 题库中的题目数
+func bankQuestionCount(t *testing.T, bankID string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM questions WHERE bank_id = ?", bankID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// 逐行报告：dryRun 只返回报告不写入；默认任一行出错都不导入；skipInvalid 只导入通过校验的行
+func TestUploadRowReport(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	csvFile := []byte("题目,选项A,选项B,正确答案\n有效,是,否,A\n,是,否,A\n答案不存在,是,否,Z\n")
+	wantRows := []ImportRowResult{
+		{Row: 2, Status: importRowAccepted, Question: "有效"},
+		{Row: 3, Status: importRowSkipped},
+		{Row: 4, Status: importRowError, Question: "答案不存在"},
+	}
+
+	tests := []struct {
+		name         string
+		fields       map[string]string
+		wantStatus   int
+		wantImported int
+		wantStored   int
+	}{
+		{"dry run", map[string]string{"dryRun": "true"}, http.StatusOK, 0, 0},
+		{"dry run with skipInvalid", map[string]string{"dryRun": "true", "skipInvalid": "true"}, http.StatusOK, 0, 0},
+		{"reject on error", nil, http.StatusBadRequest, 0, 0},
+		{"skip invalid rows", map[string]string{"skipInvalid": "true"}, http.StatusOK, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bankID := createTestBank(t, r, token, nil)
+			w := uploadTestBankFile(t, r, token, bankID, "q.csv", csvFile, tt.fields)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var resp struct {
+				Report ImportReport `json:"report"`
+			}
+			decodeBody(t, w, &resp)
+			report := resp.Report
+			if report.Total != 3 || report.Accepted != 1 || report.Skipped != 1 || report.Errors != 1 || report.Imported != tt.wantImported {
+				t.Errorf("report = %+v", report)
+			}
+			if len(report.Rows) != len(wantRows) {
+				t.Fatalf("rows = %+v", report.Rows)
+			}
+			for i, want := range wantRows {
+				got := report.Rows[i]
+				if got.Row != want.Row || got.Status != want.Status || got.Question != want.Question {
+					t.Errorf("row %d = %+v, want %+v", i, got, want)
+				}
+				if (got.Reason == "") != (want.Status == importRowAccepted) {
+					t.Errorf("row %d reason = %q", i, got.Reason)
+				}
+			}
+			if n := bankQuestionCount(t, bankID); n != tt.wantStored {
+				t.Errorf("stored %d questions, want %d", n, tt.wantStored)
+			}
+		})
+	}
+}
+
+// 生成只含文本单元格的 xlsx 工作簿
+func writeTestXLSX(t *testing.T, sheets []testXLSSheet) []byte {
+	t.Helper()
+	file := xlsx.NewFile()
+	for _, s := range sheets {
+		sheet, err := file.AddSheet(s.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, values := range s.rows {
+			row := sheet.AddRow()
+			for _, value := range values {
+				row.AddCell().SetString(value)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := file.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 多工作表导入：工作表名称作为章节（有章节列时以章节列为准），sheets 只导入选中的工作表，
+// 表头不完整的工作表（如说明页）记为跳过
+func TestUploadExcelSheets(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	header := []string{"题目", "选项A", "选项B", "正确答案"}
+	workbook := writeTestXLSX(t, []testXLSSheet{
+		{"第一章", [][]string{header, {"甲", "1", "2", "A"}, {"乙", "1", "2", "B"}}},
+		{"说明", [][]string{{"本文件用于导入题库"}, {"每个工作表为一章"}}},
+		{"第二章", [][]string{append(header, "章节"), {"丙", "1", "2", "A", "附录"}, {"丁", "1", "2", "B", ""}}},
+	})
+
+	tests := []struct {
+		name         string
+		sheets       string
+		wantStatus   int
+		wantChapters map[string]string
+		wantSkipped  []string // 报告中被跳过的工作表
+	}{
+		{
+			name:         "all sheets",
+			wantStatus:   http.StatusOK,
+			wantChapters: map[string]string{"甲": "第一章", "乙": "第一章", "丙": "附录", "丁": "第二章"},
+			wantSkipped:  []string{"说明"},
+		},
+		{
+			name:         "selected sheet keeps its chapter",
+			sheets:       "第二章",
+			wantStatus:   http.StatusOK,
+			wantChapters: map[string]string{"丙": "附录", "丁": "第二章"},
+		},
+		{
+			name:       "unknown sheet",
+			sheets:     "第三章",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bankID := createTestBank(t, r, token, nil)
+			var fields map[string]string
+			if tt.sheets != "" {
+				fields = map[string]string{"sheets": tt.sheets}
+			}
+			w := uploadTestBankFile(t, r, token, bankID, "bank.xlsx", workbook, fields)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if n := bankQuestionCount(t, bankID); n != 0 {
+					t.Errorf("stored %d questions, want 0", n)
+				}
+				return
+			}
+
+			var resp struct {
+				Report ImportReport `json:"report"`
+			}
+			decodeBody(t, w, &resp)
+			var skipped []string
+			for _, row := range resp.Report.Rows {
+				if row.Status == importRowSkipped {
+					skipped = append(skipped, row.Sheet)
+				}
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("skipped sheets = %q, want %q", skipped, tt.wantSkipped)
+			}
+
+			w = doJSON(r, "GET", "/api/question-banks/"+bankID+"/questions?mode=manage", token, nil)
+			var questions []Question
+			decodeBody(t, w, &questions)
+			chapters := map[string]string{}
+			for _, q := range questions {
+				chapters[q.Question] = q.Chapter
+			}
+			if !reflect.DeepEqual(chapters, tt.wantChapters) {
+				t.Errorf("chapters = %v, want %v", chapters, tt.wantChapters)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 测试使用临时目录中的 SQLite 数据库，执行全部迁移并返回路由
+func setupTestServer(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	cfg = defaultConfig()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	cfg.Auth.BcryptCost = 4
+	cfg.Media.Dir = filepath.Join(t.TempDir(), "media")
+	cfg.Import.JobDir = filepath.Join(t.TempDir(), "import-jobs")
+
+	var err error
+	backend, err = newDBBackend(cfg.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = backend.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrateUp(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	initMediaStorage()
+	cacheSettings(defaultSettings())
+	settingsCache.loadedAt = time.Time{}
+
+	gin.DefaultWriter = io.Discard
+	return setupRoutes()
+}
+
+// 发送 JSON 请求，token 为空时不携带认证头
+func doJSON(r http.Handler, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+}
+
+// 注册用户并返回访问令牌和用户 ID
+func registerTestUser(t *testing.T, r http.Handler, username string) (token, userID string) {
+	t.Helper()
+	w := doJSON(r, "POST", "/api/auth/register", "", gin.H{"username": username, "password": "secret"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("register %s: %d %s", username, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token string `json:"token"`
+		User  struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	decodeBody(t, w, &resp)
+	return resp.Token, resp.User.ID
+}
+
+// 创建带题目的题库并返回题库 ID
+func createTestBank(t *testing.T, r http.Handler, token string, questions []Question) string {
+	t.Helper()
+	w := doJSON(r, "POST", "/api/question-banks", token, gin.H{"name": "bank", "questions": questions})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create bank: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	decodeBody(t, w, &resp)
+	return resp.ID
+}
+
+// 三道单选题，正确答案均为第一个选项
+func sampleQuestions() []Question {
+	return []Question{
+		{Type: questionTypeSingle, Question: "1 + 1 = ?", Options: []string{"2", "3"}, Answer: 0},
+		{Type: questionTypeSingle, Question: "2 + 2 = ?", Options: []string{"4", "5"}, Answer: 0},
+		{Type: questionTypeSingle, Question: "3 + 3 = ?", Options: []string{"6", "7"}, Answer: 0},
+	}
+}
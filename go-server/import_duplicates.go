@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 导入时重复题目的处理策略
+const (
+	duplicateSkip      = "skip"      // 跳过重复的题目
+	duplicateOverwrite = "overwrite" // 用导入的内容覆盖已有题目
+	duplicateKeep      = "keep"      // 重复的题目也照常导入
+)
+
+func validDuplicatePolicy(policy string) bool {
+	return policy == duplicateSkip || policy == duplicateOverwrite || policy == duplicateKeep
+}
+
+// 与某道题重复的目标题目，fromFile 表示是本次导入中先出现的题目
+type duplicateTarget struct {
+	id       string
+	fromFile bool
+}
+
+// 按题干和选项（忽略大小写和多余空白）判断题目是否重复。
+// 图片地址不参与比较，同一压缩包重复导入时图片会保存为新的媒体地址
+func duplicateKey(q Question) string {
+	parts := make([]string, 0, len(q.Options)+1)
+	parts = append(parts, normalizeText(stripImageTargets(q.Question)))
+	for _, option := range q.Options {
+		parts = append(parts, normalizeText(stripImageTargets(option)))
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+func stripImageTargets(text string) string {
+	text = markdownImage.ReplaceAllString(text, "${1}${3}")
+	return htmlImage.ReplaceAllString(text, "${1}${3}")
+}
+
+// 读取题库中已有题目的去重键，只查询题干和选项
+func loadDuplicateTargets(bankID string) (map[string]duplicateTarget, error) {
+	rows, err := db.Query("SELECT id, question, options FROM questions WHERE bank_id = ?", bankID)
+	if err != nil {
+		return nil, fmt.Errorf("查询已有题目失败: %v", err)
+	}
+	defer rows.Close()
+
+	targets := make(map[string]duplicateTarget)
+	for rows.Next() {
+		var q Question
+		var optionsJSON string
+		if err := rows.Scan(&q.ID, &q.Question, &optionsJSON); err != nil {
+			return nil, fmt.Errorf("查询已有题目失败: %v", err)
+		}
+		if err := json.Unmarshal([]byte(optionsJSON), &q.Options); err != nil {
+			return nil, fmt.Errorf("解析题目选项失败: %v", err)
+		}
+
+		key := duplicateKey(q)
+		if _, exists := targets[key]; !exists {
+			targets[key] = duplicateTarget{id: q.ID}
+		}
+	}
+	return targets, rows.Err()
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 导入任务状态
+const (
+	importJobQueued    = "queued"
+	importJobRunning   = "running"
+	importJobSucceeded = "succeeded"
+	importJobFailed    = "failed"
+)
+
+const importJobSelect = "SELECT id, user_id, bank_id, file_name, file_size, status, processed, report, message, error, created_at, finished_at FROM import_jobs"
+
+// 等待执行的任务 ID
+var importJobQueue = make(chan string, 1024)
+
+// 本实例正在执行的任务的报告快照，只保存在内存中，已处理行数随心跳写入数据库，任务结束后写入完整报告
+var importJobProgress = struct {
+	sync.Mutex
+	reports map[string]ImportReport
+}{reports: make(map[string]ImportReport)}
+
+// 上传文件的暂存目录，见配置 import.job_dir
+func importJobDir() string {
+	return cfg.Import.JobDir
+}
+
+// 执行中的任务定期写入心跳，心跳超过 importJobStaleAfter 未更新的任务视为所在实例已退出
+const (
+	importJobHeartbeat  = 10 * time.Second
+	importJobStaleAfter = time.Minute
+)
+
+// 本实例的标识，写入执行中任务的 worker_id
+var importWorkerID string
+
+// 启动导入任务的工作协程（配置 import.workers，默认 2 个），重新执行排队中的任务，并定期接管心跳超时的任务。
+// 任务的写入在一个事务中完成，服务中断时未提交的数据会回滚，因此中断的任务从头重新执行
+func startImportWorkers() {
+	hostname, _ := os.Hostname()
+	importWorkerID = hostname + "-" + generateUUID()
+
+	for i := 0; i < cfg.Import.Workers; i++ {
+		go func() {
+			for jobID := range importJobQueue {
+				runImportJob(jobID)
+			}
+		}()
+	}
+
+	rows, err := db.Query("SELECT id FROM import_jobs WHERE status = ? ORDER BY created_at", importJobQueued)
+	if err != nil {
+		log.Printf("Warning: Failed to load import jobs: %v", err)
+	} else {
+		defer rows.Close()
+		resumed := 0
+		for rows.Next() {
+			var jobID string
+			if err := rows.Scan(&jobID); err != nil {
+				log.Printf("Warning: Failed to load import jobs: %v", err)
+				break
+			}
+			enqueueImportJob(jobID)
+			resumed++
+		}
+		if resumed > 0 {
+			log.Printf("Resumed %d import jobs", resumed)
+		}
+	}
+
+	go func() {
+		for {
+			requeueStaleImportJobs()
+			time.Sleep(importJobStaleAfter)
+		}
+	}()
+}
+
+// 重新排队其他实例执行中但心跳已超时的任务，返回重新排队的任务数。
+// 其他实例正常执行的任务和本实例自己的任务不受影响
+func requeueStaleImportJobs() int {
+	rows, err := db.Query("SELECT id FROM import_jobs WHERE status = ? AND (worker_id IS NULL OR worker_id <> ?) AND (heartbeat_at IS NULL OR heartbeat_at < ?)",
+		importJobRunning, importWorkerID, backend.timeValue(time.Now().Add(-importJobStaleAfter)))
+	if err != nil {
+		log.Printf("Warning: Failed to load stale import jobs: %v", err)
+		return 0
+	}
+	var jobIDs []string
+	for rows.Next() {
+		var jobID string
+		if err := rows.Scan(&jobID); err != nil {
+			log.Printf("Warning: Failed to load stale import jobs: %v", err)
+			break
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+	rows.Close()
+
+	requeued := 0
+	for _, jobID := range jobIDs {
+		// 查询之后心跳可能已更新，条件中再检查一次
+		result, err := db.Exec("UPDATE import_jobs SET status = ?, worker_id = NULL WHERE id = ? AND status = ? AND (worker_id IS NULL OR worker_id <> ?) AND (heartbeat_at IS NULL OR heartbeat_at < ?)",
+			importJobQueued, jobID, importJobRunning, importWorkerID, backend.timeValue(time.Now().Add(-importJobStaleAfter)))
+		if err != nil {
+			log.Printf("Warning: Failed to requeue import job %s: %v", jobID, err)
+			continue
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			enqueueImportJob(jobID)
+			requeued++
+		}
+	}
+	if requeued > 0 {
+		log.Printf("Requeued %d stale import jobs", requeued)
+	}
+	return requeued
+}
+
+// 加入队列，队列已满时不阻塞请求
+func enqueueImportJob(jobID string) {
+	select {
+	case importJobQueue <- jobID:
+	default:
+		go func() { importJobQueue <- jobID }()
+	}
+}
+
+// 保存上传的文件并创建排队中的导入任务
+func createImportJob(userID, bankID string, file multipart.File, header *multipart.FileHeader, opts importOptions) (*ImportJob, error) {
+	optionsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := importJobDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建上传目录失败: %v", err)
+	}
+
+	jobID := generateUUID()
+	filePath := filepath.Join(dir, jobID+strings.ToLower(filepath.Ext(header.Filename)))
+	out, err := os.Create(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("保存上传文件失败: %v", err)
+	}
+	size, err := io.Copy(out, file)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("保存上传文件失败: %v", err)
+	}
+
+	_, err = db.Exec("INSERT INTO import_jobs (id, user_id, bank_id, file_name, file_path, file_size, options, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		jobID, userID, bankID, header.Filename, filePath, size, string(optionsJSON), importJobQueued)
+	if err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("Failed to create import job")
+	}
+
+	enqueueImportJob(jobID)
+	return loadImportJob(userID, jobID)
+}
+
+// 执行一个排队中的任务，结束后删除暂存的文件。任务被其他实例接管时保留文件，由接管的实例重新执行
+func runImportJob(jobID string) {
+	// 只执行仍在排队的任务，避免同一任务被重复执行
+	result, err := db.Exec("UPDATE import_jobs SET status = ?, processed = 0, report = NULL, worker_id = ?, heartbeat_at = ? WHERE id = ? AND status = ?",
+		importJobRunning, importWorkerID, backend.timeValue(time.Now()), jobID, importJobQueued)
+	if err != nil {
+		log.Printf("Warning: Failed to start import job %s: %v", jobID, err)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go heartbeatImportJob(jobID, stop)
+
+	var bankID, fileName, filePath, optionsJSON string
+	var size int64
+	err = db.QueryRow("SELECT bank_id, file_name, file_path, file_size, options FROM import_jobs WHERE id = ?", jobID).
+		Scan(&bankID, &fileName, &filePath, &size, &optionsJSON)
+	if err != nil {
+		finishImportJob(jobID, nil, false, err)
+		return
+	}
+
+	var opts importOptions
+	if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+		finishImportJob(jobID, nil, false, fmt.Errorf("Failed to parse import options: %v", err))
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		finishImportJob(jobID, nil, opts.DryRun, fmt.Errorf("上传的文件已丢失"))
+		return
+	}
+	defer file.Close()
+
+	report := &ImportReport{Rows: []ImportRowResult{}}
+	err = runImport(bankID, file, fileName, size, opts, report, func() {
+		setImportJobProgress(jobID, report)
+	}, func(tx *sql.Tx) error {
+		return claimImportJob(tx, jobID)
+	})
+	if finishImportJob(jobID, report, opts.DryRun, err) {
+		os.Remove(filePath)
+	}
+}
+
+// 在导入事务提交前确认任务仍由本实例执行并更新心跳，任务已被其他实例接管时回滚，避免重复导入
+func claimImportJob(tx *sql.Tx, jobID string) error {
+	result, err := tx.Exec("UPDATE import_jobs SET heartbeat_at = ? WHERE id = ? AND status = ? AND worker_id = ?",
+		backend.timeValue(time.Now()), jobID, importJobRunning, importWorkerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errImportJobTakenOver
+	}
+	return nil
+}
+
+var errImportJobTakenOver = errors.New("导入任务已被其他实例接管")
+
+// 定期更新任务的心跳和已处理行数，直到 stop 关闭
+func heartbeatImportJob(jobID string, stop <-chan struct{}) {
+	ticker := time.NewTicker(importJobHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		processed := 0
+		importJobProgress.Lock()
+		if report, ok := importJobProgress.reports[jobID]; ok {
+			processed = report.Accepted
+		}
+		importJobProgress.Unlock()
+
+		_, err := db.Exec("UPDATE import_jobs SET heartbeat_at = ?, processed = ? WHERE id = ? AND status = ? AND worker_id = ?",
+			backend.timeValue(time.Now()), processed, jobID, importJobRunning, importWorkerID)
+		if err != nil {
+			log.Printf("Warning: Failed to update heartbeat of import job %s: %v", jobID, err)
+		}
+	}
+}
+
+// 记录任务结果，report 为 nil 表示任务没有开始解析。任务已被其他实例接管时不写入并返回 false
+func finishImportJob(jobID string, report *ImportReport, dryRun bool, jobErr error) bool {
+	importJobProgress.Lock()
+	delete(importJobProgress.reports, jobID)
+	importJobProgress.Unlock()
+
+	if errors.Is(jobErr, errImportJobTakenOver) {
+		log.Printf("Warning: Import job %s was taken over by another instance", jobID)
+		return false
+	}
+
+	status, processed, message, errText := importJobSucceeded, 0, "", ""
+	if jobErr != nil {
+		status, errText = importJobFailed, jobErr.Error()
+	} else if !dryRun {
+		message = importMessage(report)
+	}
+
+	var reportJSON interface{}
+	if report != nil {
+		processed = report.Accepted
+		data, err := json.Marshal(report)
+		if err != nil {
+			log.Printf("Warning: Failed to encode import report for job %s: %v", jobID, err)
+		} else {
+			reportJSON = string(data)
+		}
+	}
+
+	result, err := db.Exec("UPDATE import_jobs SET status = ?, processed = ?, report = ?, message = ?, error = ?, worker_id = NULL, finished_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ? AND worker_id = ?",
+		status, processed, reportJSON, message, errText, jobID, importJobRunning, importWorkerID)
+	if err != nil {
+		log.Printf("Warning: Failed to finish import job %s: %v", jobID, err)
+		return false
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		log.Printf("Warning: Import job %s was taken over by another instance", jobID)
+		return false
+	}
+	return true
+}
+
+func setImportJobProgress(jobID string, report *ImportReport) {
+	snapshot := *report
+	snapshot.Rows = append([]ImportRowResult(nil), report.Rows...)
+
+	importJobProgress.Lock()
+	importJobProgress.reports[jobID] = snapshot
+	importJobProgress.Unlock()
+}
+
+// 获取当前用户最近的导入任务，不含报告
+func getImportJobs(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	rows, err := db.Query(importJobSelect+" WHERE user_id = ? ORDER BY created_at DESC LIMIT 50", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	jobs := []ImportJob{}
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		job.Report = nil
+		jobs = append(jobs, *job)
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+func getImportJob(c *gin.Context) {
+	job, err := loadImportJob(c.GetString("userID"), c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// 以 Server-Sent Events 推送任务进度：状态或进度变化时发送 progress 事件，任务结束时发送 done 事件并关闭连接
+func streamImportJob(c *gin.Context) {
+	userID := c.GetString("userID")
+	jobID := c.Param("id")
+
+	job, err := loadImportJob(userID, jobID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	// 关闭 nginx 的响应缓冲
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var last []byte
+	c.Stream(func(w io.Writer) bool {
+		if job.Status == importJobSucceeded || job.Status == importJobFailed {
+			c.SSEvent("done", job)
+			return false
+		}
+		if data, err := json.Marshal(job); err == nil && !bytes.Equal(data, last) {
+			c.SSEvent("progress", job)
+			last = data
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+		}
+
+		job, err = loadImportJob(userID, jobID)
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			return false
+		}
+		return true
+	})
+}
+
+// 加载当前用户的任务，执行中的任务使用内存中的最新进度
+func loadImportJob(userID, jobID string) (*ImportJob, error) {
+	job, err := scanImportJob(db.QueryRow(importJobSelect+" WHERE id = ? AND user_id = ?", jobID, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status == importJobRunning {
+		importJobProgress.Lock()
+		report, ok := importJobProgress.reports[jobID]
+		importJobProgress.Unlock()
+		if ok {
+			job.Report = &report
+			job.Processed = report.Accepted
+		}
+	}
+	return job, nil
+}
+
+func scanImportJob(row rowScanner) (*ImportJob, error) {
+	var job ImportJob
+	var reportJSON, message, errText sql.NullString
+	var finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.UserID, &job.BankID, &job.FileName, &job.FileSize, &job.Status, &job.Processed,
+		&reportJSON, &message, &errText, &job.CreatedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if reportJSON.Valid {
+		job.Report = &ImportReport{}
+		if err := json.Unmarshal([]byte(reportJSON.String), job.Report); err != nil {
+			return nil, fmt.Errorf("Failed to parse import report: %v", err)
+		}
+	}
+	job.Message = message.String
+	job.Error = errText.String
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
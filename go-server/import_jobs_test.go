@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// 直接插入一个导入任务，heartbeat 为零值时心跳为空
+func insertTestImportJob(t *testing.T, userID, bankID, status, workerID string, heartbeat time.Time) string {
+	t.Helper()
+	var worker, beat interface{}
+	if workerID != "" {
+		worker = workerID
+	}
+	if !heartbeat.IsZero() {
+		beat = backend.timeValue(heartbeat)
+	}
+	jobID := generateUUID()
+	_, err := db.Exec("INSERT INTO import_jobs (id, user_id, bank_id, file_name, file_path, options, status, worker_id, heartbeat_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		jobID, userID, bankID, "q.csv", "q.csv", "{}", status, worker, beat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobID
+}
+
+func TestRequeueStaleImportJobs(t *testing.T) {
+	r := setupTestServer(t)
+	token, userID := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+	importWorkerID = "self"
+	defer func() {
+		for len(importJobQueue) > 0 {
+			<-importJobQueue
+		}
+	}()
+
+	now := time.Now()
+	tests := []struct {
+		name       string
+		status     string
+		workerID   string
+		heartbeat  time.Time
+		wantStatus string
+	}{
+		{"other instance alive", importJobRunning, "other", now, importJobRunning},
+		{"other instance stale", importJobRunning, "other", now.Add(-2 * importJobStaleAfter), importJobQueued},
+		{"no heartbeat", importJobRunning, "", time.Time{}, importJobQueued},
+		{"own job with old heartbeat", importJobRunning, "self", now.Add(-2 * importJobStaleAfter), importJobRunning},
+		{"finished", importJobSucceeded, "other", now.Add(-2 * importJobStaleAfter), importJobSucceeded},
+	}
+
+	jobIDs := make([]string, len(tests))
+	for i, tt := range tests {
+		jobIDs[i] = insertTestImportJob(t, userID, bankID, tt.status, tt.workerID, tt.heartbeat)
+	}
+	if got := requeueStaleImportJobs(); got != 2 {
+		t.Errorf("requeued %d jobs, want 2", got)
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status string
+			if err := db.QueryRow("SELECT status FROM import_jobs WHERE id = ?", jobIDs[i]).Scan(&status); err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestClaimImportJobBeforeCommit(t *testing.T) {
+	r := setupTestServer(t)
+	token, userID := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+	importWorkerID = "self"
+
+	tests := []struct {
+		name     string
+		status   string
+		workerID string
+		wantErr  error
+	}{
+		{"still owned", importJobRunning, "self", nil},
+		{"taken over", importJobRunning, "other", errImportJobTakenOver},
+		{"requeued", importJobQueued, "", errImportJobTakenOver},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobID := insertTestImportJob(t, userID, bankID, tt.status, tt.workerID, time.Now())
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			if err := claimImportJob(tx, jobID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("claimImportJob = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const importProfileSelect = "SELECT id, user_id, name, mapping, created_at, updated_at FROM import_profiles"
+
+type importProfileRequest struct {
+	Name    string        `json:"name" binding:"required"`
+	Mapping ImportMapping `json:"mapping"`
+}
+
+// 获取当前用户的导入配置
+func getImportProfiles(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	rows, err := db.Query(importProfileSelect+" WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	profiles := []ImportProfile{}
+	for rows.Next() {
+		profile, err := scanImportProfile(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		profiles = append(profiles, profile)
+	}
+
+	c.JSON(http.StatusOK, profiles)
+}
+
+func getImportProfile(c *gin.Context) {
+	profile, err := loadImportProfile(c.GetString("userID"), c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func createImportProfile(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req importProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateImportMapping(&req.Mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM import_profiles WHERE user_id = ? AND name = ?)", userID, req.Name).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已存在同名的导入配置"})
+		return
+	}
+
+	mappingJSON, err := json.Marshal(req.Mapping)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	profileID := generateUUID()
+	_, err = db.Exec("INSERT INTO import_profiles (id, user_id, name, mapping) VALUES (?, ?, ?, ?)",
+		profileID, userID, req.Name, string(mappingJSON))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create import profile"})
+		return
+	}
+
+	profile, err := loadImportProfile(userID, profileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func updateImportProfile(c *gin.Context) {
+	userID := c.GetString("userID")
+	profileID := c.Param("id")
+
+	var req importProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateImportMapping(&req.Mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := loadImportProfile(userID, profileID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM import_profiles WHERE user_id = ? AND name = ? AND id != ?)",
+		userID, req.Name, profileID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已存在同名的导入配置"})
+		return
+	}
+
+	mappingJSON, err := json.Marshal(req.Mapping)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = db.Exec("UPDATE import_profiles SET name = ?, mapping = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?",
+		req.Name, string(mappingJSON), profileID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update import profile"})
+		return
+	}
+
+	profile, err := loadImportProfile(userID, profileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func deleteImportProfile(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	result, err := db.Exec("DELETE FROM import_profiles WHERE id = ? AND user_id = ?", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Import profile deleted successfully"})
+}
+
+func loadImportProfile(userID, profileID string) (*ImportProfile, error) {
+	profile, err := scanImportProfile(db.QueryRow(importProfileSelect+" WHERE id = ? AND user_id = ?", profileID, userID))
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func scanImportProfile(row rowScanner) (ImportProfile, error) {
+	var profile ImportProfile
+	var mappingJSON string
+	err := row.Scan(&profile.ID, &profile.UserID, &profile.Name, &mappingJSON, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return profile, err
+	}
+	if err := json.Unmarshal([]byte(mappingJSON), &profile.Mapping); err != nil {
+		return profile, fmt.Errorf("Failed to parse import mapping: %v", err)
+	}
+	return profile, nil
+}
+
+// 校验并规范化列映射
+func validateImportMapping(m *ImportMapping) error {
+	m.QuestionColumn = strings.TrimSpace(m.QuestionColumn)
+	m.TypeColumn = strings.TrimSpace(m.TypeColumn)
+	m.OptionsColumn = strings.TrimSpace(m.OptionsColumn)
+	m.AnswerColumn = strings.TrimSpace(m.AnswerColumn)
+	m.ExplanationColumn = strings.TrimSpace(m.ExplanationColumn)
+	m.ChapterColumn = strings.TrimSpace(m.ChapterColumn)
+	m.FormatColumn = strings.TrimSpace(m.FormatColumn)
+	m.MediaColumn = strings.TrimSpace(m.MediaColumn)
+	m.OptionColumns = trimTexts(m.OptionColumns)
+
+	if m.QuestionColumn == "" || m.AnswerColumn == "" {
+		return fmt.Errorf("必须指定题目列和答案列")
+	}
+	if len(m.OptionColumns) > 0 && m.OptionsColumn != "" {
+		return fmt.Errorf("option_columns 和 options_column 只能指定其一")
+	}
+	if len(m.OptionColumns) > 26 {
+		return fmt.Errorf("最多支持 26 个选项列")
+	}
+	// 没有题型列时所有题目都是选择题
+	if m.TypeColumn == "" && len(m.OptionColumns) < 2 && m.OptionsColumn == "" {
+		return fmt.Errorf("未指定题型列时必须指定至少两个选项列或选项单元格列")
+	}
+	if m.CSVDelimiter != "" {
+		r, size := utf8.DecodeRuneInString(m.CSVDelimiter)
+		if size != len(m.CSVDelimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return fmt.Errorf("CSV 分隔符必须是单个字符，且不能是引号或换行")
+		}
+	}
+	return nil
+}
+
+// 按列映射在表头中查找各列
+func (m ImportMapping) layout(header []string) (rowLayout, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		key := normalizeHeader(name)
+		if _, exists := index[key]; key != "" && !exists {
+			index[key] = i
+		}
+	}
+	find := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		col, ok := index[normalizeHeader(name)]
+		if !ok {
+			return -1, fmt.Errorf("表头中缺少列: %s", name)
+		}
+		return col, nil
+	}
+
+	layout := newRowLayout()
+	var err error
+	if layout.questionCol, err = find(m.QuestionColumn); err != nil {
+		return layout, err
+	}
+	if layout.typeCol, err = find(m.TypeColumn); err != nil {
+		return layout, err
+	}
+	if layout.answerCol, err = find(m.AnswerColumn); err != nil {
+		return layout, err
+	}
+	if layout.explanationCol, err = find(m.ExplanationColumn); err != nil {
+		return layout, err
+	}
+	if layout.chapterCol, err = find(m.ChapterColumn); err != nil {
+		return layout, err
+	}
+	if layout.formatCol, err = find(m.FormatColumn); err != nil {
+		return layout, err
+	}
+	if layout.mediaCol, err = find(m.MediaColumn); err != nil {
+		return layout, err
+	}
+	if layout.optionsCol, err = find(m.OptionsColumn); err != nil {
+		return layout, err
+	}
+	for _, name := range m.OptionColumns {
+		col, err := find(name)
+		if err != nil {
+			return layout, err
+		}
+		layout.optionCols = append(layout.optionCols, col)
+	}
+
+	if m.OptionDelimiter != "" {
+		layout.optionDelimiter = m.OptionDelimiter
+	}
+	if m.AnswerDelimiter != "" {
+		layout.answerDelimiter = m.AnswerDelimiter
+	}
+	if m.BlankDelimiter != "" {
+		layout.blankDelimiter = m.BlankDelimiter
+	}
+	if m.AlternativeDelimiter != "" {
+		layout.alternativeDelimiter = m.AlternativeDelimiter
+	}
+	return layout, nil
+}
+
+// 表头比较时忽略大小写和空白
+func normalizeHeader(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), ""))
+}
+
+// CSV 字段分隔符，未配置时为逗号
+func csvDelimiter(mapping *ImportMapping) rune {
+	if mapping == nil || mapping.CSVDelimiter == "" {
+		return ','
+	}
+	r, _ := utf8.DecodeRuneInString(mapping.CSVDelimiter)
+	return r
+}
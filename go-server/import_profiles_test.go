@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createTestImportProfile(t *testing.T, r http.Handler, token, name string, mapping ImportMapping) ImportProfile {
+	t.Helper()
+	w := doJSON(r, "POST", "/api/import-profiles", token, gin.H{"name": name, "mapping": mapping})
+	if w.Code != http.StatusOK {
+		t.Fatalf("create profile: %d %s", w.Code, w.Body.String())
+	}
+	var profile ImportProfile
+	decodeBody(t, w, &profile)
+	return profile
+}
+
+func TestImportProfileAccess(t *testing.T) {
+	r := setupTestServer(t)
+	ownerToken, _ := registerTestUser(t, r, "alice")
+	strangerToken, _ := registerTestUser(t, r, "bob")
+
+	mapping := ImportMapping{QuestionColumn: " Stem ", OptionsColumn: "Choices", AnswerColumn: "Key"}
+	profile := createTestImportProfile(t, r, ownerToken, "教务系统", mapping)
+	if profile.Mapping.QuestionColumn != "Stem" {
+		t.Errorf("question column = %q, want trimmed", profile.Mapping.QuestionColumn)
+	}
+
+	invalid := []struct {
+		name string
+		body gin.H
+	}{
+		{"duplicate name", gin.H{"name": "教务系统", "mapping": mapping}},
+		{"missing answer column", gin.H{"name": "缺答案", "mapping": ImportMapping{QuestionColumn: "Stem", OptionsColumn: "Choices"}}},
+		{"both option styles", gin.H{"name": "两种选项", "mapping": ImportMapping{QuestionColumn: "Stem", OptionColumns: []string{"A", "B"}, OptionsColumn: "Choices", AnswerColumn: "Key"}}},
+		{"no options without type", gin.H{"name": "没有选项", "mapping": ImportMapping{QuestionColumn: "Stem", AnswerColumn: "Key"}}},
+		{"multi-char csv delimiter", gin.H{"name": "分隔符", "mapping": ImportMapping{QuestionColumn: "Stem", OptionsColumn: "Choices", AnswerColumn: "Key", CSVDelimiter: ";;"}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doJSON(r, "POST", "/api/import-profiles", ownerToken, tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// 其他用户既看不到也不能修改、删除
+	path := "/api/import-profiles/" + profile.ID
+	update := gin.H{"name": "改名", "mapping": mapping}
+	for _, req := range []struct {
+		method string
+		body   interface{}
+	}{{"GET", nil}, {"PUT", update}, {"DELETE", nil}} {
+		if w := doJSON(r, req.method, path, strangerToken, req.body); w.Code != http.StatusNotFound {
+			t.Errorf("stranger %s: %d, want 404", req.method, w.Code)
+		}
+	}
+	var listed []ImportProfile
+	w := doJSON(r, "GET", "/api/import-profiles", strangerToken, nil)
+	decodeBody(t, w, &listed)
+	if len(listed) != 0 {
+		t.Errorf("stranger lists %d profiles, want 0", len(listed))
+	}
+
+	w = doJSON(r, "PUT", path, ownerToken, update)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	var updated ImportProfile
+	decodeBody(t, w, &updated)
+	if updated.Name != "改名" {
+		t.Errorf("name = %q after update", updated.Name)
+	}
+
+	if w := doJSON(r, "DELETE", path, ownerToken, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, "GET", path, ownerToken, nil); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: %d, want 404", w.Code)
+	}
+}
+
+// 上传时指定 profileId，按保存的列映射解析：答案在 Key 列，选项写在同一单元格中用 "|" 分隔
+func TestUploadWithImportProfile(t *testing.T) {
+	r := setupTestServer(t)
+	ownerToken, _ := registerTestUser(t, r, "alice")
+	strangerToken, _ := registerTestUser(t, r, "bob")
+
+	profile := createTestImportProfile(t, r, ownerToken, "单元格选项", ImportMapping{
+		QuestionColumn: "Stem", OptionsColumn: "Choices", AnswerColumn: "Key", ExplanationColumn: "Why",
+	})
+	csvFile := []byte("Stem,Choices,Key,Why\n1+1=?,1|2|3,B,基础\n首都,上海| 北京 ,B,\n")
+
+	bankID := createTestBank(t, r, ownerToken, nil)
+	// 不指定配置时按默认表头解析，找不到选项列
+	if w := uploadTestBankFile(t, r, ownerToken, bankID, "q.csv", csvFile, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("upload without profile: %d %s", w.Code, w.Body.String())
+	}
+	// 不能使用其他用户的配置
+	strangerBank := createTestBank(t, r, strangerToken, nil)
+	if w := uploadTestBankFile(t, r, strangerToken, strangerBank, "q.csv", csvFile, map[string]string{"profileId": profile.ID}); w.Code != http.StatusNotFound {
+		t.Fatalf("upload with stranger's profile: %d %s", w.Code, w.Body.String())
+	}
+
+	w := uploadTestBankFile(t, r, ownerToken, bankID, "q.csv", csvFile, map[string]string{"profileId": profile.ID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload with profile: %d %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(r, "GET", "/api/question-banks/"+bankID+"/questions?mode=manage", ownerToken, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get questions: %d %s", w.Code, w.Body.String())
+	}
+	var questions []Question
+	decodeBody(t, w, &questions)
+	if len(questions) != 2 {
+		t.Fatalf("imported %d questions, want 2", len(questions))
+	}
+	byText := map[string]Question{}
+	for _, q := range questions {
+		byText[q.Question] = q
+	}
+	want := []struct {
+		question    string
+		options     []string
+		answer      int
+		explanation string
+	}{
+		{"1+1=?", []string{"1", "2", "3"}, 1, "基础"},
+		{"首都", []string{"上海", "北京"}, 1, ""},
+	}
+	for _, tt := range want {
+		q, ok := byText[tt.question]
+		if !ok {
+			t.Errorf("question %q not imported", tt.question)
+			continue
+		}
+		if !reflect.DeepEqual(q.Options, tt.options) || q.Answer != tt.answer || q.Explanation != tt.explanation {
+			t.Errorf("%q = options %q answer %d explanation %q, want %q %d %q",
+				tt.question, q.Options, q.Answer, q.Explanation, tt.options, tt.answer, tt.explanation)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 每条多行 INSERT 写入的题目数
+const importBatchSize = 500
+
+// 报告导入进度的最长间隔
+const importProgressInterval = time.Second
+
+// 导入报告中最多保留的行数，超出的行只计数
+const maxReportRows = 1000
+
+// 上传文件大小上限，见配置 upload.max_upload_mb（默认 50MB），系统设置 maxUploadMB 可以调低
+func maxUploadBytes() int64 {
+	mb := cfg.Upload.MaxUploadMB
+	if limit := currentSettings().MaxUploadMB; limit > 0 && limit < mb {
+		mb = limit
+	}
+	return mb << 20
+}
+
+// 一次导入的参数，异步导入任务中随任务保存
+type importOptions struct {
+	Mapping     *ImportMapping `json:"mapping,omitempty"`
+	Sheets      []string       `json:"sheets,omitempty"`
+	Duplicates  string         `json:"duplicates"`
+	SkipInvalid bool           `json:"skip_invalid"`
+	DryRun      bool           `json:"dry_run"`
+}
+
+// 导入失败：status 为对应的 HTTP 状态码，report 非空时随错误一起返回
+type importError struct {
+	status  int
+	message string
+	report  *ImportReport
+}
+
+func (e *importError) Error() string {
+	return e.message
+}
+
+// 只影响一行的导入错误（如引用的图片不存在），该行记为 error，其他行继续导入
+type rowError struct {
+	reason string
+}
+
+func (e *rowError) Error() string {
+	return e.reason
+}
+
+func (e *importError) response() gin.H {
+	if e.report == nil {
+		return gin.H{"error": e.message}
+	}
+	return gin.H{"error": e.message, "report": e.report}
+}
+
+// 执行一次导入，opts.DryRun 时只生成报告不写入。分两个阶段：解析阶段不开启事务，
+// 通过校验的题目分批生成写入语句并记录到临时文件（importSpool）；全部行解析完且没有需要拒绝的错误后，
+// 再在一个短事务中依次执行这些语句，出错时整体回滚。数据库的写锁只在写入阶段持有，解析大文件时不阻塞其他写入。
+// report 由调用方创建并在解析过程中逐行更新，progress 不为 nil 时每处理 500 行或每隔 1 秒调用一次；
+// beforeCommit 不为 nil 时在提交前于同一事务中调用，返回错误时回滚
+func runImport(bankID string, file multipart.File, fileName string, size int64, opts importOptions, report *ImportReport, progress func(), beforeCommit func(tx *sql.Tx) error) error {
+	var exec execer
+	var spool *importSpool
+	if !opts.DryRun {
+		var err error
+		spool, err = newImportSpool()
+		if err != nil {
+			return fmt.Errorf("Failed to create import spool: %v", err)
+		}
+		defer spool.close()
+		exec = spool
+	}
+
+	importer, err := newQuestionImporter(exec, bankID, opts.Duplicates)
+	if err != nil {
+		return err
+	}
+
+	// .zip 为题目文件加图片的压缩包：解析其中的题目文件，引用的图片保存为题库的媒体文件
+	committed := false
+	var bundle *zipBundle
+	if strings.ToLower(filepath.Ext(fileName)) == ".zip" {
+		bundle, err = openZipBundle(file, size, exec, bankID)
+		if err != nil {
+			return &importError{status: http.StatusBadRequest, message: err.Error()}
+		}
+		defer func() { bundle.close(committed) }()
+
+		file, fileName, size = bundle.temp, bundle.manifest, bundle.manifestSize()
+		importer.prepare = bundle.rewriteQuestion
+	}
+
+	emit := importer.add
+	if progress != nil {
+		// 出错和跳过的行同样计入，全部出错的文件也能看到进度
+		lastRows, lastTime := 0, time.Now()
+		tick := func() {
+			if report.Total-lastRows < importBatchSize && time.Since(lastTime) < importProgressInterval {
+				return
+			}
+			lastRows, lastTime = report.Total, time.Now()
+			progress()
+		}
+		report.onRow = tick
+		emit = func(q Question) error {
+			if err := importer.add(q); err != nil {
+				return err
+			}
+			tick()
+			return nil
+		}
+	}
+
+	err = parseUploadedFile(file, fileName, size, opts, report, emit)
+	if err == nil {
+		err = importer.flush()
+	}
+	if importer.err != nil {
+		return importer.err
+	}
+	if bundle != nil && bundle.err != nil {
+		return bundle.err
+	}
+	if err != nil {
+		return &importError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	report.Duplicates = importer.summary
+
+	if opts.DryRun {
+		return nil
+	}
+	if report.Errors > 0 && !opts.SkipInvalid {
+		return &importError{
+			status:  http.StatusBadRequest,
+			message: fmt.Sprintf("%d 行未通过校验，未导入任何题目", report.Errors),
+			report:  report,
+		}
+	}
+	if report.Accepted == 0 {
+		return &importError{status: http.StatusBadRequest, message: "未找到有效的题目数据", report: report}
+	}
+	report.Imported, report.Updated = importer.imported, importer.updated
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction")
+	}
+	defer tx.Rollback()
+	if err := spool.replay(tx); err != nil {
+		return fmt.Errorf("题目写入失败: %v", err)
+	}
+	if beforeCommit != nil {
+		if err := beforeCommit(tx); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit transaction")
+	}
+	committed = true
+	return nil
+}
+
+// 解析阶段记录的写入语句，保存在临时文件中，内存中不保留已解析的题目
+type importSpool struct {
+	file  *os.File
+	buf   *bufio.Writer
+	enc   *gob.Encoder
+	count int
+}
+
+type spooledStatement struct {
+	Query string
+	Args  []interface{}
+}
+
+func newImportSpool() (*importSpool, error) {
+	file, err := os.CreateTemp("", "import_spool_*")
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	return &importSpool{file: file, buf: buf, enc: gob.NewEncoder(buf)}, nil
+}
+
+// 记录一条写入语句，在 replay 时执行；没有可用的执行结果
+func (s *importSpool) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if err := s.enc.Encode(spooledStatement{Query: query, Args: args}); err != nil {
+		return nil, err
+	}
+	s.count++
+	return driver.ResultNoRows, nil
+}
+
+// 按记录的顺序在事务中执行全部语句
+func (s *importSpool) replay(tx *sql.Tx) error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dec := gob.NewDecoder(bufio.NewReader(s.file))
+	for i := 0; i < s.count; i++ {
+		var statement spooledStatement
+		if err := dec.Decode(&statement); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(statement.Query, statement.Args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *importSpool) close() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+func importMessage(report *ImportReport) string {
+	return fmt.Sprintf("成功导入 %d 道题目到题库，更新 %d 道，跳过重复 %d 道",
+		report.Imported, report.Updated, report.Duplicates.Skipped)
+}
+
+// 边解析边写入的导入器：每道通过校验的题目按重复策略决定插入、覆盖或跳过，
+// 新题目攒满一批后用一条多行 INSERT 写入，内存中只保留去重键和当前批次
+type questionImporter struct {
+	exec   execer // runImport 中为 importSpool；为 nil 时（dryRun）只统计重复题目，不写入
+	bankID string
+	policy string
+
+	// 写入前对题目的处理（如改写压缩包中的图片引用），重复而跳过的题目不会调用
+	prepare func(*Question) error
+
+	targets      map[string]duplicateTarget
+	pending      []Question
+	pendingIDs   []string
+	pendingIndex map[string]int // 待写入题目的 ID 在当前批次中的位置
+
+	summary  *DuplicateSummary
+	imported int
+	updated  int
+	err      error // 写入数据库失败时的错误，之后的题目不再处理
+}
+
+func newQuestionImporter(exec execer, bankID, policy string) (*questionImporter, error) {
+	targets, err := loadDuplicateTargets(bankID)
+	if err != nil {
+		return nil, err
+	}
+	return &questionImporter{
+		exec:         exec,
+		bankID:       bankID,
+		policy:       policy,
+		targets:      targets,
+		pendingIndex: make(map[string]int),
+		summary:      &DuplicateSummary{Policy: policy},
+	}, nil
+}
+
+// 处理一道通过校验的题目。与题库中已有题目或文件中先出现的题目重复时按策略处理，
+// overwrite 策略下文件内的重复题目以最后出现的为准
+func (im *questionImporter) add(q Question) error {
+	if im.err != nil {
+		return im.err
+	}
+
+	key := duplicateKey(q)
+	target, duplicated := im.targets[key]
+	if duplicated && im.policy == duplicateSkip {
+		im.summary.Found++
+		im.summary.Skipped++
+		return nil
+	}
+	// 媒体引用无效的题目不计入重复统计
+	if err := im.prepareQuestion(&q); err != nil {
+		return err
+	}
+	if duplicated {
+		im.summary.Found++
+		if im.policy == duplicateOverwrite {
+			im.summary.Overwritten++
+			im.err = im.overwrite(target, q)
+			return im.err
+		}
+		im.summary.Kept++
+	}
+
+	questionID := generateUUID()
+	if !duplicated {
+		im.targets[key] = duplicateTarget{id: questionID, fromFile: true}
+	}
+	im.pendingIndex[questionID] = len(im.pending)
+	im.pending = append(im.pending, q)
+	im.pendingIDs = append(im.pendingIDs, questionID)
+
+	if len(im.pending) >= importBatchSize {
+		im.err = im.flush()
+	}
+	return im.err
+}
+
+// 检查题目引用的媒体文件（JSON 导入时可带 media 字段）并执行 prepare。
+// 引用的文件不存在时返回 *rowError，只有这一行导入失败
+func (im *questionImporter) prepareQuestion(q *Question) error {
+	if err := attachMediaRefs(im.bankID, q.Media); err != nil {
+		var missing *missingMediaError
+		if errors.As(err, &missing) {
+			return &rowError{reason: err.Error()}
+		}
+		return err
+	}
+	if im.prepare == nil {
+		return nil
+	}
+	return im.prepare(q)
+}
+
+// 覆盖重复的目标题目：本次导入中尚未写入的直接替换，已写入的或题库中已有的执行更新
+func (im *questionImporter) overwrite(target duplicateTarget, q Question) error {
+	if i, ok := im.pendingIndex[target.id]; ok {
+		im.pending[i] = q
+		return nil
+	}
+	if im.exec == nil {
+		return nil
+	}
+
+	if err := updateQuestionRow(im.exec, target.id, q); err != nil {
+		return fmt.Errorf("题目更新失败: %v", err)
+	}
+	if !target.fromFile {
+		im.updated++
+	}
+	return nil
+}
+
+// 写入当前批次的题目
+func (im *questionImporter) flush() error {
+	if len(im.pending) == 0 {
+		return nil
+	}
+	if im.exec != nil {
+		if err := insertQuestions(im.exec, im.bankID, im.pendingIDs, im.pending); err != nil {
+			return fmt.Errorf("题目写入失败: %v", err)
+		}
+		im.imported += len(im.pending)
+	}
+
+	im.pending = im.pending[:0]
+	im.pendingIDs = im.pendingIDs[:0]
+	im.pendingIndex = make(map[string]int)
+	return nil
+}
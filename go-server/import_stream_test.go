@@ -0,0 +1,335 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 生成 CSV 导入文件，valid 行正确，invalid 行的答案不存在
+func writeTestCSV(t *testing.T, valid, invalid int) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("题目,选项A,选项B,正确答案\n")
+	for i := 0; i < valid; i++ {
+		fmt.Fprintf(&b, "第 %d 题,是,否,A\n", i)
+	}
+	for i := 0; i < invalid; i++ {
+		fmt.Fprintf(&b, "错误 %d 题,是,否,Z\n", i)
+	}
+	path := filepath.Join(t.TempDir(), "q.csv")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunImportReportsProgressByRows(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, nil)
+
+	tests := []struct {
+		name         string
+		valid        int
+		invalid      int
+		wantProgress int
+	}{
+		{"accepted rows", 1200, 0, 2},
+		{"error rows", 0, 1200, 2},
+		{"mixed rows", 300, 300, 1},
+		{"small file", 10, 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Open(writeTestCSV(t, tt.valid, tt.invalid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			report := &ImportReport{Rows: []ImportRowResult{}}
+			calls := 0
+			err = runImport(bankID, file, "q.csv", 0, importOptions{DryRun: true}, report, func() { calls++ }, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Accepted != tt.valid || report.Errors != tt.invalid {
+				t.Fatalf("accepted %d errors %d, want %d %d", report.Accepted, report.Errors, tt.valid, tt.invalid)
+			}
+			// 测试在 1 秒内完成，只有按行数触发的进度
+			if calls != tt.wantProgress {
+				t.Errorf("progress called %d times, want %d", calls, tt.wantProgress)
+			}
+		})
+	}
+}
+
+// 上传题库文件，fields 为其他表单字段
+func uploadTestBankFile(t *testing.T, r http.Handler, token, bankID, fileName string, content []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, _ := form.CreateFormFile("file", fileName)
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/question-banks/"+bankID+"/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// 引用不存在的媒体文件只影响所在的行，其他行照常导入
+func TestImportInvalidMediaIsRowError(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, nil)
+	mediaID := uploadTestMedia(t, r, token, bankID, "a.png", []byte("\x89PNG\r\n\x1a\n"))
+
+	jsonFile, _ := json.Marshal(gin.H{"questions": []Question{
+		{Question: "有图", Options: []string{"1", "2"}, Media: []MediaRef{{ID: mediaID}}},
+		{Question: "图不存在", Options: []string{"1", "2"}, Media: []MediaRef{{ID: "missing"}}},
+		{Question: "无图", Options: []string{"1", "2"}},
+	}})
+	csvFile := fmt.Sprintf("题目,选项A,选项B,正确答案,媒体\n有图,1,2,A,\"[{\"\"id\"\":\"\"%s\"\"}]\"\n图不存在,1,2,A,\"[{\"\"id\"\":\"\"missing\"\"}]\"\n无图,1,2,A,\n", mediaID)
+
+	var zipFile bytes.Buffer
+	zw := zip.NewWriter(&zipFile)
+	manifest, _ := zw.Create("q.csv")
+	manifest.Write([]byte("题目,选项A,选项B,正确答案\n\"有图![](a.png)\",1,2,A\n\"图不存在![](missing.png)\",1,2,A\n无图,1,2,A\n"))
+	image, _ := zw.Create("a.png")
+	image.Write([]byte("\x89PNG\r\n\x1a\n"))
+	zw.Close()
+
+	tests := []struct {
+		fileName    string
+		content     []byte
+		skipInvalid bool
+		dryRun      bool
+		wantStatus  int
+	}{
+		{"q.json", jsonFile, true, true, http.StatusOK},
+		{"q.json", jsonFile, false, false, http.StatusBadRequest},
+		{"q.csv", []byte(csvFile), true, true, http.StatusOK},
+		{"q.csv", []byte(csvFile), false, false, http.StatusBadRequest},
+		{"q.zip", zipFile.Bytes(), true, true, http.StatusOK},
+		{"q.zip", zipFile.Bytes(), false, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s skipInvalid=%v", tt.fileName, tt.skipInvalid), func(t *testing.T) {
+			w := uploadTestBankFile(t, r, token, bankID, tt.fileName, tt.content,
+				map[string]string{"skipInvalid": fmt.Sprint(tt.skipInvalid), "dryRun": fmt.Sprint(tt.dryRun)})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var resp struct {
+				Report ImportReport `json:"report"`
+			}
+			decodeBody(t, w, &resp)
+			if resp.Report.Accepted != 2 || resp.Report.Errors != 1 {
+				t.Fatalf("accepted %d errors %d, want 2 1: %+v", resp.Report.Accepted, resp.Report.Errors, resp.Report.Rows)
+			}
+			row := resp.Report.Rows[1]
+			if row.Status != importRowError || !strings.Contains(row.Reason, "missing") {
+				t.Errorf("row 2 = %+v, want media error", row)
+			}
+		})
+	}
+}
+
+// 压缩包中的图片导入后，按前端的方式显示：取渲染后 HTML 中 <img> 的地址，不带认证头读取
+func TestZipImportedImagesLoadFromRenderedContent(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, nil)
+
+	images := map[string][]byte{
+		"img/a.png": []byte("\x89PNG\r\n\x1a\nquestion image"),
+		"img/b.png": []byte("\x89PNG\r\n\x1a\noption image"),
+	}
+	var zipFile bytes.Buffer
+	zw := zip.NewWriter(&zipFile)
+	manifest, _ := zw.Create("q.csv")
+	manifest.Write([]byte("题目,选项A,选项B,正确答案\n\"看图![图](img/a.png)\",\"<img src=\"\"img/b.png\"\">\",2,A\n"))
+	for name, data := range images {
+		f, _ := zw.Create(name)
+		f.Write(data)
+	}
+	zw.Close()
+
+	if w := uploadTestBankFile(t, r, token, bankID, "q.zip", zipFile.Bytes(), nil); w.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", w.Code, w.Body.String())
+	}
+
+	// 题目内容中保存不带签名的地址，纯文本题目改为 markdown 才能显示图片
+	w := doJSON(r, "GET", "/api/question-banks/"+bankID+"/questions?mode=manage", token, nil)
+	var stored []Question
+	decodeBody(t, w, &stored)
+	if len(stored) != 1 || stored[0].Format != contentFormatMarkdown ||
+		!strings.Contains(stored[0].Question, "](/api/media/") || strings.Contains(stored[0].Question, "sig=") {
+		t.Fatalf("stored questions = %+v", stored)
+	}
+
+	_, questions := startTestSession(t, r, token, bankID, viewModeExam)
+	if len(questions) != 1 {
+		t.Fatalf("session questions = %+v", questions)
+	}
+	tests := []struct {
+		name     string
+		rendered string
+		want     []byte
+	}{
+		{"markdown image in question", questions[0].Rendered.Question, images["img/a.png"]},
+		{"html image in option", questions[0].Rendered.Options[0], images["img/b.png"]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := renderedImageSrc(t, tt.rendered)
+			w := doJSON(r, "GET", src, "", nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d: %s", src, w.Code, w.Body.String())
+			}
+			if !bytes.Equal(w.Body.Bytes(), tt.want) {
+				t.Errorf("body = %q, want %q", w.Body.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+// 解析阶段不持有写事务：解析过程中其他请求可以正常写入，导入的题目在解析完成后一次写入
+func TestRunImportDoesNotBlockWritersWhileParsing(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, nil)
+
+	file, err := os.Open(writeTestCSV(t, 1200, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report := &ImportReport{Rows: []ImportRowResult{}}
+	calls := 0
+	err = runImport(bankID, file, "q.csv", 0, importOptions{}, report, func() {
+		calls++
+		// 导入持有写事务时，SQLite 的其他写入要等到事务结束
+		done := make(chan error, 1)
+		go func() {
+			_, err := db.Exec("UPDATE question_banks SET description = ? WHERE id = ?", fmt.Sprint(calls), bankID)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("write during parse: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("write during parse blocked")
+		}
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM questions WHERE bank_id = ?", bankID).Scan(&count); err != nil || count != 0 {
+			t.Errorf("questions during parse = %d, %v, want 0", count, err)
+		}
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 {
+		t.Fatal("progress not called")
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM questions WHERE bank_id = ?", bankID).Scan(&count); err != nil || count != 1200 {
+		t.Errorf("imported %d questions, %v, want 1200", count, err)
+	}
+}
+
+// 重复题目：第一行与题库中已有题目只差空白，后两行在文件内互相重复
+func TestUploadDuplicatePolicies(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	csvFile := []byte("题目,选项A,选项B,正确答案,解析\n1  +  1 = ?,2,3,A,改过\n新题,是,否,A,\n新题,是,否,B,后出现\n")
+
+	tests := []struct {
+		policy       string
+		want         DuplicateSummary
+		wantImported int
+		wantUpdated  int
+		wantStored   int
+		wantExplains []string // 与已有题目重复的各题的解析
+		wantAnswers  []int    // 新题各副本的答案
+	}{
+		{duplicateSkip, DuplicateSummary{Policy: duplicateSkip, Found: 2, Skipped: 2}, 1, 0, 4, []string{""}, []int{0}},
+		{duplicateOverwrite, DuplicateSummary{Policy: duplicateOverwrite, Found: 2, Overwritten: 2}, 1, 1, 4, []string{"改过"}, []int{1}},
+		{duplicateKeep, DuplicateSummary{Policy: duplicateKeep, Found: 2, Kept: 2}, 3, 0, 6, []string{"", "改过"}, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			bankID := createTestBank(t, r, token, sampleQuestions())
+			w := uploadTestBankFile(t, r, token, bankID, "q.csv", csvFile, map[string]string{"duplicates": tt.policy})
+			if w.Code != http.StatusOK {
+				t.Fatalf("upload: %d %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Duplicates DuplicateSummary `json:"duplicates"`
+				Report     ImportReport     `json:"report"`
+			}
+			decodeBody(t, w, &resp)
+			if resp.Duplicates != tt.want {
+				t.Errorf("duplicates = %+v, want %+v", resp.Duplicates, tt.want)
+			}
+			if resp.Report.Imported != tt.wantImported || resp.Report.Updated != tt.wantUpdated {
+				t.Errorf("imported %d updated %d, want %d %d", resp.Report.Imported, resp.Report.Updated, tt.wantImported, tt.wantUpdated)
+			}
+			if n := bankQuestionCount(t, bankID); n != tt.wantStored {
+				t.Fatalf("stored %d questions, want %d", n, tt.wantStored)
+			}
+
+			w = doJSON(r, "GET", "/api/question-banks/"+bankID+"/questions?mode=manage", token, nil)
+			var questions []Question
+			decodeBody(t, w, &questions)
+			var explains []string
+			var answers []int
+			for _, q := range questions {
+				switch normalizeText(q.Question) {
+				case "1 + 1 = ?":
+					explains = append(explains, q.Explanation)
+				case "新题":
+					answers = append(answers, q.Answer)
+				}
+			}
+			sort.Strings(explains)
+			sort.Ints(answers)
+			if !reflect.DeepEqual(explains, tt.wantExplains) {
+				t.Errorf("explanations = %q, want %q", explains, tt.wantExplains)
+			}
+			if !reflect.DeepEqual(answers, tt.wantAnswers) {
+				t.Errorf("new question answers = %v, want %v", answers, tt.wantAnswers)
+			}
+		})
+	}
+
+	bankID := createTestBank(t, r, token, nil)
+	if w := uploadTestBankFile(t, r, token, bankID, "q.csv", csvFile, map[string]string{"duplicates": "merge"}); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown policy: %d, want 400", w.Code)
+	}
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
@@ -23,6 +26,7 @@ type User struct {
 	Password  string    `json:"-" db:"password"`
 	Email     string    `json:"email" db:"email"`
 	IsAdmin   bool      `json:"is_admin" db:"is_admin"`
+	Disabled  bool      `json:"disabled" db:"disabled"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -37,25 +41,56 @@ type QuestionBank struct {
 }
 
 type Question struct {
-	ID          string   `json:"id" db:"id"`
-	BankID      string   `json:"bank_id" db:"bank_id"`
-	Question    string   `json:"question" db:"question"`
-	Options     []string `json:"options" db:"options"`
-	Answer      int      `json:"answer" db:"answer"`
-	Explanation string   `json:"explanation" db:"explanation"`
+	ID              string           `json:"id" db:"id"`
+	BankID          string           `json:"bank_id" db:"bank_id"`
+	Type            string           `json:"type" db:"type"`
+	Question        string           `json:"question" db:"question"`
+	Options         []string         `json:"options" db:"options"`
+	Answer          int              `json:"answer" db:"answer"`
+	Answers         []int            `json:"answers,omitempty" db:"answers"`           // 多选题的全部正确选项
+	Blanks          [][]string       `json:"blanks,omitempty" db:"accepted"`           // 填空题每个空可接受的答案
+	AcceptedAnswers []string         `json:"accepted_answers,omitempty" db:"accepted"` // 简答题可接受的答案
+	Explanation     string           `json:"explanation" db:"explanation"`
+	Chapter         string           `json:"chapter,omitempty" db:"chapter"` // 所属章节，多工作表导入时为工作表名称
+	Media           []MediaRef       `json:"media,omitempty" db:"media"`     // 题干、选项和解析附带的媒体文件
+	Format          string           `json:"format,omitempty" db:"format"`   // 内容格式：plain（默认）或 markdown
+	Rendered        *RenderedContent `json:"rendered,omitempty"`             // 渲染后的 HTML，只在返回给客户端时生成
+}
+
+// 按内容格式渲染并过滤后的 HTML，公式保留原文和定界符
+type RenderedContent struct {
+	Question    string   `json:"question"`
+	Options     []string `json:"options"`
+	Explanation string   `json:"explanation,omitempty"`
+}
+
+// 题目对题库媒体文件的引用，content_type 和 file_name 在保存时从 media 表补全，url 在读取时生成
+type MediaRef struct {
+	ID          string `json:"id"`
+	Target      string `json:"target"` // question（题干，默认）、option（选项）或 explanation（解析）
+	Option      int    `json:"option"` // target 为 option 时的选项序号，从 0 开始
+	ContentType string `json:"content_type,omitempty"`
+	FileName    string `json:"file_name,omitempty"`
+	URL         string `json:"url,omitempty"`
 }
 
 type WrongQuestion struct {
-	ID          string    `json:"id" db:"id"`
-	UserID      string    `json:"user_id" db:"user_id"`
-	BankID      string    `json:"bank_id" db:"bank_id"`
-	QuestionID  string    `json:"question_id" db:"question_id"`
-	Question    string    `json:"question" db:"question"`
-	Options     []string  `json:"options" db:"options"`
-	Answer      int       `json:"answer" db:"answer"`
-	Explanation string    `json:"explanation" db:"explanation"`
-	BankName    string    `json:"bank_name" db:"bank_name"`
-	AddedAt     time.Time `json:"added_at" db:"added_at"`
+	ID              string           `json:"id" db:"id"`
+	UserID          string           `json:"user_id" db:"user_id"`
+	BankID          string           `json:"bank_id" db:"bank_id"`
+	QuestionID      string           `json:"question_id" db:"question_id"`
+	Type            string           `json:"type" db:"type"`
+	Question        string           `json:"question" db:"question"`
+	Options         []string         `json:"options" db:"options"`
+	Answer          int              `json:"answer" db:"answer"`
+	Answers         []int            `json:"answers,omitempty" db:"answers"`
+	Blanks          [][]string       `json:"blanks,omitempty" db:"accepted"`
+	AcceptedAnswers []string         `json:"accepted_answers,omitempty" db:"accepted"`
+	Explanation     string           `json:"explanation" db:"explanation"`
+	Format          string           `json:"format" db:"format"`
+	Rendered        *RenderedContent `json:"rendered,omitempty"`
+	BankName        string           `json:"bank_name" db:"bank_name"`
+	AddedAt         time.Time        `json:"added_at" db:"added_at"`
 }
 
 type ExamResult struct {
@@ -67,9 +102,173 @@ type ExamResult struct {
 	WrongCount     int       `json:"wrong_count" db:"wrong_count"`
 	TotalQuestions int       `json:"total_questions" db:"total_questions"`
 	TotalTime      int       `json:"total_time" db:"total_time"`
+	SessionID      string    `json:"session_id,omitempty" db:"session_id"`
+	BankName       string    `json:"bank_name,omitempty" db:"bank_name"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
+// 考试会话：题目与答案保存在服务端，提交时由服务端判分
+type ExamSession struct {
+	ID          string                 `json:"id" db:"id"`
+	UserID      string                 `json:"user_id" db:"user_id"`
+	BankID      string                 `json:"bank_id" db:"bank_id"`
+	Status      string                 `json:"status" db:"status"`
+	Mode        string                 `json:"mode" db:"mode"`
+	ScoringMode string                 `json:"scoring_mode" db:"scoring_mode"`
+	TimeLimit   int                    `json:"time_limit" db:"time_limit"` // 分钟，0 不限时
+	Deadline    *time.Time             `json:"deadline,omitempty"`
+	QuestionIDs []string               `json:"question_ids" db:"question_ids"`
+	ResultID    string                 `json:"result_id,omitempty" db:"result_id"`
+	StartedAt   time.Time              `json:"started_at" db:"started_at"`
+	SubmittedAt *time.Time             `json:"submitted_at,omitempty" db:"submitted_at"`
+	Questions   []ExamQuestion         `json:"questions,omitempty"`
+	Answers     map[string]AnswerValue `json:"answers"`
+	timeSpent   map[string]int
+}
+
+// 单题作答记录，用于考后复盘
+type ExamAnswer struct {
+	ResultID        string           `json:"result_id" db:"result_id"`
+	QuestionID      string           `json:"question_id" db:"question_id"`
+	Position        int              `json:"position" db:"position"`
+	Chosen          AnswerValue      `json:"chosen" db:"chosen"`
+	Correct         bool             `json:"correct" db:"correct"`
+	Credit          float64          `json:"credit" db:"credit"`
+	TimeSpent       int              `json:"time_spent" db:"time_spent"`
+	Type            string           `json:"type"`
+	Question        string           `json:"question"`
+	Options         []string         `json:"options"`
+	Answer          []int            `json:"answer"`
+	Blanks          [][]string       `json:"blanks,omitempty"`
+	AcceptedAnswers []string         `json:"accepted_answers,omitempty"`
+	Explanation     string           `json:"explanation"`
+	Format          string           `json:"format,omitempty"`
+	Rendered        *RenderedContent `json:"rendered,omitempty"`
+}
+
+// 考试中下发给客户端的题目（不含答案和解析）
+type ExamQuestion struct {
+	ID         string           `json:"id"`
+	BankID     string           `json:"bank_id"`
+	Type       string           `json:"type"`
+	Question   string           `json:"question"`
+	Options    []string         `json:"options"`
+	Multiple   bool             `json:"multiple"`
+	BlankCount int              `json:"blank_count,omitempty"`
+	Chapter    string           `json:"chapter,omitempty"`
+	Media      []MediaRef       `json:"media,omitempty"` // 不含解析的媒体，解析的媒体随答案揭晓
+	Format     string           `json:"format"`
+	Rendered   *RenderedContent `json:"rendered,omitempty"` // 不含解析
+}
+
+// 作答后或交卷后揭晓的答案与解析
+type RevealedAnswer struct {
+	QuestionID       string      `json:"question_id"`
+	Answer           int         `json:"answer"`
+	Answers          []int       `json:"answers,omitempty"`
+	Blanks           [][]string  `json:"blanks,omitempty"`
+	AcceptedAnswers  []string    `json:"accepted_answers,omitempty"`
+	Explanation      string      `json:"explanation"`
+	ExplanationHTML  string      `json:"explanation_html,omitempty"`
+	ExplanationMedia []MediaRef  `json:"explanation_media,omitempty"`
+	YourAnswer       AnswerValue `json:"your_answer"`
+	Correct          bool        `json:"correct"`
+	Credit           float64     `json:"credit"`
+}
+
+// 导入报告中单行（JSON 为单题）的处理结果
+type ImportRowResult struct {
+	Sheet    string `json:"sheet,omitempty"` // 多工作表导入时的工作表名称
+	Row      int    `json:"row"`
+	Status   string `json:"status"` // accepted / skipped / error
+	Reason   string `json:"reason,omitempty"`
+	Question string `json:"question,omitempty"`
+}
+
+// 文件导入报告
+type ImportReport struct {
+	Total    int `json:"total"`
+	Accepted int `json:"accepted"`
+	Skipped  int `json:"skipped"`
+	Errors   int `json:"errors"`
+	Imported int `json:"imported"`
+	Updated  int `json:"updated"`
+	// 与题库中已有题目或文件中其他题目重复的统计
+	Duplicates *DuplicateSummary `json:"duplicates,omitempty"`
+	Rows       []ImportRowResult `json:"rows"`
+	// 行数超过上限时为 true，rows 只包含前面的部分行，计数仍包含全部行
+	Truncated bool `json:"truncated,omitempty"`
+
+	sheet string // 正在解析的工作表，多工作表导入时记入每一行
+	onRow func() // 每记录一行后调用，用于报告进度
+}
+
+// 重复题目的处理统计
+type DuplicateSummary struct {
+	Policy      string `json:"policy"`
+	Found       int    `json:"found"`
+	Skipped     int    `json:"skipped"`
+	Overwritten int    `json:"overwritten"`
+	Kept        int    `json:"kept"`
+}
+
+// 表格导入的列映射与分隔符，列按表头名称指定（忽略大小写和空白）
+type ImportMapping struct {
+	QuestionColumn       string   `json:"question_column"`
+	TypeColumn           string   `json:"type_column,omitempty"`
+	OptionColumns        []string `json:"option_columns,omitempty"`   // 每个选项单独一列，按顺序对应 A、B、C…
+	OptionsColumn        string   `json:"options_column,omitempty"`   // 所有选项写在同一个单元格中
+	OptionDelimiter      string   `json:"option_delimiter,omitempty"` // 同一单元格中选项的分隔符，默认 "|"
+	AnswerColumn         string   `json:"answer_column"`
+	AnswerDelimiter      string   `json:"answer_delimiter,omitempty"`      // 多选题答案的分隔符，默认自动识别
+	BlankDelimiter       string   `json:"blank_delimiter,omitempty"`       // 填空题各空之间的分隔符，默认 ";"
+	AlternativeDelimiter string   `json:"alternative_delimiter,omitempty"` // 多个可接受答案之间的分隔符，默认 "|"
+	ExplanationColumn    string   `json:"explanation_column,omitempty"`
+	ChapterColumn        string   `json:"chapter_column,omitempty"`
+	FormatColumn         string   `json:"format_column,omitempty"`
+	MediaColumn          string   `json:"media_column,omitempty"`  // 导出文件中的媒体列，JSON 数组
+	CSVDelimiter         string   `json:"csv_delimiter,omitempty"` // CSV 字段分隔符，默认 ","
+}
+
+// 用户保存的导入配置
+type ImportProfile struct {
+	ID        string        `json:"id" db:"id"`
+	UserID    string        `json:"user_id" db:"user_id"`
+	Name      string        `json:"name" db:"name"`
+	Mapping   ImportMapping `json:"mapping" db:"mapping"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// 异步导入任务
+type ImportJob struct {
+	ID         string        `json:"id" db:"id"`
+	UserID     string        `json:"user_id" db:"user_id"`
+	BankID     string        `json:"bank_id" db:"bank_id"`
+	FileName   string        `json:"file_name" db:"file_name"`
+	FileSize   int64         `json:"file_size" db:"file_size"`
+	Status     string        `json:"status" db:"status"`       // queued / running / succeeded / failed
+	Processed  int           `json:"processed" db:"processed"` // 已通过校验的行数
+	Report     *ImportReport `json:"report,omitempty" db:"report"`
+	Message    string        `json:"message,omitempty" db:"message"`
+	Error      string        `json:"error,omitempty" db:"error"`
+	CreatedAt  time.Time     `json:"created_at" db:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// 题库中的媒体文件（如压缩包导入的图片），通过 URL 在题目内容中引用
+type MediaFile struct {
+	ID          string    `json:"id" db:"id"`
+	BankID      string    `json:"bank_id" db:"bank_id"`
+	FileName    string    `json:"file_name" db:"file_name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	URL         string    `json:"url"`                  // 在题目内容中引用的地址
+	SignedURL   string    `json:"signed_url,omitempty"` // 浏览器直接加载的签名地址，见 signedMediaURL
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	storageKey  string
+}
+
 type ExamStats struct {
 	TotalExams             int     `json:"total_exams"`
 	AvgScore               float64 `json:"avg_score"`
@@ -79,33 +278,37 @@ type ExamStats struct {
 
 // JWT Claims
 type Claims struct {
-	UserID   string `json:"userId"`
-	Username string `json:"username"`
+	UserID       string `json:"userId"`
+	Username     string `json:"username"`
+	TokenVersion int    `json:"ver"` // 签发时用户的令牌版本，与数据库中不一致时令牌失效
 	jwt.RegisteredClaims
 }
 
 // 全局变量
-var (
-	db        *sql.DB
-	jwtSecret = []byte("your-secret-key-change-in-production")
-)
+var db *sql.DB
 
 // 数据库初始化
 func initDB() {
-	var err error
+	openDB()
+
+	// 执行表结构迁移
+	runStartupMigrations()
+
+	// 创建默认管理员账号
+	createDefaultAdmin()
 
-	// MySQL连接配置
-	// 从环境变量获取数据库配置，如果没有则使用默认值
-	dbHost := getEnv("DB_HOST", "gz-cynosdbmysql-grp-37hxchit.sql.tencentcdb.com:24127")
-	dbUser := getEnv("DB_USER", "root")
-	dbPassword := getEnv("DB_PASSWORD", "")
-	dbName := getEnv("DB_NAME", "exam_db")
+	log.Printf("Database initialized successfully (%s)", backend.name())
+}
 
-	// 构建MySQL连接字符串
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		dbUser, dbPassword, dbHost, dbName)
+// 连接数据库，数据库后端由 database.driver 选择，见 storage.go
+func openDB() {
+	var err error
+	backend, err = newDBBackend(cfg.Database)
+	if err != nil {
+		log.Fatal("Invalid database configuration:", err)
+	}
 
-	db, err = sql.Open("mysql", dsn)
+	db, err = backend.open()
 	if err != nil {
 		log.Fatal("Failed to open database:", err)
 	}
@@ -115,14 +318,6 @@ func initDB() {
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
-
-	// 创建表
-	createTables()
-
-	// 创建默认管理员账号
-	createDefaultAdmin()
-
-	log.Println("Database initialized successfully")
 }
 
 // 获取环境变量，如果不存在则返回默认值
@@ -166,130 +361,93 @@ func createDefaultAdmin() {
 	log.Println("Default admin user created successfully")
 }
 
-func createTables() {
-	// 用户表
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS users (
-		id VARCHAR(255) PRIMARY KEY,
-		username VARCHAR(255) UNIQUE NOT NULL,
-		password VARCHAR(255) NOT NULL,
-		email VARCHAR(255),
-		is_admin BOOLEAN DEFAULT 0,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)`)
-	if err != nil {
-		log.Fatal("Failed to create users table:", err)
+// 工具函数
+
+// 生成 UUIDv7（RFC 9562）作为各表的主键：前 48 位为毫秒时间戳，其余为随机数，
+// 按字符串排序即为生成顺序。同一毫秒内生成的 ID 递增 12 位计数器，保证不重复且有序。
+// 早期版本的 ID 为纳秒时间戳的数字字符串，仍然有效，见 README
+func generateUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("crypto/rand unavailable: " + err.Error())
 	}
 
-	// 检查并添加is_admin字段（如果不存在）- MySQL兼容版本
-	var columnExists bool
-	err = db.QueryRow("SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'is_admin'").Scan(&columnExists)
-	if err != nil {
-		log.Printf("Warning: Failed to check if is_admin column exists: %v", err)
-	} else if !columnExists {
-		_, err = db.Exec("ALTER TABLE users ADD COLUMN is_admin BOOLEAN DEFAULT 0")
-		if err != nil {
-			log.Printf("Warning: Failed to add is_admin column: %v", err)
-		} else {
-			log.Println("Successfully added is_admin column to users table")
+	uuidState.Lock()
+	ms := time.Now().UnixMilli()
+	if ms > uuidState.lastMS {
+		uuidState.lastMS = ms
+		// 计数器从随机值开始，最高位为 0，同一毫秒内至少还能生成 2048 个
+		uuidState.seq = uint16(b[6]&0x07)<<8 | uint16(b[7])
+	} else {
+		// 同一毫秒或时钟回拨：沿用上一个时间戳并递增计数器，计数器用尽时借用下一毫秒
+		uuidState.seq++
+		if uuidState.seq > 0xfff {
+			uuidState.lastMS++
+			uuidState.seq = 0
 		}
 	}
+	ms, seq := uuidState.lastMS, uuidState.seq
+	uuidState.Unlock()
 
-	// 题库表
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS question_banks (
-		id VARCHAR(255) PRIMARY KEY,
-		user_id VARCHAR(255) NOT NULL,
-		name VARCHAR(255) NOT NULL,
-		description TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
-	)`)
-	if err != nil {
-		log.Fatal("Failed to create question_banks table:", err)
-	}
-
-	// 题目表
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS questions (
-		id VARCHAR(255) PRIMARY KEY,
-		bank_id VARCHAR(255) NOT NULL,
-		question TEXT NOT NULL,
-		options JSON NOT NULL,
-		answer INT NOT NULL,
-		explanation TEXT,
-		FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
-	)`)
-	if err != nil {
-		log.Fatal("Failed to create questions table:", err)
-	}
-
-	// 错题表
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS wrong_questions (
-		id VARCHAR(255) PRIMARY KEY,
-		user_id VARCHAR(255) NOT NULL,
-		bank_id VARCHAR(255) NOT NULL,
-		question_id VARCHAR(255) NOT NULL,
-		question TEXT NOT NULL,
-		options JSON NOT NULL,
-		answer INT NOT NULL,
-		explanation TEXT,
-		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
-		FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
-	)`)
-	if err != nil {
-		log.Fatal("Failed to create wrong_questions table:", err)
-	}
-
-	// 考试结果表
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS exam_results (
-		id VARCHAR(255) PRIMARY KEY,
-		user_id VARCHAR(255) NOT NULL,
-		bank_id VARCHAR(255) NOT NULL,
-		score INT NOT NULL,
-		correct_count INT NOT NULL,
-		wrong_count INT NOT NULL,
-		total_questions INT NOT NULL,
-		total_time INT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
-		FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
-	)`)
-	if err != nil {
-		log.Fatal("Failed to create exam_results table:", err)
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
 	}
+	b[6] = 0x70 | byte(seq>>8)
+	b[7] = byte(seq)
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 变体
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
-// 工具函数
-func generateUUID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+var uuidState struct {
+	sync.Mutex
+	lastMS int64
+	seq    uint16
+}
+
+// ID 对应的创建顺序，写入 questions.seq 用于排序：UUIDv7 为毫秒时间戳和 12 位计数器，
+// 早期的数字 ID（纳秒时间戳）换算到同一刻度，因此两种 ID 混在一起也按创建时间排列。其他 ID 返回 0
+func idSequence(id string) int64 {
+	if ns, err := strconv.ParseInt(id, 10, 64); err == nil && ns > 0 {
+		ms, frac := ns/int64(time.Millisecond), ns%int64(time.Millisecond)
+		return ms<<12 | frac*4096/int64(time.Millisecond)
+	}
+	hex := strings.ReplaceAll(id, "-", "")
+	if len(hex) != 32 || hex[12] != '7' {
+		return 0
+	}
+	ms, err := strconv.ParseInt(hex[:12], 16, 64)
+	if err != nil {
+		return 0
+	}
+	counter, err := strconv.ParseInt(hex[13:16], 16, 64)
+	if err != nil {
+		return 0
+	}
+	return ms<<12 | counter
 }
 
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cfg.Auth.BcryptCost)
 	return string(bytes), err
 }
 
 func checkPasswordHash(password, hash string) bool {
-	fmt.Printf("Debug: Comparing password '%s' with hash '%s'\n", password, hash)
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		fmt.Printf("Debug: Password comparison failed: %v\n", err)
-		return false
-	}
-	return true
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
-func generateToken(userID, username string) (string, error) {
-	expirationTime := time.Now().Add(7 * 24 * time.Hour)
+func generateToken(userID, username string, tokenVersion int) (string, error) {
+	expirationTime := time.Now().Add(cfg.Auth.TokenTTL)
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:       userID,
+		Username:     username,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString([]byte(cfg.Auth.JWTSecret))
 }
 
 // 中间件
@@ -305,30 +463,55 @@ func authMiddleware() gin.HandlerFunc {
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 		claims := &Claims{}
 
+		// 只接受 HS256 签名，其他算法（包括 none）的令牌在检查 token_version 之前就被拒绝
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+			return []byte(cfg.Auth.JWTSecret), nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
+		// 访问令牌过期返回 401，客户端应使用刷新令牌换取新令牌
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+			c.Abort()
+			return
+		}
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// 用户已删除、令牌版本已变化（退出所有登录）时令牌作废，被禁用的用户拒绝访问
+		var isAdmin, disabled bool
+		var tokenVersion int
+		err = db.QueryRow("SELECT is_admin, disabled, token_version FROM users WHERE id = ?", claims.UserID).
+			Scan(&isAdmin, &disabled, &tokenVersion)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "账号已被禁用"})
+			c.Abort()
+			return
+		}
+		if err == sql.ErrNoRows || tokenVersion != claims.TokenVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("isAdmin", isAdmin)
 		c.Next()
 	}
 }
 
-// 管理员中间件
+// 管理员中间件，需在 authMiddleware 之后使用，管理员身份由 authMiddleware 从数据库读取
 func adminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetString("userID")
-
-		var isAdmin bool
-		err := db.QueryRow("SELECT is_admin FROM users WHERE id = ?", userID).Scan(&isAdmin)
-		if err != nil || !isAdmin {
+		if !c.GetBool("isAdmin") {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
 			c.Abort()
 			return
@@ -351,6 +534,24 @@ func register(c *gin.Context) {
 		return
 	}
 
+	// 系统设置：是否开放注册、用户数上限
+	settings := currentSettings()
+	if !settings.AllowRegistration {
+		c.JSON(http.StatusForbidden, gin.H{"error": "注册已关闭"})
+		return
+	}
+	if settings.MaxUsers > 0 {
+		var userCount int
+		if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&userCount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if userCount >= settings.MaxUsers {
+			c.JSON(http.StatusForbidden, gin.H{"error": "用户数已达上限，暂不开放注册"})
+			return
+		}
+	}
+
 	// 检查用户名是否已存在
 	var exists bool
 	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", req.Username).Scan(&exists)
@@ -370,7 +571,6 @@ func register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
-	fmt.Printf("Debug: Password '%s' hashed to '%s'\n", req.Password, hashedPassword)
 
 	// 创建用户
 	userID := generateUUID()
@@ -381,16 +581,18 @@ func register(c *gin.Context) {
 		return
 	}
 
-	// 生成JWT token
-	token, err := generateToken(userID, req.Username)
+	// 签发访问令牌和刷新令牌
+	tokens, err := issueTokens(db, userID, req.Username, 0, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "User registered successfully",
-		"token":   token,
+		"message":      "User registered successfully",
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
 		"user": gin.H{
 			"id":       userID,
 			"username": req.Username,
@@ -413,8 +615,9 @@ func login(c *gin.Context) {
 	// 查找用户
 	var user User
 	var email sql.NullString
-	err := db.QueryRow("SELECT id, username, password, email, is_admin FROM users WHERE username = ?", req.Username).
-		Scan(&user.ID, &user.Username, &user.Password, &email, &user.IsAdmin)
+	var tokenVersion int
+	err := db.QueryRow("SELECT id, username, password, email, is_admin, disabled, token_version FROM users WHERE username = ?", req.Username).
+		Scan(&user.ID, &user.Username, &user.Password, &email, &user.IsAdmin, &user.Disabled, &tokenVersion)
 	if err != nil {
 		log.Printf("Database query error for user '%s': %v", req.Username, err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
@@ -434,16 +637,26 @@ func login(c *gin.Context) {
 		return
 	}
 
-	// 生成JWT token
-	token, err := generateToken(user.ID, user.Username)
+	if user.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账号已被禁用"})
+		return
+	}
+
+	// 签发访问令牌和刷新令牌，顺带清理该用户已过期的刷新令牌
+	if _, err := db.Exec("DELETE FROM refresh_tokens WHERE user_id = ? AND expires_at < ?", user.ID, backend.timeValue(time.Now())); err != nil {
+		log.Printf("Warning: Failed to clean up expired refresh tokens: %v", err)
+	}
+	tokens, err := issueTokens(db, user.ID, user.Username, tokenVersion, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
+		"message":      "Login successful",
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -458,8 +671,8 @@ func getCurrentUser(c *gin.Context) {
 
 	var user User
 	var email sql.NullString
-	err := db.QueryRow("SELECT id, username, email, is_admin, created_at FROM users WHERE id = ?", userID).
-		Scan(&user.ID, &user.Username, &email, &user.IsAdmin, &user.CreatedAt)
+	err := db.QueryRow("SELECT id, username, email, is_admin, disabled, created_at FROM users WHERE id = ?", userID).
+		Scan(&user.ID, &user.Username, &email, &user.IsAdmin, &user.Disabled, &user.CreatedAt)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -477,7 +690,7 @@ func getCurrentUser(c *gin.Context) {
 
 // 管理员功能处理函数
 func getAllUsers(c *gin.Context) {
-	rows, err := db.Query("SELECT id, username, email, is_admin, created_at FROM users")
+	rows, err := db.Query("SELECT id, username, email, is_admin, disabled, created_at FROM users")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -487,7 +700,7 @@ func getAllUsers(c *gin.Context) {
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.CreatedAt)
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.Disabled, &user.CreatedAt)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user"})
 			return
@@ -523,11 +736,19 @@ func getAllQuestionBanks(c *gin.Context) {
 func deleteUser(c *gin.Context) {
 	userID := c.Param("id")
 
-	_, err := db.Exec("DELETE FROM users WHERE id = ?", userID)
+	// 题库和媒体记录随用户级联删除，存储中的文件需要单独删除
+	mediaKeys, err := userMediaKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	_, err = db.Exec("DELETE FROM users WHERE id = ?", userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
+	deleteMediaFiles(mediaKeys)
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
@@ -535,30 +756,83 @@ func deleteUser(c *gin.Context) {
 func deleteQuestionBankAdmin(c *gin.Context) {
 	bankID := c.Param("id")
 
-	_, err := db.Exec("DELETE FROM question_banks WHERE id = ?", bankID)
+	mediaKeys, err := bankMediaKeys(bankID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question bank"})
 		return
 	}
 
+	_, err = db.Exec("DELETE FROM question_banks WHERE id = ?", bankID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question bank"})
+		return
+	}
+	deleteMediaFiles(mediaKeys)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Question bank deleted successfully"})
 }
 
+// 修改用户的管理员身份和禁用状态，只修改请求中给出的字段。
+// 禁用用户时同时作废其全部登录；取消管理员身份在下一次请求时即生效
 func updateUserAdmin(c *gin.Context) {
 	userID := c.Param("id")
 
 	var req struct {
-		IsAdmin bool `json:"is_admin"`
+		IsAdmin  *bool `json:"is_admin"`
+		Disabled *bool `json:"disabled"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.IsAdmin == nil && req.Disabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "is_admin 或 disabled 至少需要一项"})
+		return
+	}
+	if userID == c.GetString("userID") && ((req.IsAdmin != nil && !*req.IsAdmin) || (req.Disabled != nil && *req.Disabled)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能取消自己的管理员身份或禁用自己"})
+		return
+	}
 
-	_, err := db.Exec("UPDATE users SET is_admin = ? WHERE id = ?", req.IsAdmin, userID)
+	tx, err := db.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if req.IsAdmin != nil {
+		if _, err := tx.Exec("UPDATE users SET is_admin = ? WHERE id = ?", *req.IsAdmin, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+	}
+	if req.Disabled != nil {
+		if _, err := tx.Exec("UPDATE users SET disabled = ? WHERE id = ?", *req.Disabled, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+		if *req.Disabled {
+			if _, err := revokeUserSessions(tx, userID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
 
@@ -614,23 +888,6 @@ func getAdminStats(c *gin.Context) {
 }
 
 // 更新系统设置
-func updateSettings(c *gin.Context) {
-	var settings map[string]interface{}
-	if err := c.ShouldBindJSON(&settings); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
-		return
-	}
-
-	// 这里可以将设置保存到数据库或配置文件中
-	// 当前简单实现：只返回成功
-	// 后续可以添加数据库存储功能
-	
-	c.JSON(http.StatusOK, gin.H{
-		"message": "设置保存成功",
-		"settings": settings,
-	})
-}
-
 func handleOptions(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", "http://localhost:5173")
 	c.Header("Access-Control-Allow-Methods", "POST, OPTIONS")
@@ -644,17 +901,41 @@ func main() {
 		log.Println("Warning: .env file not found, using default values")
 	}
 
+	// 加载配置：配置文件、环境变量和命令行参数
+	config, args, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg = config
+	if cfg.Env != envProduction && cfg.Auth.JWTSecret == defaultJWTSecret {
+		log.Println("Warning: using the default JWT secret, set JWT_SECRET before deploying")
+	}
+
+	// migrate 子命令只执行迁移，不启动服务
+	if len(args) > 0 && args[0] == "migrate" {
+		openDB()
+		defer db.Close()
+		runMigrateCommand(args[1:])
+		return
+	}
+
 	// 初始化数据库
 	initDB()
 	defer db.Close()
 
+	// 初始化媒体存储
+	initMediaStorage()
+
+	// 启动导入任务的后台工作协程，继续执行上次未完成的任务
+	startImportWorkers()
+
 	// 使用setupRoutes()函数设置路由
 	r := setupRoutes()
 
 	// 启动服务器
-	port := ":3005"
-	log.Printf("Server is running on http://localhost%s", port)
-	if err := r.Run(port); err != nil {
+	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	log.Printf("Server is running on http://localhost%s (%s)", addr, cfg.Env)
+	if err := r.Run(addr); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
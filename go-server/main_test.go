@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// UUIDv7 前 48 位的毫秒时间戳
+func uuidMillis(t *testing.T, id string) int64 {
+	t.Helper()
+	ms, err := strconv.ParseInt(strings.ReplaceAll(id, "-", "")[:12], 16, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ms
+}
+
+func TestGenerateUUID(t *testing.T) {
+	now := time.Now().UnixMilli()
+	tests := []struct {
+		name   string
+		lastMS int64
+		seq    uint16
+		count  int
+		// 第一个 ID 的时间戳不早于 minMS，最后一个不晚于 maxMS（为 0 时不检查）
+		minMS int64
+		maxMS int64
+	}{
+		{"fresh state", 0, 0, 1000, now, 0},
+		{"clock moved back", now + 60000, 0, 100, now + 60000, now + 60000},
+		{"counter exhausted borrows next millisecond", now + 60000, 0xffe, 3, now + 60000, now + 60001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uuidState.Lock()
+			uuidState.lastMS, uuidState.seq = tt.lastMS, tt.seq
+			uuidState.Unlock()
+
+			ids := make([]string, tt.count)
+			for i := range ids {
+				ids[i] = generateUUID()
+			}
+			for i, id := range ids {
+				if !uuidV7Pattern.MatchString(id) {
+					t.Fatalf("%q is not a UUIDv7", id)
+				}
+				if i > 0 && id <= ids[i-1] {
+					t.Fatalf("ids not increasing: %q after %q", id, ids[i-1])
+				}
+			}
+			if got := uuidMillis(t, ids[0]); got < tt.minMS {
+				t.Errorf("first timestamp %d, want >= %d", got, tt.minMS)
+			}
+			if got := uuidMillis(t, ids[len(ids)-1]); tt.maxMS != 0 && got > tt.maxMS {
+				t.Errorf("last timestamp %d, want <= %d", got, tt.maxMS)
+			}
+		})
+	}
+
+	// 恢复状态，避免后续测试生成的 ID 都借用未来的时间戳
+	uuidState.Lock()
+	uuidState.lastMS, uuidState.seq = 0, 0
+	uuidState.Unlock()
+}
+
+func TestIDSequence(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want int64
+	}{
+		{"uuidv7", "0192b6e4-5c1a-7b3e-9f2d-6a1c0e8b4d27", 0x0192b6e45c1a<<12 | 0xb3e},
+		{"legacy nanoseconds", "1697000000000500000", 1697000000000<<12 | 2048},
+		{"legacy before uuidv7 of the same era", "1697000000000000000", 1697000000000 << 12},
+		{"uuid of another version", "0192b6e4-5c1a-4b3e-9f2d-6a1c0e8b4d27", 0},
+		{"not an id", "abc", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idSequence(tt.id); got != tt.want {
+				t.Errorf("idSequence(%q) = %d, want %d", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+// 升级前的数字 ID 与 UUIDv7 混在同一题库中时，按创建时间排列，而不是按 ID 的字符串顺序
+func TestQueryQuestionsCreationOrder(t *testing.T) {
+	r := setupTestServer(t)
+	token, _ := registerTestUser(t, r, "alice")
+	bankID := createTestBank(t, r, token, sampleQuestions())
+
+	// 旧版本写入的题目没有 seq，由迁移按 ID 补齐；按字符串排序时 "999…" 会排在 "1697…" 之后
+	legacy := []struct{ id, question string }{
+		{"1697000000000000001", "legacy 2023"},
+		{"999999999000000000", "legacy 2001"},
+	}
+	for _, q := range legacy {
+		_, err := db.Exec("INSERT INTO questions (id, bank_id, type, question, options, answer, explanation) VALUES (?, ?, 'single_choice', ?, '[\"a\",\"b\"]', 0, '')",
+			q.id, bankID, q.question)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := questionSeqUp(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doJSON(r, "POST", "/api/questions", token, Question{BankID: bankID, Type: questionTypeSingle, Question: "added later", Options: []string{"a", "b"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("add question: %d %s", w.Code, w.Body.String())
+	}
+
+	questions, err := queryQuestions("WHERE q.bank_id = ?", bankID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"legacy 2001", "legacy 2023", "1 + 1 = ?", "2 + 2 = ?", "3 + 3 = ?", "added later"}
+	var got []string
+	for _, q := range questions {
+		got = append(got, q.Question)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("questions = %q, want %q", got, want)
+	}
+}
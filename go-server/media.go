@@ -0,0 +1,530 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 媒体文件的存储后端，key 由服务端生成，不含目录
+type mediaStorage interface {
+	// 写入文件，返回写入的字节数
+	Save(key string, r io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// 当前使用的存储后端
+var mediaStore mediaStorage
+
+// 单个媒体文件的大小上限，见配置 upload.max_media_mb（默认 10MB）
+func maxMediaBytes() int64 {
+	return cfg.Upload.MaxMediaMB << 20
+}
+
+// 允许作为图片保存的扩展名
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true}
+
+// 允许上传的媒体扩展名：图片之外还有音频、视频和 PDF
+var mediaExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+	".mp3": true, ".wav": true, ".ogg": true, ".m4a": true,
+	".mp4": true, ".webm": true,
+	".pdf": true,
+}
+
+// 初始化媒体存储。media.storage 为 local（默认）时文件保存在 media.dir（默认 uploads/media），
+// 为 s3 时保存在 S3 兼容的对象存储中
+func initMediaStorage() {
+	switch storage := cfg.Media.Storage; storage {
+	case "local":
+		dir := cfg.Media.Dir
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatal("Failed to create media directory:", err)
+		}
+		mediaStore = localMediaStorage{dir: dir}
+	case "s3":
+		store, err := newS3MediaStorage(cfg.Media.S3)
+		if err != nil {
+			log.Fatal("Failed to configure S3 media storage:", err)
+		}
+		mediaStore = store
+	default:
+		log.Fatalf("Unknown MEDIA_STORAGE: %s", storage)
+	}
+}
+
+// 本地磁盘存储
+type localMediaStorage struct {
+	dir string
+}
+
+func (s localMediaStorage) Save(key string, r io.Reader) (int64, error) {
+	file, err := os.Create(filepath.Join(s.dir, key))
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+func (s localMediaStorage) Open(key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, key))
+}
+
+func (s localMediaStorage) Delete(key string) error {
+	err := os.Remove(filepath.Join(s.dir, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 媒体文件 ID，随机生成，不暴露文件数量和上传顺序
+func newMediaID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// 媒体文件的地址，保存在题目内容中；浏览器直接加载时需要使用 signedMediaURL 生成的带签名地址
+func mediaURL(mediaID string) string {
+	return "/api/media/" + mediaID
+}
+
+// 签名地址的有效期按 mediaURLWindow 对齐，同一窗口内生成的地址相同，便于浏览器缓存；
+// 地址生成后至少 mediaURLWindow 内有效，覆盖最长的考试时间
+const mediaURLWindow = 24 * time.Hour
+
+// 带签名的媒体文件地址：签名包含文件 ID、题库 ID 和过期时间，读取时检查文件属于该题库。
+// 只在已确认调用者可以访问该题库（所有者、管理员或该题库的考试会话）的接口中生成，
+// <img> 等标签不带认证头也能加载
+func signedMediaURL(mediaID, bankID string) string {
+	window := int64(mediaURLWindow / time.Second)
+	expires := strconv.FormatInt((time.Now().Unix()/window+2)*window, 10)
+	return mediaURL(mediaID) + "?bank=" + bankID + "&expires=" + expires + "&sig=" + mediaSignature(mediaID, bankID, expires)
+}
+
+func mediaSignature(mediaID, bankID, expires string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.Auth.JWTSecret))
+	// 加上用途前缀，与使用同一密钥的访问令牌区分
+	mac.Write([]byte("media\x00" + mediaID + "\x00" + bankID + "\x00" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 检查签名地址的参数，过期或签名不符时返回 false
+func validMediaSignature(mediaID, bankID, expires, sig string) bool {
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() >= deadline {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(mediaSignature(mediaID, bankID, expires)))
+}
+
+// 渲染后 HTML 中的媒体地址，连同已有的查询参数（如粘贴进内容的签名地址）
+var mediaURLPattern = regexp.MustCompile(`/api/media/([0-9a-f]{32})(?:\?[^"'\s<>]*)?`)
+
+// 把渲染后 HTML 中的媒体地址换成以 bankID 签名的地址。引用其他题库文件的地址同样会签名，
+// 但读取时文件不属于该题库，返回 404；bankID 为空时去掉签名参数，只保留原始地址
+func signMediaURLs(bankID, rendered string) string {
+	return mediaURLPattern.ReplaceAllStringFunc(rendered, func(match string) string {
+		mediaID := mediaURLPattern.FindStringSubmatch(match)[1]
+		if bankID == "" {
+			return mediaURL(mediaID)
+		}
+		return html.EscapeString(signedMediaURL(mediaID, bankID))
+	})
+}
+
+// 保存属于某个题库的媒体文件并写入 media 表，超过大小上限时返回错误
+func saveMedia(exec execer, bankID, fileName string, r io.Reader) (*MediaFile, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	mediaID, err := newMediaID()
+	if err != nil {
+		return nil, err
+	}
+	key := mediaID + ext
+
+	limit := maxMediaBytes()
+	size, err := mediaStore.Save(key, io.LimitReader(r, limit+1))
+	if err == nil && size > limit {
+		err = fmt.Errorf("文件 %s 超过 %d MB", fileName, limit>>20)
+	}
+	if err != nil {
+		mediaStore.Delete(key)
+		return nil, err
+	}
+
+	_, err = exec.Exec("INSERT INTO media (id, bank_id, file_name, content_type, size, storage_key) VALUES (?, ?, ?, ?, ?, ?)",
+		mediaID, bankID, filepath.Base(fileName), contentType, size, key)
+	if err != nil {
+		mediaStore.Delete(key)
+		return nil, err
+	}
+
+	return &MediaFile{
+		ID:          mediaID,
+		BankID:      bankID,
+		FileName:    filepath.Base(fileName),
+		ContentType: contentType,
+		Size:        size,
+		URL:         mediaURL(mediaID),
+		storageKey:  key,
+	}, nil
+}
+
+// 删除存储中的文件，失败时只记录日志
+func deleteMediaFiles(keys []string) {
+	for _, key := range keys {
+		if err := mediaStore.Delete(key); err != nil {
+			log.Printf("Warning: Failed to delete media file %s: %v", key, err)
+		}
+	}
+}
+
+// 题库中全部媒体文件的存储 key
+func bankMediaKeys(bankID string) ([]string, error) {
+	return queryMediaKeys("SELECT storage_key FROM media WHERE bank_id = ?", bankID)
+}
+
+// 用户全部题库中媒体文件的存储 key
+func userMediaKeys(userID string) ([]string, error) {
+	return queryMediaKeys("SELECT m.storage_key FROM media m JOIN question_banks qb ON m.bank_id = qb.id WHERE qb.user_id = ?", userID)
+}
+
+func queryMediaKeys(query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// 媒体引用的位置
+const (
+	mediaTargetQuestion    = "question"
+	mediaTargetOption      = "option"
+	mediaTargetExplanation = "explanation"
+)
+
+// 校验媒体引用的格式，由 normalizeQuestion 在题型校验之后调用；引用的文件是否存在由 attachMediaRefs 检查
+func normalizeMediaRefs(q *Question) error {
+	if len(q.Media) == 0 {
+		q.Media = nil
+		return nil
+	}
+
+	for i := range q.Media {
+		ref := &q.Media[i]
+		ref.ID = strings.TrimSpace(ref.ID)
+		if ref.ID == "" {
+			return fmt.Errorf("媒体引用缺少文件 ID")
+		}
+		if ref.Target == "" {
+			ref.Target = mediaTargetQuestion
+		}
+		switch ref.Target {
+		case mediaTargetOption:
+			if ref.Option < 0 || ref.Option >= len(q.Options) {
+				return fmt.Errorf("媒体引用的选项序号超出选项范围")
+			}
+		case mediaTargetQuestion, mediaTargetExplanation:
+			ref.Option = 0
+		default:
+			return fmt.Errorf("不支持的媒体引用位置: %s", ref.Target)
+		}
+	}
+	return nil
+}
+
+// 引用的媒体文件不存在或不属于该题库
+type missingMediaError struct {
+	id string
+}
+
+func (e *missingMediaError) Error() string {
+	return "引用的媒体文件不存在或不属于该题库: " + e.id
+}
+
+// 检查引用的媒体文件都属于该题库，并补全文件类型和文件名
+func attachMediaRefs(bankID string, refs []MediaRef) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	args := []interface{}{bankID}
+	placeholders := make([]string, len(refs))
+	for i, ref := range refs {
+		placeholders[i] = "?"
+		args = append(args, ref.ID)
+	}
+	rows, err := db.Query("SELECT id, file_name, content_type FROM media WHERE bank_id = ? AND id IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return fmt.Errorf("查询媒体文件失败: %v", err)
+	}
+	defer rows.Close()
+
+	files := make(map[string]MediaFile)
+	for rows.Next() {
+		var f MediaFile
+		if err := rows.Scan(&f.ID, &f.FileName, &f.ContentType); err != nil {
+			return fmt.Errorf("查询媒体文件失败: %v", err)
+		}
+		files[f.ID] = f
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("查询媒体文件失败: %v", err)
+	}
+
+	for i := range refs {
+		f, ok := files[refs[i].ID]
+		if !ok {
+			return &missingMediaError{id: refs[i].ID}
+		}
+		refs[i].FileName, refs[i].ContentType = f.FileName, f.ContentType
+	}
+	return nil
+}
+
+// 序列化媒体引用，没有引用时存为 NULL；url 不保存，读取时生成
+func marshalMediaRefs(refs []MediaRef) (interface{}, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	stored := make([]MediaRef, len(refs))
+	for i, ref := range refs {
+		ref.URL = ""
+		stored[i] = ref
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func unmarshalMediaRefs(q *Question, mediaJSON sql.NullString) error {
+	if !mediaJSON.Valid {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(mediaJSON.String), &q.Media); err != nil {
+		return fmt.Errorf("Failed to parse media: %v", err)
+	}
+	// 保存时已检查引用的文件属于题目所在的题库
+	for i := range q.Media {
+		q.Media[i].URL = signedMediaURL(q.Media[i].ID, q.BankID)
+	}
+	return nil
+}
+
+// 拆分出解析的媒体引用，答题时只返回题干和选项的媒体
+func splitMediaRefs(refs []MediaRef) (content, explanation []MediaRef) {
+	for _, ref := range refs {
+		if ref.Target == mediaTargetExplanation {
+			explanation = append(explanation, ref)
+		} else {
+			content = append(content, ref)
+		}
+	}
+	return content, explanation
+}
+
+// 上传题库的媒体文件（表单字段 file），上传后可在题目的 media 字段中按 ID 引用，
+// 或在题干、选项和解析中以返回的 url 直接引用
+func uploadBankMedia(c *gin.Context) {
+	userID := c.GetString("userID")
+	bankID := c.Param("id")
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM question_banks WHERE id = ? AND user_id = ?)", bankID, userID).Scan(&exists)
+	if err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "题库不存在或无权访问"})
+		return
+	}
+
+	// 表单的其他部分只有文件名等少量内容，额外留出 1MB
+	limit := maxMediaBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("文件大小不能超过 %d MB", limit>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("文件大小不能超过 %d MB", limit>>20)})
+		return
+	}
+	if !mediaExtensions[strings.ToLower(filepath.Ext(header.Filename))] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件格式，仅支持图片（png、jpg、gif、webp）、音频（mp3、wav、ogg、m4a）、视频（mp4、webm）和 PDF"})
+		return
+	}
+
+	media, err := saveMedia(db, bankID, header.Filename, file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败: " + err.Error()})
+		return
+	}
+	media.CreatedAt = time.Now()
+	media.SignedURL = signedMediaURL(media.ID, bankID)
+
+	c.JSON(http.StatusOK, media)
+}
+
+// 获取题库的媒体文件列表
+func getBankMedia(c *gin.Context) {
+	userID := c.GetString("userID")
+	bankID := c.Param("id")
+
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM question_banks WHERE id = ? AND user_id = ?)", bankID, userID).Scan(&exists)
+	if err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "题库不存在或无权访问"})
+		return
+	}
+
+	rows, err := db.Query("SELECT id, bank_id, file_name, content_type, size, created_at FROM media WHERE bank_id = ? ORDER BY created_at DESC", bankID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	files := []MediaFile{}
+	for rows.Next() {
+		var f MediaFile
+		if err := rows.Scan(&f.ID, &f.BankID, &f.FileName, &f.ContentType, &f.Size, &f.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		f.URL, f.SignedURL = mediaURL(f.ID), signedMediaURL(f.ID, bankID)
+		files = append(files, f)
+	}
+
+	c.JSON(http.StatusOK, files)
+}
+
+// 删除媒体文件：题库所有者和管理员可以删除，仍被该题库的题目引用时拒绝删除
+func deleteMedia(c *gin.Context) {
+	userID := c.GetString("userID")
+	mediaID := c.Param("id")
+
+	var bankID, key, ownerID string
+	err := db.QueryRow("SELECT m.bank_id, m.storage_key, qb.user_id FROM media m JOIN question_banks qb ON m.bank_id = qb.id WHERE m.id = ?",
+		mediaID).Scan(&bankID, &key, &ownerID)
+	if err == nil && ownerID != userID && !c.GetBool("isAdmin") {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 引用检查（不用于授权）：media 字段按 ID 查找，题目内容按文件地址查找；媒体 ID 只含十六进制字符，可以直接用于 LIKE
+	idPattern, urlPattern := "%"+mediaID+"%", "%"+mediaURL(mediaID)+"%"
+	var referenced int
+	err = db.QueryRow("SELECT COUNT(*) FROM questions WHERE bank_id = ? AND (media LIKE ? OR question LIKE ? OR options LIKE ? OR explanation LIKE ?)",
+		bankID, idPattern, urlPattern, urlPattern, urlPattern).Scan(&referenced)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if referenced > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("该文件仍被 %d 道题目引用，请先移除引用", referenced)})
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM media WHERE id = ?", mediaID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media"})
+		return
+	}
+	deleteMediaFiles([]string{key})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Media deleted successfully"})
+}
+
+// 读取媒体文件，无需认证头，需要 signedMediaURL 生成的签名地址（bank、expires、sig 参数）。
+// 签名缺失、过期或不符时返回 403；文件不存在或不属于签名中的题库时返回 404
+func serveMedia(c *gin.Context) {
+	mediaID := c.Param("id")
+	bankID := c.Query("bank")
+
+	if !validMediaSignature(mediaID, bankID, c.Query("expires"), c.Query("sig")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "媒体地址无效或已过期"})
+		return
+	}
+
+	var contentType, key string
+	var size int64
+	err := db.QueryRow("SELECT content_type, size, storage_key FROM media WHERE id = ? AND bank_id = ?",
+		mediaID, bankID).Scan(&contentType, &size, &key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, err := mediaStore.Open(key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	defer reader.Close()
+
+	// 签名地址可以缓存到过期时间；private 避免共享缓存保存
+	c.DataFromReader(http.StatusOK, size, contentType, reader, map[string]string{
+		"Cache-Control":          "private, max-age=86400",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 兼容的对象存储（AWS S3、MinIO 等），请求使用 AWS Signature Version 4 签名
+type s3MediaStorage struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	prefix    string // 对象 key 的前缀，如 media/
+	pathStyle bool   // 使用 endpoint/bucket/key 形式的地址（MinIO 需要）
+	client    *http.Client
+}
+
+// 按配置 media.s3 创建：endpoint、bucket、access_key、secret_key 必填，
+// region 默认 us-east-1，path_style 默认 true
+func newS3MediaStorage(c S3Config) (*s3MediaStorage, error) {
+	if c.Endpoint == "" || c.Bucket == "" || c.AccessKey == "" || c.SecretKey == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required")
+	}
+
+	endpointURL, err := url.Parse(c.Endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT: %s", c.Endpoint)
+	}
+
+	prefix := strings.Trim(c.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3MediaStorage{
+		endpoint:  endpointURL,
+		region:    c.Region,
+		bucket:    c.Bucket,
+		accessKey: c.AccessKey,
+		secretKey: c.SecretKey,
+		prefix:    prefix,
+		pathStyle: c.PathStyle,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// 签名需要请求体的 SHA-256，因此先读入内存；调用方已限制了文件大小
+func (s *s3MediaStorage) Save(key string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	header := http.Header{}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(http.MethodPut, key, header, data)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return int64(len(data)), nil
+}
+
+func (s *s3MediaStorage) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// 对象不存在时 S3 同样返回成功
+func (s *s3MediaStorage) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// 发送签名后的请求，非 2xx 响应返回错误，对象不存在时返回 os.ErrNotExist
+func (s *s3MediaStorage) do(method, key string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("S3 %s %s failed: %s %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+}
+
+func (s *s3MediaStorage) objectURL(key string) string {
+	u := *s.endpoint
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/")
+	if s.pathStyle {
+		escaped += "/" + s3EscapePath(s.bucket)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	escaped += "/" + s3EscapePath(s.prefix+key)
+
+	u.Path, _ = url.PathUnescape(escaped)
+	u.RawPath = escaped
+	return u.String()
+}
+
+// 按 SigV4 规则签名：签名的请求头为 Host 和请求中已设置的全部请求头
+func (s *s3MediaStorage) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// S3 要求的 URI 编码：除 A-Z a-z 0-9 - _ . ~ 和路径分隔符 / 外全部编码
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传媒体文件并返回文件 ID
+func uploadTestMedia(t *testing.T, r http.Handler, token, bankID, fileName string, content []byte) string {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", fileName)
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/question-banks/"+bankID+"/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload media: %d %s", w.Code, w.Body.String())
+	}
+	var media MediaFile
+	decodeBody(t, w, &media)
+	return media.ID
+}
+
+// 渲染后 HTML 中 <img> 的地址，与浏览器加载时一致（属性值中的 &amp; 还原为 &）
+var imgSrcPattern = regexp.MustCompile(`<img[^>]* src="([^"]*)"`)
+
+func renderedImageSrc(t *testing.T, rendered string) string {
+	t.Helper()
+	m := imgSrcPattern.FindStringSubmatch(rendered)
+	if m == nil {
+		t.Fatalf("no <img> in %q", rendered)
+	}
+	return html.UnescapeString(m[1])
+}
+
+// 题库的题目（默认不含答案），附带渲染后的 HTML
+func getTestBankQuestions(t *testing.T, r http.Handler, token, bankID string) []ExamQuestion {
+	t.Helper()
+	w := doJSON(r, "GET", "/api/question-banks/"+bankID+"/questions", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get questions: %d %s", w.Code, w.Body.String())
+	}
+	var questions []ExamQuestion
+	decodeBody(t, w, &questions)
+	return questions
+}
+
+func TestServeMediaAccess(t *testing.T) {
+	r := setupTestServer(t)
+	ownerToken, _ := registerTestUser(t, r, "alice")
+	referrerToken, _ := registerTestUser(t, r, "carol")
+
+	content := []byte("\x89PNG\r\n\x1a\nfake image")
+	bankID := createTestBank(t, r, ownerToken, sampleQuestions())
+	mediaID := uploadTestMedia(t, r, ownerToken, bankID, "figure.png", content)
+	figure := Question{
+		Type: questionTypeSingle, Question: "![](" + mediaURL(mediaID) + ")", Options: []string{"a", "b"}, Format: contentFormatMarkdown,
+	}
+
+	// alice 的题目引用自己题库的文件；carol 的题库中有题目直接写了该文件的地址
+	figure.BankID = bankID
+	if w := doJSON(r, "POST", "/api/questions", ownerToken, figure); w.Code != http.StatusOK {
+		t.Fatalf("create question: %d %s", w.Code, w.Body.String())
+	}
+	otherBankID := createTestBank(t, r, referrerToken, []Question{figure})
+
+	questions := getTestBankQuestions(t, r, ownerToken, bankID)
+	ownerSrc := renderedImageSrc(t, questions[len(questions)-1].Rendered.Question)
+	referrerSrc := renderedImageSrc(t, getTestBankQuestions(t, r, referrerToken, otherBankID)[0].Rendered.Question)
+
+	w := doJSON(r, "GET", "/api/question-banks/"+bankID+"/media", ownerToken, nil)
+	var files []MediaFile
+	decodeBody(t, w, &files)
+	if len(files) != 1 || files[0].URL != mediaURL(mediaID) {
+		t.Fatalf("media list = %+v", files)
+	}
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	tests := []struct {
+		name   string
+		url    string
+		token  string
+		status int
+	}{
+		{"rendered in own bank", ownerSrc, "", http.StatusOK},
+		{"listed signed url", files[0].SignedURL, "", http.StatusOK},
+		{"referenced from other bank", referrerSrc, "", http.StatusNotFound},
+		{"unsigned with owner token", mediaURL(mediaID), ownerToken, http.StatusForbidden},
+		{"tampered bank", strings.Replace(ownerSrc, "bank="+bankID, "bank="+otherBankID, 1), "", http.StatusForbidden},
+		{"tampered signature", ownerSrc[:len(ownerSrc)-1] + "0", "", http.StatusForbidden},
+		{"expired", mediaURL(mediaID) + "?bank=" + bankID + "&expires=" + expired + "&sig=" + mediaSignature(mediaID, bankID, expired), "", http.StatusForbidden},
+		{"unknown id", signedMediaURL("0123456789abcdef0123456789abcdef", bankID), "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doJSON(r, "GET", tt.url, tt.token, nil)
+			if w.Code != tt.status {
+				t.Fatalf("GET %s: status %d, want %d (%s)", tt.url, w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusOK && !bytes.Equal(w.Body.Bytes(), content) {
+				t.Errorf("body = %q, want %q", w.Body.Bytes(), content)
+			}
+		})
+	}
+}
+
+func TestDeleteMediaAccess(t *testing.T) {
+	r := setupTestServer(t)
+	ownerToken, _ := registerTestUser(t, r, "alice")
+	strangerToken, _ := registerTestUser(t, r, "bob")
+	adminToken, adminID := registerTestUser(t, r, "dave")
+	if _, err := db.Exec("UPDATE users SET is_admin = 1 WHERE id = ?", adminID); err != nil {
+		t.Fatal(err)
+	}
+
+	bankID := createTestBank(t, r, ownerToken, sampleQuestions())
+	referenced := uploadTestMedia(t, r, ownerToken, bankID, "referenced.png", []byte("a"))
+	if w := doJSON(r, "POST", "/api/questions", ownerToken, Question{
+		BankID: bankID, Type: questionTypeSingle, Question: "![](" + mediaURL(referenced) + ")", Options: []string{"a", "b"},
+	}); w.Code != http.StatusOK {
+		t.Fatalf("create question: %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		id     string
+		status int
+	}{
+		{"other user", strangerToken, uploadTestMedia(t, r, ownerToken, bankID, "a.png", []byte("a")), http.StatusNotFound},
+		{"owner", ownerToken, uploadTestMedia(t, r, ownerToken, bankID, "b.png", []byte("b")), http.StatusOK},
+		{"admin", adminToken, uploadTestMedia(t, r, ownerToken, bankID, "c.png", []byte("c")), http.StatusOK},
+		{"still referenced", ownerToken, referenced, http.StatusConflict},
+		{"wildcard id", ownerToken, "%25", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doJSON(r, "DELETE", "/api/media/"+tt.id, tt.token, gin.H{})
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
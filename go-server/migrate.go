@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 迁移执行时使用的连接：MySQL 为持有迁移锁的 *sql.Conn，SQLite 为 *sql.Tx
+type migrationConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// 一个版本的表结构变更，version 从 1 开始递增，已发布的迁移不要再修改
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, conn migrationConn) error
+	down    func(ctx context.Context, conn migrationConn) error
+}
+
+// 迁移的执行状态
+type migrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+const (
+	migrationLockName    = "exam_schema_migrations"
+	migrationLockTimeout = 300 // 等待迁移锁的秒数（MySQL）
+)
+
+// 已执行的迁移记录表
+const schemaMigrationsDDL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+// 执行全部未执行的迁移，limit > 0 时最多执行 limit 个，返回本次执行的迁移
+func migrateUp(ctx context.Context, limit int) ([]migration, error) {
+	var done []migration
+	err := backend.withMigrationLock(ctx, func(conn migrationConn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+			if limit > 0 && len(done) >= limit {
+				break
+			}
+			if err := m.up(ctx, conn); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %v", m.version, m.name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+				return fmt.Errorf("failed to record migration %d: %v", m.version, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// 按版本从新到旧回滚 steps 个已执行的迁移，返回本次回滚的迁移
+func migrateDown(ctx context.Context, steps int) ([]migration, error) {
+	var done []migration
+	err := backend.withMigrationLock(ctx, func(conn migrationConn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+			if err := m.down(ctx, conn); err != nil {
+				return fmt.Errorf("rollback of migration %d_%s failed: %v", m.version, m.name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.version); err != nil {
+				return fmt.Errorf("failed to remove migration record %d: %v", m.version, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// 全部迁移的执行状态，数据库中有但程序中没有的版本（由更新的版本执行）也会列出
+func migrationStatus(ctx context.Context) ([]migrationState, error) {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]migrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := migrationState{Version: m.version, Name: m.name}
+		if record, ok := applied[m.version]; ok {
+			state.Applied, state.AppliedAt = true, record.AppliedAt
+			delete(applied, m.version)
+		}
+		states = append(states, state)
+	}
+	for _, record := range applied {
+		states = append(states, record)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// 读取已执行的迁移，记录表不存在时先创建
+func appliedMigrations(ctx context.Context, conn migrationConn) (map[int]migrationState, error) {
+	if _, err := conn.ExecContext(ctx, schemaMigrationsDDL); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]migrationState)
+	for rows.Next() {
+		var state migrationState
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&state.Version, &state.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		state.Applied, state.AppliedAt = true, appliedAt.Time
+		applied[state.Version] = state
+	}
+	return applied, rows.Err()
+}
+
+// 服务启动时的迁移：默认自动执行未执行的迁移；database.auto_migrate（AUTO_MIGRATE）为 false 时只检查，
+// 有未执行的迁移则拒绝启动，需先单独运行 migrate up
+func runStartupMigrations() {
+	ctx := context.Background()
+	if cfg.Database.AutoMigrate {
+		done, err := migrateUp(ctx, 0)
+		if err != nil {
+			log.Fatal("Failed to migrate database: ", err)
+		}
+		for _, m := range done {
+			log.Printf("Applied migration %d_%s", m.version, m.name)
+		}
+		return
+	}
+
+	states, err := migrationStatus(ctx)
+	if err != nil {
+		log.Fatal("Failed to check migrations: ", err)
+	}
+	for _, state := range states {
+		if !state.Applied {
+			log.Fatalf("Database has pending migrations (first: %d_%s), run `migrate up` first", state.Version, state.Name)
+		}
+	}
+}
+
+// migrate 命令：migrate up [N]、migrate down [N]（默认回滚 1 个）、migrate status
+func runMigrateCommand(args []string) {
+	ctx := context.Background()
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	count := 0
+	if command == "down" {
+		count = 1
+	}
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid migration count: %s", args[1])
+		}
+		count = n
+	}
+
+	switch command {
+	case "up":
+		done, err := migrateUp(ctx, count)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range done {
+			fmt.Printf("applied  %04d_%s\n", m.version, m.name)
+		}
+		if len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		done, err := migrateDown(ctx, count)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range done {
+			fmt.Printf("reverted %04d_%s\n", m.version, m.name)
+		}
+		if len(done) == 0 {
+			fmt.Println("no applied migrations")
+		}
+	case "status":
+		states, err := migrationStatus(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.Applied {
+				status = "applied  " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", state.Version, state.Name, status)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: exam-server migrate [up [N] | down [N] | status]")
+		os.Exit(2)
+	}
+}
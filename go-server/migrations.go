@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// 全部迁移，按版本号递增排列。新的表结构变更在末尾追加一个迁移，up 和 down 互为逆操作
+var migrations = []migration{
+	{version: 1, name: "initial_schema", up: initialSchemaUp, down: initialSchemaDown},
+	{version: 2, name: "system_settings", up: systemSettingsUp, down: systemSettingsDown},
+	{version: 3, name: "refresh_tokens", up: refreshTokensUp, down: refreshTokensDown},
+	{version: 4, name: "import_job_workers", up: importJobWorkersUp, down: importJobWorkersDown},
+	{version: 5, name: "question_seq", up: questionSeqUp, down: questionSeqDown},
+	{version: 6, name: "settings_lock", up: settingsLockUp, down: settingsLockDown},
+}
+
+// 依次执行多条语句
+func execStatements(ctx context.Context, conn migrationConn, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 表中没有该列时添加
+func addColumnIfMissing(ctx context.Context, conn migrationConn, table, column, definition string) error {
+	exists, err := backend.columnExists(ctx, conn, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// 表中有该列时删除
+func dropColumnIfExists(ctx context.Context, conn migrationConn, table, column string) error {
+	exists, err := backend.columnExists(ctx, conn, table, column)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column))
+	return err
+}
+
+// 表上没有该索引时创建
+func createIndexIfMissing(ctx context.Context, conn migrationConn, table, index, columns string) error {
+	exists, err := backend.indexExists(ctx, conn, table, index)
+	if err != nil || exists {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE INDEX %s ON %s (%s)", index, table, columns))
+	return err
+}
+
+// 表上有该索引时删除，列上有索引时 SQLite 不允许删除该列
+func dropIndexIfExists(ctx context.Context, conn migrationConn, table, index string) error {
+	exists, err := backend.indexExists(ctx, conn, table, index)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, backend.dropIndexSQL(table, index))
+	return err
+}
+
+// 1：初始表结构。引入迁移之前创建的数据库中表已存在，但可能缺少后来陆续添加的列，这里一并补齐
+func initialSchemaUp(ctx context.Context, conn migrationConn) error {
+	err := execStatements(ctx, conn,
+		// 用户表
+		`CREATE TABLE IF NOT EXISTS users (
+			id VARCHAR(255) PRIMARY KEY,
+			username VARCHAR(255) UNIQUE NOT NULL,
+			password VARCHAR(255) NOT NULL,
+			email VARCHAR(255),
+			is_admin BOOLEAN DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// 题库表
+		`CREATE TABLE IF NOT EXISTS question_banks (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+
+		// 题目表：answers 为多选题的全部正确选项，accepted 为填空题/简答题可接受的答案，
+		// media 为题干、选项和解析引用的媒体文件，format 为内容格式（plain/markdown）
+		`CREATE TABLE IF NOT EXISTS questions (
+			id VARCHAR(255) PRIMARY KEY,
+			bank_id VARCHAR(255) NOT NULL,
+			type VARCHAR(32) NOT NULL DEFAULT 'single_choice',
+			question TEXT NOT NULL,
+			options JSON NOT NULL,
+			answer INT NOT NULL,
+			answers JSON NULL,
+			accepted JSON NULL,
+			explanation TEXT,
+			chapter VARCHAR(255) NOT NULL DEFAULT '',
+			media JSON NULL,
+			format VARCHAR(16) NOT NULL DEFAULT 'plain',
+			FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
+		)`,
+
+		// 错题表
+		`CREATE TABLE IF NOT EXISTS wrong_questions (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			bank_id VARCHAR(255) NOT NULL,
+			question_id VARCHAR(255) NOT NULL,
+			type VARCHAR(32) NOT NULL DEFAULT 'single_choice',
+			question TEXT NOT NULL,
+			options JSON NOT NULL,
+			answer INT NOT NULL,
+			answers JSON NULL,
+			accepted JSON NULL,
+			explanation TEXT,
+			format VARCHAR(16) NOT NULL DEFAULT 'plain',
+			added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+			FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
+		)`,
+
+		// 考试结果表，由考试会话判分生成的结果会记录会话ID
+		`CREATE TABLE IF NOT EXISTS exam_results (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			bank_id VARCHAR(255) NOT NULL,
+			score INT NOT NULL,
+			correct_count INT NOT NULL,
+			wrong_count INT NOT NULL,
+			total_questions INT NOT NULL,
+			total_time INT NOT NULL,
+			session_id VARCHAR(255) NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+			FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
+		)`,
+
+		// 考试会话表
+		`CREATE TABLE IF NOT EXISTS exam_sessions (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			bank_id VARCHAR(255) NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			mode VARCHAR(32) NOT NULL DEFAULT 'exam',
+			scoring_mode VARCHAR(32) NOT NULL DEFAULT 'all_or_nothing',
+			question_ids JSON NOT NULL,
+			result_id VARCHAR(255),
+			started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			submitted_at TIMESTAMP NULL,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+			FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
+		)`,
+
+		// 考试会话作答表
+		`CREATE TABLE IF NOT EXISTS exam_session_answers (
+			session_id VARCHAR(255) NOT NULL,
+			question_id VARCHAR(255) NOT NULL,
+			answer JSON NOT NULL,
+			time_spent INT NOT NULL DEFAULT 0,
+			answered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (session_id, question_id),
+			FOREIGN KEY (session_id) REFERENCES exam_sessions (id) ON DELETE CASCADE
+		)`,
+
+		// 考试作答明细表，credit 为 partial 评分模式下的单题得分（0~1）
+		`CREATE TABLE IF NOT EXISTS exam_answers (
+			result_id VARCHAR(255) NOT NULL,
+			question_id VARCHAR(255) NOT NULL,
+			position INT NOT NULL,
+			chosen JSON NULL,
+			correct BOOLEAN NOT NULL DEFAULT 0,
+			credit DOUBLE NOT NULL DEFAULT 0,
+			time_spent INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (result_id, question_id),
+			FOREIGN KEY (result_id) REFERENCES exam_results (id) ON DELETE CASCADE
+		)`,
+
+		// 导入配置表
+		`CREATE TABLE IF NOT EXISTS import_profiles (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			mapping JSON NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT uniq_user_profile UNIQUE (user_id, name),
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+
+		// 异步导入任务表，上传的文件保存在磁盘上直到任务结束
+		`CREATE TABLE IF NOT EXISTS import_jobs (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			bank_id VARCHAR(255) NOT NULL,
+			file_name VARCHAR(255) NOT NULL,
+			file_path VARCHAR(1024) NOT NULL,
+			file_size BIGINT NOT NULL DEFAULT 0,
+			options JSON NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			processed INT NOT NULL DEFAULT 0,
+			report JSON NULL,
+			message TEXT,
+			error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP NULL,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+			FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
+		)`,
+
+		// 媒体文件表，文件内容保存在媒体存储中
+		`CREATE TABLE IF NOT EXISTS media (
+			id VARCHAR(255) PRIMARY KEY,
+			bank_id VARCHAR(255) NOT NULL,
+			file_name VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size BIGINT NOT NULL,
+			storage_key VARCHAR(1024) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (bank_id) REFERENCES question_banks (id) ON DELETE CASCADE
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// 旧数据库中后来添加的列
+	legacyColumns := []struct{ table, column, definition string }{
+		{"users", "is_admin", "BOOLEAN DEFAULT 0"},
+		{"questions", "answers", "JSON NULL"},
+		{"questions", "type", "VARCHAR(32) NOT NULL DEFAULT 'single_choice'"},
+		{"questions", "accepted", "JSON NULL"},
+		{"questions", "chapter", "VARCHAR(255) NOT NULL DEFAULT ''"},
+		{"questions", "media", "JSON NULL"},
+		{"questions", "format", "VARCHAR(16) NOT NULL DEFAULT 'plain'"},
+		{"wrong_questions", "answers", "JSON NULL"},
+		{"wrong_questions", "type", "VARCHAR(32) NOT NULL DEFAULT 'single_choice'"},
+		{"wrong_questions", "accepted", "JSON NULL"},
+		{"wrong_questions", "format", "VARCHAR(16) NOT NULL DEFAULT 'plain'"},
+		{"exam_results", "session_id", "VARCHAR(255) NULL"},
+		{"exam_sessions", "scoring_mode", "VARCHAR(32) NOT NULL DEFAULT 'all_or_nothing'"},
+		{"exam_answers", "credit", "DOUBLE NOT NULL DEFAULT 0"},
+	}
+	for _, c := range legacyColumns {
+		if err := addColumnIfMissing(ctx, conn, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %v", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// 删除全部表，被外键引用的表最后删除
+func initialSchemaDown(ctx context.Context, conn migrationConn) error {
+	return execStatements(ctx, conn,
+		"DROP TABLE IF EXISTS media",
+		"DROP TABLE IF EXISTS import_jobs",
+		"DROP TABLE IF EXISTS import_profiles",
+		"DROP TABLE IF EXISTS exam_answers",
+		"DROP TABLE IF EXISTS exam_session_answers",
+		"DROP TABLE IF EXISTS exam_sessions",
+		"DROP TABLE IF EXISTS exam_results",
+		"DROP TABLE IF EXISTS wrong_questions",
+		"DROP TABLE IF EXISTS questions",
+		"DROP TABLE IF EXISTS question_banks",
+		"DROP TABLE IF EXISTS users",
+	)
+}
+
+// 2：系统设置及其修改记录，考试会话的时间限制
+func systemSettingsUp(ctx context.Context, conn migrationConn) error {
+	err := execStatements(ctx, conn,
+		// 每项设置一行，value 为 JSON 值，表中没有的设置使用默认值
+		`CREATE TABLE IF NOT EXISTS settings (
+			name VARCHAR(64) PRIMARY KEY,
+			value JSON NOT NULL,
+			updated_by VARCHAR(255) NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// 设置的修改记录，old_value 为空表示此前为默认值
+		`CREATE TABLE IF NOT EXISTS settings_history (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(64) NOT NULL,
+			old_value JSON NULL,
+			new_value JSON NOT NULL,
+			changed_by VARCHAR(255) NULL,
+			changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+	// 考试时间限制（分钟），0 表示不限时
+	return addColumnIfMissing(ctx, conn, "exam_sessions", "time_limit", "INT NOT NULL DEFAULT 0")
+}
+
+func systemSettingsDown(ctx context.Context, conn migrationConn) error {
+	if err := dropColumnIfExists(ctx, conn, "exam_sessions", "time_limit"); err != nil {
+		return err
+	}
+	return execStatements(ctx, conn,
+		"DROP TABLE IF EXISTS settings_history",
+		"DROP TABLE IF EXISTS settings",
+	)
+}
+
+// 3：服务端保存的刷新令牌，用户的禁用状态和令牌版本
+func refreshTokensUp(ctx context.Context, conn migrationConn) error {
+	err := execStatements(ctx, conn,
+		// 只保存令牌的 SHA-256；同一次登录轮换出的令牌属于同一个 family_id
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			family_id VARCHAR(255) NOT NULL,
+			token_hash CHAR(64) UNIQUE NOT NULL,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+	if err := createIndexIfMissing(ctx, conn, "refresh_tokens", "idx_refresh_tokens_family", "family_id"); err != nil {
+		return err
+	}
+	// 被禁用的用户不能登录，已签发的令牌立即失效
+	if err := addColumnIfMissing(ctx, conn, "users", "disabled", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// 令牌版本写入访问令牌，递增后此前签发的访问令牌全部失效
+	return addColumnIfMissing(ctx, conn, "users", "token_version", "INT NOT NULL DEFAULT 0")
+}
+
+func refreshTokensDown(ctx context.Context, conn migrationConn) error {
+	if err := dropColumnIfExists(ctx, conn, "users", "token_version"); err != nil {
+		return err
+	}
+	if err := dropColumnIfExists(ctx, conn, "users", "disabled"); err != nil {
+		return err
+	}
+	// 索引随表一起删除
+	return execStatements(ctx, conn, "DROP TABLE IF EXISTS refresh_tokens")
+}
+
+// 4：导入任务记录执行它的实例和心跳时间，重启时只重新排队心跳已超时的任务
+func importJobWorkersUp(ctx context.Context, conn migrationConn) error {
+	if err := addColumnIfMissing(ctx, conn, "import_jobs", "worker_id", "VARCHAR(255) NULL"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(ctx, conn, "import_jobs", "heartbeat_at", "DATETIME NULL")
+}
+
+func importJobWorkersDown(ctx context.Context, conn migrationConn) error {
+	if err := dropColumnIfExists(ctx, conn, "import_jobs", "heartbeat_at"); err != nil {
+		return err
+	}
+	return dropColumnIfExists(ctx, conn, "import_jobs", "worker_id")
+}
+
+// 5：题目的创建顺序，题目列表按 (bank_id, seq) 排序。已有题目按 ID 换算，见 idSequence
+func questionSeqUp(ctx context.Context, conn migrationConn) error {
+	if err := addColumnIfMissing(ctx, conn, "questions", "seq", "BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 先读出全部 ID 再逐条更新，SQLite 的事务中不能边读边写
+	rows, err := conn.QueryContext(ctx, "SELECT id FROM questions WHERE seq = 0")
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := conn.ExecContext(ctx, "UPDATE questions SET seq = ? WHERE id = ?", idSequence(id), id); err != nil {
+			return err
+		}
+	}
+
+	return createIndexIfMissing(ctx, conn, "questions", "idx_questions_bank_seq", "bank_id, seq")
+}
+
+func questionSeqDown(ctx context.Context, conn migrationConn) error {
+	if err := dropIndexIfExists(ctx, conn, "questions", "idx_questions_bank_seq"); err != nil {
+		return err
+	}
+	return dropColumnIfExists(ctx, conn, "questions", "seq")
+}
+
+// 6：修改设置时锁定的单行哨兵。锁定整个 settings 表在 MySQL 上会连同间隙一起锁住，
+// 两个修改都从空表开始时各自持有间隙锁再插入，互相等待而死锁
+func settingsLockUp(ctx context.Context, conn migrationConn) error {
+	if err := execStatements(ctx, conn, "CREATE TABLE IF NOT EXISTS settings_lock (id INT PRIMARY KEY)"); err != nil {
+		return err
+	}
+	var count int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM settings_lock WHERE id = 1").Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	return execStatements(ctx, conn, "INSERT INTO settings_lock (id) VALUES (1)")
+}
+
+func settingsLockDown(ctx context.Context, conn migrationConn) error {
+	return execStatements(ctx, conn, "DROP TABLE IF EXISTS settings_lock")
+}
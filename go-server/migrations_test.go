@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// 每个迁移重复执行 up 或 down 都不会出错：中断后重试、手动补过表结构的数据库都能继续迁移
+func TestMigrationsAreIdempotent(t *testing.T) {
+	setupTestServer(t)
+	ctx := context.Background()
+
+	// 从最后一个迁移开始，后面的迁移依赖前面的表
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		t.Run(fmt.Sprintf("%d_%s", m.version, m.name), func(t *testing.T) {
+			steps := []struct {
+				name string
+				fn   func(ctx context.Context, conn migrationConn) error
+			}{
+				{"up again", m.up},
+				{"down", m.down},
+				{"down again", m.down},
+				{"up", m.up},
+				{"up again", m.up},
+			}
+			for _, step := range steps {
+				if err := step.fn(ctx, db); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+			}
+		})
+	}
+
+	exists, err := backend.indexExists(ctx, db, "refresh_tokens", "idx_refresh_tokens_family")
+	if err != nil || !exists {
+		t.Errorf("idx_refresh_tokens_family exists = %v, %v", exists, err)
+	}
+}
+
+// sqlite_master 中的表和索引定义，用于比较迁移前后的表结构
+func sqliteSchema(t *testing.T) map[string]string {
+	t.Helper()
+	rows, err := db.Query("SELECT name, COALESCE(sql, '') FROM sqlite_master WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	schema := make(map[string]string)
+	for rows.Next() {
+		var name, sql string
+		if err := rows.Scan(&name, &sql); err != nil {
+			t.Fatal(err)
+		}
+		schema[name] = sql
+	}
+	return schema
+}
+
+// 通过 migrateUp/migrateDown 逐步回滚再重新执行，最终的表结构与直接迁移的一致
+func TestMigrateUpDownUp(t *testing.T) {
+	r := setupTestServer(t)
+	ctx := context.Background()
+	fresh := sqliteSchema(t)
+	latest := migrations[len(migrations)-1].version
+
+	tests := []struct {
+		name        string
+		up          bool
+		n           int
+		wantDone    int // 本次执行或回滚的迁移数
+		wantApplied int // 之后已执行的迁移数
+	}{
+		{"up when current", true, 0, 0, latest},
+		{"down one", false, 1, 1, latest - 1},
+		{"up one", true, 1, 1, latest},
+		{"down all", false, latest + 1, latest, 0},
+		{"down when empty", false, 1, 0, 0},
+		{"up limited", true, 2, 2, 2},
+		{"up rest", true, 0, latest - 2, latest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var done []migration
+			var err error
+			if tt.up {
+				done, err = migrateUp(ctx, tt.n)
+			} else {
+				done, err = migrateDown(ctx, tt.n)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(done) != tt.wantDone {
+				t.Errorf("ran %d migrations, want %d", len(done), tt.wantDone)
+			}
+
+			states, err := migrationStatus(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied := 0
+			for _, state := range states {
+				if state.Applied {
+					applied++
+				}
+			}
+			if applied != tt.wantApplied {
+				t.Errorf("%d migrations applied, want %d", applied, tt.wantApplied)
+			}
+		})
+	}
+
+	got := sqliteSchema(t)
+	for name, sql := range fresh {
+		if got[name] != sql {
+			t.Errorf("%s after down/up:\n%s\nwant:\n%s", name, got[name], sql)
+		}
+	}
+	for name := range got {
+		if _, ok := fresh[name]; !ok {
+			t.Errorf("unexpected %s after down/up", name)
+		}
+	}
+
+	// 重新迁移后的数据库可以正常使用
+	token, _ := registerTestUser(t, r, "alice")
+	createTestBank(t, r, token, sampleQuestions())
+}
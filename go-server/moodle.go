@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Moodle XML 中带格式的文本节点
+type moodleText struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+}
+
+type moodleAnswer struct {
+	Fraction string `xml:"fraction,attr"`
+	Format   string `xml:"format,attr,omitempty"`
+	Text     string `xml:"text"`
+}
+
+type moodleQuestion struct {
+	Type            string         `xml:"type,attr"`
+	Category        *moodleText    `xml:"category,omitempty"`
+	Info            *moodleText    `xml:"info,omitempty"`
+	Name            *moodleText    `xml:"name,omitempty"`
+	QuestionText    *moodleText    `xml:"questiontext,omitempty"`
+	GeneralFeedback *moodleText    `xml:"generalfeedback,omitempty"`
+	Single          string         `xml:"single,omitempty"`
+	ShuffleAnswers  string         `xml:"shuffleanswers,omitempty"`
+	UseCase         string         `xml:"usecase,omitempty"`
+	Answers         []moodleAnswer `xml:"answer"`
+}
+
+type moodleQuiz struct {
+	XMLName   xml.Name         `xml:"quiz"`
+	Questions []moodleQuestion `xml:"question"`
+}
+
+// 完形填空（cloze）中的一个空，如 {1:SHORTANSWER:=北京~=Beijing}
+var clozeMarker = regexp.MustCompile(`\{(\d*):([A-Za-z_]+):((?:\\.|[^\\}])*)\}`)
+
+var errUnsupportedMoodleType = errors.New("unsupported moodle question type")
+
+var (
+	htmlLineBreak = regexp.MustCompile(`(?i)<br\s*/?>|</p>\s*`)
+	htmlTag       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// 解析 Moodle XML 文件，报告中的行号为题目序号（不含 category 节点）。
+// 支持 multichoice、truefalse、shortanswer 和只含简答空的 cloze，其他题型跳过
+func parseMoodleXMLFile(file io.Reader) ([]Question, *ImportReport, error) {
+	var quiz moodleQuiz
+	if err := xml.NewDecoder(file).Decode(&quiz); err != nil {
+		return nil, nil, fmt.Errorf("Moodle XML文件解析失败: %v", err)
+	}
+
+	report := &ImportReport{Rows: []ImportRowResult{}}
+	var questions []Question
+	row := 0
+	for _, mq := range quiz.Questions {
+		if mq.Type == "category" {
+			continue
+		}
+		row++
+
+		q, err := mq.toQuestion()
+		if err != nil {
+			status := importRowError
+			if err == errUnsupportedMoodleType {
+				status = importRowSkipped
+				err = fmt.Errorf("不支持的题型: %s", mq.Type)
+			}
+			report.add(row, status, q.Question, err.Error())
+			continue
+		}
+		if report.check(row, &q) {
+			questions = append(questions, q)
+		}
+	}
+
+	if row == 0 {
+		return nil, nil, fmt.Errorf("未找到有效的题目数据")
+	}
+
+	return questions, report, nil
+}
+
+func (mq moodleQuestion) toQuestion() (Question, error) {
+	q := Question{
+		Question:    mq.QuestionText.plain(),
+		Explanation: mq.GeneralFeedback.plain(),
+	}
+	// markdown 格式的题目保留原文
+	if mq.QuestionText != nil && mq.QuestionText.Format == "markdown" {
+		q.Format = contentFormatMarkdown
+	}
+
+	switch mq.Type {
+	case "multichoice":
+		// single 为 false 时为多选题；单选题有多个得分选项时取得分最高的
+		best, bestFraction := -1, 0.0
+		for i, a := range mq.Answers {
+			q.Options = append(q.Options, moodlePlain(a.Format, a.Text))
+			fraction, err := parseFraction(a.Fraction)
+			if err != nil {
+				return q, err
+			}
+			if fraction > 0 {
+				q.Answers = append(q.Answers, i)
+			}
+			if fraction > bestFraction {
+				best, bestFraction = i, fraction
+			}
+		}
+		if best < 0 {
+			return q, fmt.Errorf("没有正确选项")
+		}
+		if single := strings.TrimSpace(mq.Single); single == "false" || single == "0" {
+			q.Type = questionTypeMultiple
+		} else {
+			q.Type, q.Answer, q.Answers = questionTypeSingle, best, nil
+		}
+	case "truefalse":
+		q.Type, q.Options, q.Answer = questionTypeTrueFalse, trueFalseOptions, -1
+		for _, a := range mq.Answers {
+			fraction, err := parseFraction(a.Fraction)
+			if err != nil {
+				return q, err
+			}
+			if fraction <= 0 {
+				continue
+			}
+			switch strings.ToLower(moodlePlain(a.Format, a.Text)) {
+			case "true":
+				q.Answer = 0
+			case "false":
+				q.Answer = 1
+			}
+		}
+	case "shortanswer":
+		q.Type = questionTypeShortAnswer
+		for _, a := range mq.Answers {
+			fraction, err := parseFraction(a.Fraction)
+			if err != nil {
+				return q, err
+			}
+			if fraction > 0 {
+				q.AcceptedAnswers = append(q.AcceptedAnswers, moodlePlain(a.Format, a.Text))
+			}
+		}
+	case "cloze":
+		q.Type = questionTypeFillBlank
+		stem, blanks, err := parseCloze(q.Question)
+		if err != nil {
+			return q, err
+		}
+		q.Question, q.Blanks = stem, blanks
+	default:
+		return q, errUnsupportedMoodleType
+	}
+
+	return q, nil
+}
+
+// 将完形填空中的空替换为 ____，返回各空的可接受答案
+func parseCloze(text string) (string, [][]string, error) {
+	var blanks [][]string
+	var err error
+	stem := clozeMarker.ReplaceAllStringFunc(text, func(marker string) string {
+		match := clozeMarker.FindStringSubmatch(marker)
+		switch strings.ToUpper(match[2]) {
+		case "SHORTANSWER", "SA", "MW", "SHORTANSWER_C", "SAC", "MWC":
+		default:
+			err = fmt.Errorf("完形填空只支持简答类型的空: %s", match[2])
+			return marker
+		}
+
+		var accepted []string
+		for _, alternative := range splitUnescaped(match[3], "~") {
+			if answer, ok := parseClozeAlternative(alternative); ok {
+				accepted = append(accepted, answer)
+			}
+		}
+		blanks = append(blanks, accepted)
+		return "____"
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(blanks) == 0 {
+		return "", nil, fmt.Errorf("完形填空中没有找到空")
+	}
+	return stem, blanks, nil
+}
+
+// 解析 =答案、%100%答案 等形式，得分为正时返回答案
+func parseClozeAlternative(alternative string) (string, bool) {
+	if i := indexUnescaped(alternative, "#"); i >= 0 {
+		alternative = alternative[:i]
+	}
+	alternative = strings.TrimSpace(alternative)
+
+	fraction := 0.0
+	switch {
+	case strings.HasPrefix(alternative, "="):
+		fraction, alternative = 100, alternative[1:]
+	case strings.HasPrefix(alternative, "%"):
+		end := strings.Index(alternative[1:], "%")
+		if end < 0 {
+			return "", false
+		}
+		fraction, _ = strconv.ParseFloat(alternative[1:1+end], 64)
+		alternative = alternative[end+2:]
+	}
+	return strings.TrimSpace(unescapeGIFT(alternative)), fraction > 0
+}
+
+// 将题库导出为 Moodle XML，题库名称作为题目类别，填空题导出为只含简答空的 cloze
+func writeMoodleXML(w io.Writer, bank QuestionBank) error {
+	quiz := moodleQuiz{Questions: []moodleQuestion{{
+		Type:     "category",
+		Category: &moodleText{Text: "$course$/top/" + bank.Name},
+		Info:     &moodleText{Format: "html", Text: textToHTML(bank.Description)},
+	}}}
+	for i, q := range bank.Questions {
+		quiz.Questions = append(quiz.Questions, toMoodleQuestion(i+1, q))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(quiz); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func toMoodleQuestion(n int, q Question) moodleQuestion {
+	// Markdown 题目的题干、解析和选项以 format="markdown" 导出原文，重新导入时保持格式；其他题目导出为 HTML
+	textFormat := "html"
+	content := func(text string) string { return renderContent(q.Format, text) }
+	inline := func(text string) string { return renderInlineContent(q.Format, text) }
+	if q.Format == contentFormatMarkdown {
+		textFormat = "markdown"
+		content = func(text string) string { return text }
+		inline = content
+	}
+
+	mq := moodleQuestion{
+		Name:         &moodleText{Text: fmt.Sprintf("Q%d", n)},
+		QuestionText: &moodleText{Format: textFormat, Text: content(q.Question)},
+	}
+	if q.Explanation != "" {
+		mq.GeneralFeedback = &moodleText{Format: textFormat, Text: content(q.Explanation)}
+	}
+
+	switch q.Type {
+	case questionTypeTrueFalse:
+		mq.Type = "truefalse"
+		trueFraction, falseFraction := "100", "0"
+		if q.Answer == 1 {
+			trueFraction, falseFraction = "0", "100"
+		}
+		mq.Answers = []moodleAnswer{
+			{Fraction: trueFraction, Format: "moodle_auto_format", Text: "true"},
+			{Fraction: falseFraction, Format: "moodle_auto_format", Text: "false"},
+		}
+	case questionTypeShortAnswer:
+		mq.Type, mq.UseCase = "shortanswer", "0"
+		for _, accepted := range q.AcceptedAnswers {
+			mq.Answers = append(mq.Answers, moodleAnswer{Fraction: "100", Format: "moodle_auto_format", Text: accepted})
+		}
+	case questionTypeFillBlank:
+		mq.Type = "cloze"
+		markers := make([]string, len(q.Blanks))
+		for i, accepted := range q.Blanks {
+			alternatives := make([]string, len(accepted))
+			for j, text := range accepted {
+				alternatives[j] = "=" + escapeCloze(text)
+			}
+			markers[i] = "{1:SHORTANSWER:" + strings.Join(alternatives, "~") + "}"
+		}
+		mq.QuestionText.Text = fillPlaceholders(content(q.Question), markers)
+	default:
+		mq.Type, mq.Single, mq.ShuffleAnswers = "multichoice", "true", "true"
+		if q.Type == questionTypeMultiple {
+			mq.Single = "false"
+		}
+		correct := make(map[int]bool)
+		for _, index := range correctAnswers(q) {
+			correct[index] = true
+		}
+		for i, option := range q.Options {
+			fraction := "0"
+			if correct[i] {
+				fraction = formatFraction(len(correct))
+			}
+			mq.Answers = append(mq.Answers, moodleAnswer{Fraction: fraction, Format: textFormat, Text: inline(option)})
+		}
+	}
+
+	return mq
+}
+
+func (t *moodleText) plain() string {
+	if t == nil {
+		return ""
+	}
+	return moodlePlain(t.Format, t.Text)
+}
+
+// html 格式的文本去掉标签并还原实体，其他格式原样保留
+func moodlePlain(format, text string) string {
+	if format == "html" {
+		text = htmlToText(text)
+	}
+	return strings.TrimSpace(text)
+}
+
+func htmlToText(text string) string {
+	text = htmlLineBreak.ReplaceAllString(text, "\n")
+	text = htmlTag.ReplaceAllString(text, "")
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+func textToHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+func escapeCloze(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(`\}~#`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// 多选题每个正确选项的得分百分比，保留 5 位小数
+func formatFraction(correctCount int) string {
+	fraction := math.Round(100/float64(correctCount)*100000) / 100000
+	return strconv.FormatFloat(fraction, 'f', -1, 64)
+}
+
+func parseFraction(value string) (float64, error) {
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	fraction, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的答案得分: %s", value)
+	}
+	return fraction, nil
+}
@@ -12,25 +12,15 @@ func setupRoutes() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.Default()
+	// 上传文件超过 8MB 的部分写入临时文件，不占用内存
+	r.MaxMultipartMemory = 8 << 20
 
-	// CORS配置
+	// CORS配置，允许的来源见配置 cors.allow_origins
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{
-		"http://localhost:5173",
-		"http://localhost:5174",
-		"http://localhost:5175",
-		"http://localhost:5176",
-		"http://localhost:5177",
-		"http://119.91.68.147",
-		"http://119.91.68.147:80",
-		"http://119.91.68.147:5173",
-		"https://examtest.top",
-		"http://examtest.top",
-		"*", // 允许所有域名（生产环境建议指定具体域名）
-	}
+	config.AllowOrigins = cfg.CORS.AllowOrigins
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Cache-Control"}
-	config.AllowCredentials = true
+	config.AllowCredentials = cfg.CORS.AllowCredentials
 	r.Use(cors.New(config))
 
 	// API路由组
@@ -41,6 +31,9 @@ func setupRoutes() *gin.Engine {
 	{
 		auth.POST("/register", register)
 		auth.POST("/login", login)
+		auth.POST("/refresh", refreshTokens)
+		auth.POST("/logout", logout)
+		auth.POST("/logout-all", authMiddleware(), logoutAll)
 		auth.GET("/me", authMiddleware(), getCurrentUser)
 	}
 
@@ -52,8 +45,36 @@ func setupRoutes() *gin.Engine {
 		questionBanks.GET("/:id", getQuestionBankByID)
 		questionBanks.POST("", createQuestionBank)
 		questionBanks.POST("/:id/upload", uploadQuestionBankFile)
+		questionBanks.GET("/:id/export", exportQuestionBank)
 		questionBanks.DELETE("/:id", deleteQuestionBank)
 		questionBanks.GET("/:id/questions", getBankQuestions)
+		questionBanks.GET("/:id/chapters", getBankChapters)
+		questionBanks.POST("/:id/media", uploadBankMedia)
+		questionBanks.GET("/:id/media", getBankMedia)
+	}
+
+	// 导入配置相关路由（需要认证）
+	importProfiles := api.Group("/import-profiles")
+	importProfiles.Use(authMiddleware())
+	{
+		importProfiles.GET("", getImportProfiles)
+		importProfiles.POST("", createImportProfile)
+		importProfiles.GET("/:id", getImportProfile)
+		importProfiles.PUT("/:id", updateImportProfile)
+		importProfiles.DELETE("/:id", deleteImportProfile)
+	}
+
+	// 媒体文件：读取使用带签名的地址，<img> 等标签不带认证头也能加载；删除需要认证
+	api.GET("/media/:id", serveMedia)
+	api.DELETE("/media/:id", authMiddleware(), deleteMedia)
+
+	// 异步导入任务相关路由（需要认证）
+	importJobs := api.Group("/import-jobs")
+	importJobs.Use(authMiddleware())
+	{
+		importJobs.GET("", getImportJobs)
+		importJobs.GET("/:id", getImportJob)
+		importJobs.GET("/:id/events", streamImportJob)
 	}
 
 	// 题目管理相关路由（需要认证）
@@ -79,8 +100,26 @@ func setupRoutes() *gin.Engine {
 	examResults := api.Group("/exam-results")
 	examResults.Use(authMiddleware())
 	{
+		examResults.GET("", getExamResults)
 		examResults.POST("", saveExamResult)
 		examResults.GET("/stats", getExamStats)
+		examResults.GET("/compare", compareExamResults)
+		examResults.GET("/:id", getExamResult)
+		examResults.DELETE("/:id", deleteExamResult)
+		examResults.GET("/:id/review", getExamResultReview)
+	}
+
+	// 考试会话相关路由（需要认证），由服务端判分
+	examSessions := api.Group("/exam-sessions")
+	examSessions.Use(authMiddleware())
+	{
+		examSessions.POST("", startExamSession)
+		examSessions.GET("/:id", getExamSession)
+		examSessions.PUT("/:id/answers/:questionId", answerExamQuestion)
+		examSessions.POST("/:id/answers", answerExamQuestions)
+		examSessions.POST("/:id/submit", submitExamSession)
+		examSessions.GET("/:id/reveal", revealExamAnswers)
+		examSessions.GET("/:id/reveal/:questionId", revealExamAnswers)
 	}
 
 	// 管理员相关路由（需要管理员权限）
@@ -93,9 +132,15 @@ func setupRoutes() *gin.Engine {
 		admin.DELETE("/users/:id", deleteUser)
 		admin.DELETE("/question-banks/:id", deleteQuestionBankAdmin)
 		admin.PATCH("/users/:id", updateUserAdmin)
+		admin.POST("/users/:id/logout", logoutUserAdmin)
+		admin.GET("/settings", getSettings)
 		admin.PUT("/settings", updateSettings)
+		admin.GET("/settings/history", getSettingsHistory)
 	}
 
+	// 公开的系统设置（平台名称、公告等）
+	api.GET("/settings", getPublicSettings)
+
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
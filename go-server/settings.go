@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理员可修改的系统设置，保存在 settings 表中，每个 JSON 字段一行
+type SystemSettings struct {
+	PlatformName      string       `json:"platformName"`
+	AllowRegistration bool         `json:"allowRegistration"`
+	MaxUsers          int          `json:"maxUsers"`         // 用户数上限，0 不限
+	DefaultTimeLimit  int          `json:"defaultTimeLimit"` // 考试未指定时间限制时使用，单位分钟，0 不限时
+	MaxUploadMB       int64        `json:"maxUploadMB"`      // 题库文件上传大小上限，0 使用服务配置，不能超过服务配置
+	MaxBanksPerUser   int          `json:"maxBanksPerUser"`  // 每个用户可创建的题库数，0 不限
+	Announcement      Announcement `json:"announcement"`
+}
+
+// 公告横幅
+type Announcement struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+	Level   string `json:"level"` // info、warning 或 error
+}
+
+// 设置的修改记录，OldValue 为空表示修改前为默认值
+type SettingChange struct {
+	ID            string          `json:"id"`
+	Name          string          `json:"name"`
+	OldValue      json.RawMessage `json:"old_value"`
+	NewValue      json.RawMessage `json:"new_value"`
+	ChangedBy     string          `json:"changed_by,omitempty"`
+	ChangedByName string          `json:"changed_by_name,omitempty"`
+	ChangedAt     time.Time       `json:"changed_at"`
+}
+
+func defaultSettings() SystemSettings {
+	return SystemSettings{
+		PlatformName:      "智能刷题平台",
+		AllowRegistration: true,
+		Announcement:      Announcement{Level: "info"},
+	}
+}
+
+// 设置缓存：修改后立即更新；多实例部署时其他实例最迟 settingsCacheTTL 后生效
+const settingsCacheTTL = 10 * time.Second
+
+var settingsCache struct {
+	sync.RWMutex
+	settings SystemSettings
+	loadedAt time.Time
+}
+
+// 当前生效的设置，读取失败时沿用上次的值
+func currentSettings() SystemSettings {
+	settingsCache.RLock()
+	settings, fresh := settingsCache.settings, time.Since(settingsCache.loadedAt) < settingsCacheTTL
+	loaded := !settingsCache.loadedAt.IsZero()
+	settingsCache.RUnlock()
+	if fresh {
+		return settings
+	}
+
+	latest, err := loadSettings(db)
+	if err != nil {
+		log.Printf("Warning: Failed to load settings: %v", err)
+		if !loaded {
+			return defaultSettings()
+		}
+		return settings
+	}
+	cacheSettings(latest)
+	return latest
+}
+
+func cacheSettings(settings SystemSettings) {
+	settingsCache.Lock()
+	settingsCache.settings = settings
+	settingsCache.loadedAt = time.Now()
+	settingsCache.Unlock()
+}
+
+// 从数据库读取设置，表中没有的设置使用默认值，不再使用的设置忽略
+func loadSettings(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}) (SystemSettings, error) {
+	settings := defaultSettings()
+	fields, err := settingsFields(settings)
+	if err != nil {
+		return settings, err
+	}
+
+	rows, err := q.Query("SELECT name, value FROM settings")
+	if err != nil {
+		return settings, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return settings, err
+		}
+		fields[name] = json.RawMessage(value)
+	}
+	if err := rows.Err(); err != nil {
+		return settings, err
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return defaultSettings(), fmt.Errorf("invalid stored settings: %v", err)
+	}
+	return settings, nil
+}
+
+// 按 JSON 字段名拆分设置，用于逐项保存和比较
+func settingsFields(settings SystemSettings) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// 规范化并校验设置
+func (s *SystemSettings) validate() error {
+	s.PlatformName = strings.TrimSpace(s.PlatformName)
+	if s.PlatformName == "" || utf8.RuneCountInString(s.PlatformName) > 100 {
+		return fmt.Errorf("platformName 不能为空且不能超过 100 个字符")
+	}
+	if s.MaxUsers < 0 {
+		return fmt.Errorf("maxUsers 不能为负数")
+	}
+	if s.DefaultTimeLimit < 0 || s.DefaultTimeLimit > maxExamTimeLimit {
+		return fmt.Errorf("defaultTimeLimit 应在 0~%d 分钟之间", maxExamTimeLimit)
+	}
+	if s.MaxUploadMB < 0 || s.MaxUploadMB > cfg.Upload.MaxUploadMB {
+		return fmt.Errorf("maxUploadMB 应在 0~%d 之间（不能超过服务配置的上限）", cfg.Upload.MaxUploadMB)
+	}
+	if s.MaxBanksPerUser < 0 {
+		return fmt.Errorf("maxBanksPerUser 不能为负数")
+	}
+
+	a := &s.Announcement
+	a.Message = strings.TrimSpace(a.Message)
+	if a.Level == "" {
+		a.Level = "info"
+	}
+	if a.Level != "info" && a.Level != "warning" && a.Level != "error" {
+		return fmt.Errorf("announcement.level 只能为 info、warning 或 error")
+	}
+	if utf8.RuneCountInString(a.Message) > 1000 {
+		return fmt.Errorf("announcement.message 不能超过 1000 个字符")
+	}
+	if a.Enabled && a.Message == "" {
+		return fmt.Errorf("启用公告时 announcement.message 不能为空")
+	}
+	return nil
+}
+
+// 获取系统设置（管理员）
+func getSettings(c *gin.Context) {
+	settings, err := loadSettings(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"settings": settings})
+}
+
+// 修改系统设置：请求体中只需包含要修改的设置，未知的设置名返回 400。
+// 每项有变化的设置记录一条修改记录，保存后立即生效
+func updateSettings(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// 锁定哨兵行后再读取当前设置：修改设置的请求依次执行，修改记录的旧值和变化判断都基于最新的设置。
+	// 只锁这一行，不锁 settings 表本身，之后的插入不会与其他事务的间隙锁互相等待
+	var sentinel int
+	if err := tx.QueryRow("SELECT id FROM settings_lock WHERE id = 1" + backend.forUpdate()).Scan(&sentinel); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock settings"})
+		return
+	}
+	current, err := loadSettings(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated := current
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的设置: " + err.Error()})
+		return
+	}
+	if err := updated.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := settingsFields(current)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := settingsFields(updated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var changed []string
+	for name, value := range after {
+		if bytes.Equal(before[name], value) {
+			continue
+		}
+		changed = append(changed, name)
+
+		// 修改前表中没有这一项时，修改记录的旧值为空
+		var stored sql.NullString
+		err := tx.QueryRow("SELECT value FROM settings WHERE name = ?", name).Scan(&stored)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var oldValue interface{}
+		if stored.Valid {
+			oldValue = stored.String
+		}
+
+		if stored.Valid {
+			_, err = tx.Exec("UPDATE settings SET value = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP WHERE name = ?", string(value), userID, name)
+		} else {
+			_, err = tx.Exec("INSERT INTO settings (name, value, updated_by) VALUES (?, ?, ?)", name, string(value), userID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save settings"})
+			return
+		}
+		if _, err := tx.Exec("INSERT INTO settings_history (id, name, old_value, new_value, changed_by) VALUES (?, ?, ?, ?, ?)",
+			generateUUID(), name, oldValue, string(value), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save settings history"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+	cacheSettings(updated)
+	sort.Strings(changed)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "设置保存成功",
+		"settings": updated,
+		"changed":  changed,
+	})
+}
+
+// 设置的修改记录，按时间倒序，可用 name 筛选某项设置，limit 默认 50、最多 200
+func getSettingsHistory(c *gin.Context) {
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数必须为正整数"})
+			return
+		}
+		if n < 200 {
+			limit = n
+		} else {
+			limit = 200
+		}
+	}
+
+	where, args := "", []interface{}{}
+	if name := c.Query("name"); name != "" {
+		where = " WHERE h.name = ?"
+		args = append(args, name)
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(`SELECT h.id, h.name, h.old_value, h.new_value, h.changed_by, u.username, h.changed_at
+		FROM settings_history h LEFT JOIN users u ON h.changed_by = u.id`+where+`
+		ORDER BY h.changed_at DESC, h.id DESC LIMIT ?`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	changes := []SettingChange{}
+	for rows.Next() {
+		var change SettingChange
+		var oldValue, changedBy, changedByName sql.NullString
+		var newValue string
+		if err := rows.Scan(&change.ID, &change.Name, &oldValue, &newValue, &changedBy, &changedByName, &change.ChangedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if oldValue.Valid {
+			change.OldValue = json.RawMessage(oldValue.String)
+		}
+		change.NewValue = json.RawMessage(newValue)
+		change.ChangedBy, change.ChangedByName = changedBy.String, changedByName.String
+		changes = append(changes, change)
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// 公开的设置（无需登录）：平台名称、是否开放注册、公告（启用时）和上传限制，供前端展示
+func getPublicSettings(c *gin.Context) {
+	settings := currentSettings()
+
+	response := gin.H{
+		"platformName":      settings.PlatformName,
+		"allowRegistration": settings.AllowRegistration,
+		"defaultTimeLimit":  settings.DefaultTimeLimit,
+		"maxUploadMB":       maxUploadBytes() >> 20,
+	}
+	if settings.Announcement.Enabled {
+		response["announcement"] = settings.Announcement
+	}
+	c.JSON(http.StatusOK, response)
+}
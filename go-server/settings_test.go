@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 从空的 settings 表开始并发修改：每项设置的修改记录连成一条链，每个旧值都是另一次修改的新值，
+// 只有第一次修改的旧值为空；最终保存的值是最后一次修改的新值
+func TestUpdateSettingsConcurrently(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []string // 第 i 个请求修改的设置
+	}{
+		{"two updates of one setting", []string{"platformName", "platformName"}},
+		{"two updates of different settings", []string{"platformName", "maxUsers"}},
+		{"many updates", []string{"platformName", "maxUsers", "platformName", "maxUsers", "platformName", "maxUsers", "platformName", "platformName"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestServer(t)
+			token, _ := registerTestUser(t, r, "root")
+			if _, err := db.Exec("UPDATE users SET is_admin = 1 WHERE username = ?", "root"); err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			codes := make([]int, len(tt.settings))
+			for i, name := range tt.settings {
+				wg.Add(1)
+				go func(i int, name string) {
+					defer wg.Done()
+					value := interface{}(fmt.Sprintf("平台 %d", i))
+					if name == "maxUsers" {
+						value = 100 + i
+					}
+					w := doJSON(r, "PUT", "/api/admin/settings", token, gin.H{name: value})
+					codes[i] = w.Code
+				}(i, name)
+			}
+			wg.Wait()
+			for i, code := range codes {
+				if code != http.StatusOK {
+					t.Fatalf("request %d: status %d", i, code)
+				}
+			}
+
+			counts := make(map[string]int)
+			for _, name := range tt.settings {
+				counts[name]++
+			}
+			for name, n := range counts {
+				checkSettingHistoryChain(t, name, n)
+			}
+		})
+	}
+}
+
+// 检查一项设置的 n 条修改记录连成一条链，链尾的新值就是当前保存的值
+func checkSettingHistoryChain(t *testing.T, name string, n int) {
+	t.Helper()
+	rows, err := db.Query("SELECT old_value, new_value FROM settings_history WHERE name = ?", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	newValues := make(map[string]bool)
+	var oldValues []sql.NullString
+	for rows.Next() {
+		var oldValue sql.NullString
+		var newValue string
+		if err := rows.Scan(&oldValue, &newValue); err != nil {
+			t.Fatal(err)
+		}
+		newValues[newValue] = true
+		oldValues = append(oldValues, oldValue)
+	}
+	if len(oldValues) != n {
+		t.Fatalf("%s: got %d history rows, want %d", name, len(oldValues), n)
+	}
+
+	empty, seen := 0, make(map[string]bool)
+	for _, oldValue := range oldValues {
+		if !oldValue.Valid {
+			empty++
+			continue
+		}
+		if !newValues[oldValue.String] || seen[oldValue.String] {
+			t.Errorf("%s: old value %s is not a distinct earlier new value", name, oldValue.String)
+		}
+		seen[oldValue.String] = true
+	}
+	if empty != 1 {
+		t.Errorf("%s: %d history rows without old value, want 1", name, empty)
+	}
+
+	// 没有作为旧值出现过的新值就是最后一次修改的结果
+	var stored string
+	if err := db.QueryRow("SELECT value FROM settings WHERE name = ?", name).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !newValues[stored] || seen[stored] {
+		t.Errorf("%s: stored value %s is not the last change", name, stored)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 数据库后端只负责选择驱动并处理连接、迁移（表结构检查、迁移锁）和时间参数的差异，不是数据访问层：
+// 处理函数仍通过全局 db 直接执行 SQL，只使用两种数据库都支持的写法，测试在 SQLite 上执行这些语句
+type dbBackend interface {
+	name() string
+	open() (*sql.DB, error)
+	// 表中是否已有该列，供迁移升级旧表使用
+	columnExists(ctx context.Context, conn migrationConn, table, column string) (bool, error)
+	// 表上是否已有该索引，两种数据库都不支持 CREATE INDEX IF NOT EXISTS 的通用写法
+	indexExists(ctx context.Context, conn migrationConn, table, index string) (bool, error)
+	// 删除索引的语句，MySQL 需要指定表名而 SQLite 不接受
+	dropIndexSQL(table, index string) string
+	// 持有迁移锁执行 fn，保证多个实例不会同时迁移
+	withMigrationLock(ctx context.Context, fn func(conn migrationConn) error) error
+	// 与 created_at 等时间列比较时使用的参数值
+	timeValue(t time.Time) interface{}
+	// 事务中锁定读取的行时追加在 SELECT 末尾的子句
+	forUpdate() string
+}
+
+var backend dbBackend
+
+// 按 database.driver（DB_DRIVER）选择数据库后端：mysql（默认）或 sqlite。
+// 不根据其他配置推断，未配置 DB_HOST 的 MySQL 部署启动时报错，不会改用新建的 SQLite 文件
+func newDBBackend(c DatabaseConfig) (dbBackend, error) {
+	switch c.Driver {
+	case "mysql":
+		if c.Host == "" {
+			return nil, fmt.Errorf("DB_HOST is required when DB_DRIVER is mysql")
+		}
+		return &mysqlBackend{
+			host:     c.Host,
+			user:     c.User,
+			password: c.Password,
+			database: c.Name,
+		}, nil
+	case "sqlite":
+		return &sqliteBackend{path: c.Path}, nil
+	}
+	return nil, fmt.Errorf("unsupported DB_DRIVER: %s", c.Driver)
+}
+
+type mysqlBackend struct {
+	host     string
+	user     string
+	password string
+	database string
+}
+
+func (b *mysqlBackend) name() string {
+	return "mysql"
+}
+
+func (b *mysqlBackend) open() (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		b.user, b.password, b.host, b.database)
+	return sql.Open("mysql", dsn)
+}
+
+func (b *mysqlBackend) columnExists(ctx context.Context, conn migrationConn, table, column string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, column).Scan(&count)
+	return count > 0, err
+}
+
+func (b *mysqlBackend) indexExists(ctx context.Context, conn migrationConn, table, index string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?",
+		table, index).Scan(&count)
+	return count > 0, err
+}
+
+func (b *mysqlBackend) dropIndexSQL(table, index string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", index, table)
+}
+
+// 使用 GET_LOCK 命名锁，连接断开时锁自动释放。MySQL 的 DDL 会隐式提交，
+// 迁移直接在持有锁的连接上执行，每个迁移完成后立即记录
+func (b *mysqlBackend) withMigrationLock(ctx context.Context, fn func(conn migrationConn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("timed out waiting for migration lock")
+	}
+	defer conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName).Scan(&locked)
+
+	return fn(conn)
+}
+
+func (b *mysqlBackend) timeValue(t time.Time) interface{} {
+	return t
+}
+
+// 按主键等值锁定已存在的行时只加行锁，不锁间隙
+func (b *mysqlBackend) forUpdate() string {
+	return " FOR UPDATE"
+}
+
+// 嵌入式 SQLite，数据保存在单个文件中
+type sqliteBackend struct {
+	path string
+}
+
+func (b *sqliteBackend) name() string {
+	return "sqlite"
+}
+
+// 开启外键（级联删除依赖外键），WAL 模式下读写互不阻塞；
+// 事务开始时即获取写锁，避免两个事务都读后再写时其中一个因升级锁失败
+func (b *sqliteBackend) open() (*sql.DB, error) {
+	if dir := filepath.Dir(b.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	dsn := b.path + "?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=30000&_txlock=immediate"
+	return sql.Open("sqlite3", dsn)
+}
+
+func (b *sqliteBackend) columnExists(ctx context.Context, conn migrationConn, table, column string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	return count > 0, err
+}
+
+func (b *sqliteBackend) indexExists(ctx context.Context, conn migrationConn, table, index string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_index_list(?) WHERE name = ?", table, index).Scan(&count)
+	return count > 0, err
+}
+
+func (b *sqliteBackend) dropIndexSQL(table, index string) string {
+	return "DROP INDEX " + index
+}
+
+// 全部迁移在一个事务中执行：事务开始时即获取写锁（_txlock=immediate），写锁就是迁移锁，
+// 其他实例等待写锁后会看到迁移已完成；SQLite 的 DDL 支持事务，失败时整体回滚
+func (b *sqliteBackend) withMigrationLock(ctx context.Context, fn func(conn migrationConn) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CURRENT_TIMESTAMP 在 SQLite 中保存为 UTC 的文本，比较时需使用相同的格式
+func (b *sqliteBackend) timeValue(t time.Time) interface{} {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// 事务开始时即获取写锁（_txlock=immediate），写事务已互相串行，不需要行锁
+func (b *sqliteBackend) forUpdate() string {
+	return ""
+}
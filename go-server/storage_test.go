@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 处理函数中的 SQL 由两种数据库共用，这里在 SQLite 上依次调用各接口，覆盖其中的查询和写入语句
+func TestHandlersSQLOnSQLite(t *testing.T) {
+	r := setupTestServer(t)
+	token, userID := registerTestUser(t, r, "alice")
+	adminToken, _ := registerTestUser(t, r, "root")
+	if _, err := db.Exec("UPDATE users SET is_admin = 1 WHERE username = ?", "root"); err != nil {
+		t.Fatal(err)
+	}
+	bankID := createTestBank(t, r, token, sampleQuestions())
+
+	var questionID, resultID, sessionID, wrongID string
+	id := func(target *string) func(map[string]interface{}) {
+		return func(resp map[string]interface{}) { *target, _ = resp["id"].(string) }
+	}
+
+	steps := []struct {
+		name    string
+		method  string
+		path    func() string
+		admin   bool
+		body    func() interface{}
+		want    int
+		capture func(map[string]interface{})
+	}{
+		{"list banks", "GET", func() string { return "/api/question-banks" }, false, nil, http.StatusOK, nil},
+		{"get bank", "GET", func() string { return "/api/question-banks/" + bankID }, false, nil, http.StatusOK, nil},
+		{"bank chapters", "GET", func() string { return "/api/question-banks/" + bankID + "/chapters" }, false, nil, http.StatusOK, nil},
+		{"create question", "POST", func() string { return "/api/questions" }, false, func() interface{} {
+			return gin.H{"bank_id": bankID, "question": "4 + 4 = ?", "options": []string{"8", "9"}, "answer": 0, "chapter": "一"}
+		}, http.StatusOK, id(&questionID)},
+		{"update question", "PUT", func() string { return "/api/questions/" + questionID }, false, func() interface{} {
+			return gin.H{"bank_id": bankID, "question": "4 + 4 = ?", "options": []string{"8", "9", "10"}, "answer": 0}
+		}, http.StatusOK, nil},
+		{"manage questions", "GET", func() string { return "/api/question-banks/" + bankID + "/questions?mode=manage" }, false, nil, http.StatusOK, nil},
+		{"export csv", "GET", func() string { return "/api/question-banks/" + bankID + "/export?format=csv" }, false, nil, http.StatusOK, nil},
+		{"add wrong question", "POST", func() string { return "/api/wrong-questions" }, false, func() interface{} {
+			return gin.H{"bankId": bankID, "questionId": questionID, "question": "4 + 4 = ?", "options": []string{"8", "9"}, "answer": 0}
+		}, http.StatusOK, id(&wrongID)},
+		{"list wrong questions", "GET", func() string { return "/api/wrong-questions" }, false, nil, http.StatusOK, nil},
+		{"remove wrong question", "DELETE", func() string { return "/api/wrong-questions/" + wrongID }, false, nil, http.StatusOK, nil},
+		{"start session", "POST", func() string { return "/api/exam-sessions" }, false, func() interface{} {
+			return gin.H{"bankId": bankID, "mode": "exam"}
+		}, http.StatusOK, id(&sessionID)},
+		{"get session", "GET", func() string { return "/api/exam-sessions/" + sessionID }, false, nil, http.StatusOK, nil},
+		{"submit session", "POST", func() string { return "/api/exam-sessions/" + sessionID + "/submit" }, false, func() interface{} {
+			return gin.H{"answers": []interface{}{}}
+		}, http.StatusOK, func(resp map[string]interface{}) {
+			result, _ := resp["result"].(map[string]interface{})
+			resultID, _ = result["id"].(string)
+		}},
+		{"list results", "GET", func() string { return "/api/exam-results" }, false, nil, http.StatusOK, nil},
+		{"result stats", "GET", func() string { return "/api/exam-results/stats" }, false, nil, http.StatusOK, nil},
+		{"result review", "GET", func() string { return "/api/exam-results/" + resultID + "/review" }, false, nil, http.StatusOK, nil},
+		{"compare results", "GET", func() string { return "/api/exam-results/compare?base=" + resultID + "&target=" + resultID }, false, nil, http.StatusOK, nil},
+		{"import jobs", "GET", func() string { return "/api/import-jobs" }, false, nil, http.StatusOK, nil},
+		{"admin users", "GET", func() string { return "/api/admin/users" }, true, nil, http.StatusOK, nil},
+		{"admin banks", "GET", func() string { return "/api/admin/question-banks" }, true, nil, http.StatusOK, nil},
+		{"admin stats", "GET", func() string { return "/api/admin/stats" }, true, nil, http.StatusOK, nil},
+		{"update settings", "PUT", func() string { return "/api/admin/settings" }, true, func() interface{} {
+			return gin.H{"platformName": "测试平台"}
+		}, http.StatusOK, nil},
+		{"settings history", "GET", func() string { return "/api/admin/settings/history" }, true, nil, http.StatusOK, nil},
+		{"disable user", "PATCH", func() string { return "/api/admin/users/" + userID }, true, func() interface{} {
+			return gin.H{"disabled": false}
+		}, http.StatusOK, nil},
+		{"delete question", "DELETE", func() string { return "/api/questions/" + questionID }, false, nil, http.StatusOK, nil},
+		{"delete result", "DELETE", func() string { return "/api/exam-results/" + resultID }, false, nil, http.StatusOK, nil},
+		{"delete bank", "DELETE", func() string { return "/api/question-banks/" + bankID }, false, nil, http.StatusOK, nil},
+	}
+
+	for _, step := range steps {
+		var body interface{}
+		if step.body != nil {
+			body = step.body()
+		}
+		tok := token
+		if step.admin {
+			tok = adminToken
+		}
+		w := doJSON(r, step.method, step.path(), tok, body)
+		if w.Code != step.want {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, w.Code, step.want, w.Body.String())
+		}
+		if step.capture != nil {
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			step.capture(resp)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,7 +12,7 @@ func getWrongQuestions(c *gin.Context) {
 	userID := c.GetString("userID")
 
 	query := `
-		SELECT wq.id, wq.user_id, wq.bank_id, wq.question_id, wq.question, wq.options, wq.answer, wq.explanation, wq.added_at, qb.name as bank_name
+		SELECT wq.id, wq.user_id, wq.bank_id, wq.question_id, wq.type, wq.question, wq.options, wq.answer, wq.answers, wq.accepted, wq.explanation, wq.format, wq.added_at, qb.name as bank_name, qb.user_id
 		FROM wrong_questions wq 
 		LEFT JOIN question_banks qb ON wq.bank_id = qb.id 
 		WHERE wq.user_id = ?
@@ -30,18 +30,29 @@ func getWrongQuestions(c *gin.Context) {
 	for rows.Next() {
 		var wq WrongQuestion
 		var optionsJSON string
-		err := rows.Scan(&wq.ID, &wq.UserID, &wq.BankID, &wq.QuestionID, &wq.Question, &optionsJSON, &wq.Answer, &wq.Explanation, &wq.AddedAt, &wq.BankName)
+		var answersJSON, acceptedJSON, bankOwner sql.NullString
+		err := rows.Scan(&wq.ID, &wq.UserID, &wq.BankID, &wq.QuestionID, &wq.Type, &wq.Question, &optionsJSON, &wq.Answer, &answersJSON, &acceptedJSON, &wq.Explanation, &wq.Format, &wq.AddedAt, &wq.BankName, &bankOwner)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		// 解析选项JSON
-		err = json.Unmarshal([]byte(optionsJSON), &wq.Options)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse options"})
+		// 解析选项及答案JSON
+		q := Question{Type: wq.Type}
+		if err := unmarshalQuestionJSON(&q, optionsJSON, answersJSON, acceptedJSON); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		wq.Type, wq.Options, wq.Answers, wq.Blanks, wq.AcceptedAnswers = q.Type, q.Options, q.Answers, q.Blanks, q.AcceptedAnswers
+
+		// 与题目接口一致，附带渲染后的 HTML。错题的 bank_id 由客户端提交，
+		// 只有题库属于当前用户时才为其中的媒体地址签名
+		q.Format, q.Question, q.Explanation = wq.Format, wq.Question, wq.Explanation
+		if bankOwner.String == userID {
+			q.BankID = wq.BankID
+		}
+		renderQuestion(&q)
+		wq.Rendered = q.Rendered
 
 		wrongQuestions = append(wrongQuestions, wq)
 	}
@@ -53,12 +64,17 @@ func addWrongQuestion(c *gin.Context) {
 	userID := c.GetString("userID")
 
 	var req struct {
-		BankID      string   `json:"bankId" binding:"required"`
-		QuestionID  string   `json:"questionId" binding:"required"`
-		Question    string   `json:"question" binding:"required"`
-		Options     []string `json:"options" binding:"required"`
-		Answer      int      `json:"answer"`
-		Explanation string   `json:"explanation"`
+		BankID          string     `json:"bankId" binding:"required"`
+		QuestionID      string     `json:"questionId" binding:"required"`
+		Type            string     `json:"type"`
+		Question        string     `json:"question" binding:"required"`
+		Options         []string   `json:"options"`
+		Answer          int        `json:"answer"`
+		Answers         []int      `json:"answers"`
+		Blanks          [][]string `json:"blanks"`
+		AcceptedAnswers []string   `json:"accepted_answers"`
+		Explanation     string     `json:"explanation"`
+		Format          string     `json:"format"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -80,8 +96,24 @@ func addWrongQuestion(c *gin.Context) {
 		return
 	}
 
-	// 序列化选项
-	optionsJSON, err := json.Marshal(req.Options)
+	q := Question{
+		Type:            req.Type,
+		Question:        req.Question,
+		Options:         req.Options,
+		Answer:          req.Answer,
+		Answers:         req.Answers,
+		Blanks:          req.Blanks,
+		AcceptedAnswers: req.AcceptedAnswers,
+		Explanation:     req.Explanation,
+		Format:          req.Format,
+	}
+	if err := normalizeQuestion(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 序列化选项及答案
+	optionsJSON, answersJSON, acceptedJSON, err := marshalQuestionJSON(q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal options"})
 		return
@@ -90,9 +122,9 @@ func addWrongQuestion(c *gin.Context) {
 	// 添加新的错题
 	wrongQuestionID := generateUUID()
 	_, err = db.Exec(`INSERT INTO wrong_questions 
-		(id, user_id, bank_id, question_id, question, options, answer, explanation) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		wrongQuestionID, userID, req.BankID, req.QuestionID, req.Question, string(optionsJSON), req.Answer, req.Explanation)
+		(id, user_id, bank_id, question_id, type, question, options, answer, answers, accepted, explanation, format) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		wrongQuestionID, userID, req.BankID, req.QuestionID, q.Type, q.Question, optionsJSON, q.Answer, answersJSON, acceptedJSON, q.Explanation, q.Format)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
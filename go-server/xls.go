@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/extrame/xls"
+)
+
+// OLE2 复合文档的文件头，旧版 .xls（BIFF8）工作簿以此开头
+var ole2Signature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// 根据文件头判断是否为旧版 .xls，读取后将文件指针恢复到开头
+func isOLE2File(file io.ReadSeeker) (bool, error) {
+	header := make([]byte, len(ole2Signature))
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return bytes.Equal(header[:n], ole2Signature), nil
+}
+
+// 打开旧版 .xls 的全部工作表。xls 库会一次读入整个工作簿，逐行读取时只是不再复制一份单元格
+func readXLSSheets(file io.ReadSeeker) (sheets []worksheet, err error) {
+	// xls 库遇到损坏的文件时可能 panic
+	defer func() {
+		if r := recover(); r != nil {
+			sheets, err = nil, fmt.Errorf("Excel文件解析失败: %v", r)
+		}
+	}()
+
+	workbook, err := xls.OpenReader(file, "utf-8")
+	if err != nil {
+		return nil, fmt.Errorf("Excel文件打开失败: %v", err)
+	}
+	if workbook == nil || workbook.NumSheets() == 0 {
+		return nil, fmt.Errorf("Excel文件中没有工作表")
+	}
+
+	for i := 0; i < workbook.NumSheets(); i++ {
+		sheet := workbook.GetSheet(i)
+		if sheet == nil {
+			continue
+		}
+		sheets = append(sheets, worksheet{name: sheet.Name, forEachRow: func(fn func([]string) error) error {
+			for j := 0; j <= int(sheet.MaxRow); j++ {
+				if err := fn(xlsRowValues(sheet, j)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}})
+	}
+	return sheets, nil
+}
+
+// 读取一行的单元格，空行返回 nil
+func xlsRowValues(sheet *xls.WorkSheet, index int) (values []string) {
+	// 不存在的行在 xls 库中会触发空指针 panic
+	defer func() {
+		if recover() != nil {
+			values = nil
+		}
+	}()
+
+	row := sheet.Row(index)
+	// LastCol 为最后一列的下一列
+	for col := 0; col < row.LastCol(); col++ {
+		values = append(values, row.Col(col))
+	}
+	return values
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+type testXLSSheet struct {
+	name string
+	rows [][]string
+}
+
+// 生成只含文本单元格的最小 BIFF8 工作簿：OLE2 复合文档中的 Workbook 流，
+// 依次为全局区（BOF、BOUNDSHEET、EOF）和各工作表（BOF、ROW、LABEL、EOF）
+func writeTestXLS(sheets []testXLSSheet) []byte {
+	record := func(buf *bytes.Buffer, id uint16, data []byte) {
+		binary.Write(buf, binary.LittleEndian, id)
+		binary.Write(buf, binary.LittleEndian, uint16(len(data)))
+		buf.Write(data)
+	}
+	bof := func(buf *bytes.Buffer, kind uint16) {
+		data := make([]byte, 16)
+		binary.LittleEndian.PutUint16(data, 0x600)
+		binary.LittleEndian.PutUint16(data[2:], kind)
+		record(buf, 0x809, data)
+	}
+	// BIFF8 字符串：长度之后为选项字节，0x01 表示 UTF-16LE
+	utf16Chars := func(s string) []byte {
+		var b bytes.Buffer
+		b.WriteByte(1)
+		binary.Write(&b, binary.LittleEndian, utf16.Encode([]rune(s)))
+		return b.Bytes()
+	}
+
+	var sheetData [][]byte
+	for _, sheet := range sheets {
+		var buf bytes.Buffer
+		bof(&buf, 0x10)
+		for i, row := range sheet.rows {
+			info := make([]byte, 16)
+			binary.LittleEndian.PutUint16(info, uint16(i))
+			binary.LittleEndian.PutUint16(info[4:], uint16(len(row)))
+			record(&buf, 0x208, info)
+			for j, cell := range row {
+				var label bytes.Buffer
+				binary.Write(&label, binary.LittleEndian, []uint16{uint16(i), uint16(j), 0, uint16(len(utf16.Encode([]rune(cell))))})
+				label.Write(utf16Chars(cell))
+				record(&buf, 0x204, label.Bytes())
+			}
+		}
+		record(&buf, 0x0a, nil)
+		sheetData = append(sheetData, buf.Bytes())
+	}
+
+	// 全局区的长度与工作表位置无关，先计算再写入各工作表的偏移
+	globalsSize := 20 + 4
+	for _, sheet := range sheets {
+		globalsSize += 4 + 7 + len(utf16Chars(sheet.name))
+	}
+	var stream bytes.Buffer
+	bof(&stream, 0x5)
+	offset := globalsSize
+	for i, sheet := range sheets {
+		var bs bytes.Buffer
+		binary.Write(&bs, binary.LittleEndian, uint32(offset))
+		bs.Write([]byte{0, 0, byte(len(utf16.Encode([]rune(sheet.name))))})
+		bs.Write(utf16Chars(sheet.name))
+		record(&stream, 0x85, bs.Bytes())
+		offset += len(sheetData[i])
+	}
+	record(&stream, 0x0a, nil)
+	for _, data := range sheetData {
+		stream.Write(data)
+	}
+
+	// 复合文档：扇区 0 为 FAT，扇区 1 为目录，之后是 Workbook 流
+	const sectorSize = 512
+	streamSectors := (stream.Len() + sectorSize - 1) / sectorSize
+	stream.Write(make([]byte, streamSectors*sectorSize-stream.Len()))
+
+	header := make([]byte, sectorSize)
+	copy(header, ole2Signature)
+	binary.LittleEndian.PutUint16(header[24:], 0x3e)
+	binary.LittleEndian.PutUint16(header[26:], 3)
+	binary.LittleEndian.PutUint16(header[28:], 0xfffe)
+	binary.LittleEndian.PutUint16(header[30:], 9)
+	binary.LittleEndian.PutUint16(header[32:], 6)
+	binary.LittleEndian.PutUint32(header[44:], 1)          // FAT 扇区数
+	binary.LittleEndian.PutUint32(header[48:], 1)          // 目录起始扇区
+	binary.LittleEndian.PutUint32(header[56:], 0)          // 所有流都按普通扇区读取
+	binary.LittleEndian.PutUint32(header[60:], 0xfffffffe) // 无短扇区表
+	binary.LittleEndian.PutUint32(header[68:], 0xfffffffe) // 无 DIFAT 扇区
+	for i := 76; i < sectorSize; i += 4 {
+		binary.LittleEndian.PutUint32(header[i:], 0xffffffff)
+	}
+	binary.LittleEndian.PutUint32(header[76:], 0)
+
+	fat := make([]uint32, sectorSize/4)
+	for i := range fat {
+		fat[i] = 0xffffffff
+	}
+	fat[0], fat[1] = 0xfffffffd, 0xfffffffe
+	for i := 0; i < streamSectors; i++ {
+		fat[2+i] = uint32(3 + i)
+	}
+	fat[1+streamSectors] = 0xfffffffe
+
+	dirEntry := func(name string, kind byte, start, size uint32) []byte {
+		entry := make([]byte, 128)
+		chars := utf16.Encode([]rune(name))
+		for i, c := range chars {
+			binary.LittleEndian.PutUint16(entry[2*i:], c)
+		}
+		binary.LittleEndian.PutUint16(entry[64:], uint16(2*(len(chars)+1)))
+		entry[66] = kind
+		binary.LittleEndian.PutUint32(entry[68:], 0xffffffff)
+		binary.LittleEndian.PutUint32(entry[72:], 0xffffffff)
+		binary.LittleEndian.PutUint32(entry[76:], 0xffffffff)
+		binary.LittleEndian.PutUint32(entry[116:], start)
+		binary.LittleEndian.PutUint32(entry[120:], size)
+		return entry
+	}
+	root := dirEntry("Root Entry", 5, 0xfffffffe, 0)
+	binary.LittleEndian.PutUint32(root[76:], 1)
+
+	var file bytes.Buffer
+	file.Write(header)
+	binary.Write(&file, binary.LittleEndian, fat)
+	file.Write(root)
+	file.Write(dirEntry("Workbook", 2, 2, uint32(stream.Len())))
+	file.Write(make([]byte, sectorSize-256))
+	file.Write(stream.Bytes())
+	return file.Bytes()
+}
+
+func TestParseXLSFile(t *testing.T) {
+	header := []string{"题目", "选项A", "选项B", "选项C", "正确答案", "解析"}
+	tests := []struct {
+		name         string
+		sheets       []testXLSSheet
+		selected     []string
+		wantErr      string
+		wantQuestion []string
+		wantChapters []string
+		wantOptions  [][]string
+		wantErrors   int
+	}{
+		{
+			name: "single sheet",
+			sheets: []testXLSSheet{{"Sheet1", [][]string{
+				header,
+				{"一加一等于几", "1", "2", "3", "B", "基础算术"},
+				{"两个选项", "是", "否", "", "A", ""},
+			}}},
+			wantQuestion: []string{"一加一等于几", "两个选项"},
+			wantChapters: []string{"", ""},
+			wantOptions:  [][]string{{"1", "2", "3"}, {"是", "否"}},
+		},
+		{
+			name: "sheets become chapters",
+			sheets: []testXLSSheet{
+				{"第一章", [][]string{header, {"甲", "1", "2", "", "A", ""}}},
+				{"第二章", [][]string{header, {"乙", "1", "2", "", "B", ""}}},
+			},
+			wantQuestion: []string{"甲", "乙"},
+			wantChapters: []string{"第一章", "第二章"},
+			wantOptions:  [][]string{{"1", "2"}, {"1", "2"}},
+		},
+		{
+			name: "selected sheet",
+			sheets: []testXLSSheet{
+				{"第一章", [][]string{header, {"甲", "1", "2", "", "A", ""}}},
+				{"第二章", [][]string{header, {"乙", "1", "2", "", "B", ""}}},
+			},
+			selected:     []string{"第二章"},
+			wantQuestion: []string{"乙"},
+			wantChapters: []string{"第二章"},
+			wantOptions:  [][]string{{"1", "2"}},
+		},
+		{
+			name: "invalid answer is a row error",
+			sheets: []testXLSSheet{{"Sheet1", [][]string{
+				header,
+				{"有效", "1", "2", "", "A", ""},
+				{"答案无效", "1", "2", "", "D", ""},
+			}}},
+			wantQuestion: []string{"有效"},
+			wantChapters: []string{""},
+			wantOptions:  [][]string{{"1", "2"}},
+			wantErrors:   1,
+		},
+		{
+			name:    "missing columns",
+			sheets:  []testXLSSheet{{"Sheet1", [][]string{{"题目", "答案"}, {"甲", "A"}}}},
+			wantErr: "缺少必要的列",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := writeTestXLS(tt.sheets)
+			report := &ImportReport{Rows: []ImportRowResult{}}
+			var got []Question
+			opts := importOptions{Sheets: tt.selected}
+			err := parseUploadedFile(memFile{bytes.NewReader(data)}, "bank.xls", int64(len(data)), opts, report, func(q Question) error {
+				got = append(got, q)
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Errors != tt.wantErrors {
+				t.Errorf("errors = %d, want %d: %+v", report.Errors, tt.wantErrors, report.Rows)
+			}
+
+			var questions, chapters []string
+			var options [][]string
+			for _, q := range got {
+				questions = append(questions, q.Question)
+				chapters = append(chapters, q.Chapter)
+				options = append(options, q.Options)
+			}
+			if !reflect.DeepEqual(questions, tt.wantQuestion) {
+				t.Errorf("questions = %q, want %q", questions, tt.wantQuestion)
+			}
+			if !reflect.DeepEqual(chapters, tt.wantChapters) {
+				t.Errorf("chapters = %q, want %q", chapters, tt.wantChapters)
+			}
+			if !reflect.DeepEqual(options, tt.wantOptions) {
+				t.Errorf("options = %q, want %q", options, tt.wantOptions)
+			}
+		})
+	}
+}
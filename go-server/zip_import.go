@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 压缩包中可作为题目文件的格式（.txt 通常是说明文件，不作为 GIFT 处理）
+var bundleManifestExtensions = map[string]bool{".json": true, ".csv": true, ".xlsx": true, ".xls": true, ".xml": true, ".gift": true}
+
+// 压缩包中有多个题目文件时，使用以这些名称命名的文件
+var bundleManifestNames = map[string]bool{"manifest": true, "questions": true, "题库": true}
+
+// 题目内容中的图片引用：Markdown 的 ![说明](路径) 和 HTML 的 <img src="路径">
+var (
+	markdownImage = regexp.MustCompile(`(!\[[^\]]*\]\()([^)\s]+)(\))`)
+	htmlImage     = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*["'])([^"']+)(["'])`)
+)
+
+// 题目文件加图片的压缩包。题目、选项和解析中以相对路径（相对于题目文件所在目录）引用的图片
+// 在写入题目前保存为题库的媒体文件，引用改写为媒体地址
+type zipBundle struct {
+	files    map[string]*zip.File // 按规范化后的路径索引
+	manifest string               // 题目文件在压缩包中的路径
+	temp     *os.File             // 解压出的题目文件
+
+	exec   execer // 为 nil 时（dryRun）只检查引用的图片是否存在
+	bankID string
+	stored map[string]string // 已保存的图片路径对应的媒体地址（mediaURL，不带签名）
+	keys   []string          // 本次保存的文件，导入失败时删除
+	err    error             // 保存图片失败时的错误
+
+	rewritten int // 已改写的图片引用数
+}
+
+func openZipBundle(file multipart.File, size int64, exec execer, bankID string) (*zipBundle, error) {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("压缩包解析失败: %v", err)
+	}
+
+	bundle := &zipBundle{
+		files:  make(map[string]*zip.File),
+		exec:   exec,
+		bankID: bankID,
+		stored: make(map[string]string),
+	}
+	var candidates []string
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := zipEntryName(f)
+		// 跳过 macOS 压缩时附带的元数据和隐藏文件
+		if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		bundle.files[name] = f
+		if bundleManifestExtensions[strings.ToLower(path.Ext(name))] {
+			candidates = append(candidates, name)
+		}
+	}
+
+	bundle.manifest, err = pickBundleManifest(candidates)
+	if err != nil {
+		return nil, err
+	}
+	if err := bundle.extractManifest(); err != nil {
+		bundle.close(false)
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// 规范化压缩包内的路径。未标记 UTF-8 且不是合法 UTF-8 的文件名按 GBK 解码（Windows 自带压缩工具的默认编码）
+func zipEntryName(f *zip.File) string {
+	name := f.Name
+	if f.NonUTF8 && !utf8.ValidString(name) {
+		if decoded, err := simplifiedchinese.GBK.NewDecoder().String(name); err == nil {
+			name = decoded
+		}
+	}
+	return path.Clean(strings.ReplaceAll(name, "\\", "/"))
+}
+
+func pickBundleManifest(candidates []string) (string, error) {
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("压缩包中没有题目文件（JSON、CSV、Excel、Moodle XML 或 GIFT）")
+	}
+
+	var named []string
+	for _, name := range candidates {
+		base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		if bundleManifestNames[strings.ToLower(base)] {
+			named = append(named, name)
+		}
+	}
+	if len(named) != 1 {
+		return "", fmt.Errorf("压缩包中有多个题目文件，请将题目文件命名为 manifest、questions 或 题库")
+	}
+	return named[0], nil
+}
+
+// 将题目文件解压到临时文件，Excel 需要随机读取
+func (b *zipBundle) extractManifest() error {
+	rc, err := b.files[b.manifest].Open()
+	if err != nil {
+		return fmt.Errorf("读取题目文件失败: %v", err)
+	}
+	defer rc.Close()
+
+	b.temp, err = os.CreateTemp("", "bundle_*"+path.Ext(b.manifest))
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+
+	// 解压后的大小同样受上传大小限制
+	limit := maxUploadBytes()
+	n, err := io.Copy(b.temp, io.LimitReader(rc, limit+1))
+	if err != nil {
+		return fmt.Errorf("读取题目文件失败: %v", err)
+	}
+	if n > limit {
+		return fmt.Errorf("题目文件解压后超过 %d MB", limit>>20)
+	}
+	_, err = b.temp.Seek(0, io.SeekStart)
+	return err
+}
+
+func (b *zipBundle) manifestSize() int64 {
+	info, err := b.temp.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// 删除临时文件；导入未成功时同时删除本次保存的图片
+func (b *zipBundle) close(succeeded bool) {
+	if b.temp != nil {
+		b.temp.Close()
+		os.Remove(b.temp.Name())
+	}
+	if !succeeded {
+		deleteMediaFiles(b.keys)
+	}
+}
+
+// 改写题目、选项和解析中的图片引用。题目内容保存不带签名的媒体地址，返回题目时再换成签名地址（见 signMediaURLs）；
+// 纯文本不会显示图片，有图片引用被改写的 plain 题目改为 markdown
+func (b *zipBundle) rewriteQuestion(q *Question) error {
+	rewritten := b.rewritten
+	err := b.rewriteFields(q)
+	if err == nil && q.Format == contentFormatPlain && b.rewritten > rewritten {
+		q.Format = contentFormatMarkdown
+	}
+	if err == nil || b.err != nil {
+		return err
+	}
+	// 图片不存在、格式不支持或过大只影响这道题目；保存失败（b.err）时停止导入
+	return &rowError{reason: err.Error()}
+}
+
+func (b *zipBundle) rewriteFields(q *Question) error {
+	var err error
+	if q.Question, err = b.rewrite(q.Question); err != nil {
+		return err
+	}
+	if q.Explanation, err = b.rewrite(q.Explanation); err != nil {
+		return err
+	}
+	for i := range q.Options {
+		if q.Options[i], err = b.rewrite(q.Options[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *zipBundle) rewrite(text string) (string, error) {
+	var err error
+	for _, pattern := range []*regexp.Regexp{markdownImage, htmlImage} {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			parts := pattern.FindStringSubmatch(match)
+			target, resolveErr := b.resolve(parts[2])
+			if resolveErr != nil {
+				if err == nil {
+					err = resolveErr
+				}
+				return match
+			}
+			if target != parts[2] {
+				b.rewritten++
+			}
+			return parts[1] + target + parts[3]
+		})
+	}
+	return text, err
+}
+
+// 将压缩包内的相对路径换成媒体地址，外部链接和绝对路径保持不变
+func (b *zipBundle) resolve(ref string) (string, error) {
+	if strings.Contains(ref, "://") || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "data:") {
+		return ref, nil
+	}
+	if unescaped, err := url.PathUnescape(ref); err == nil {
+		ref = unescaped
+	}
+
+	name := path.Join(path.Dir(b.manifest), ref)
+	if target, ok := b.stored[name]; ok {
+		return target, nil
+	}
+
+	f, ok := b.files[name]
+	if !ok {
+		return "", fmt.Errorf("引用的图片不存在: %s", ref)
+	}
+	if !imageExtensions[strings.ToLower(path.Ext(name))] {
+		return "", fmt.Errorf("不支持的图片格式: %s", ref)
+	}
+	if limit := maxMediaBytes(); f.UncompressedSize64 > uint64(limit) {
+		return "", fmt.Errorf("图片 %s 超过 %d MB", ref, limit>>20)
+	}
+	if b.exec == nil {
+		return ref, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("读取图片失败: %s", ref)
+	}
+	defer rc.Close()
+
+	media, err := saveMedia(b.exec, b.bankID, name, rc)
+	if err != nil {
+		b.err = fmt.Errorf("保存图片失败: %v", err)
+		return "", b.err
+	}
+	b.keys = append(b.keys, media.storageKey)
+	b.stored[name] = media.URL
+	return media.URL, nil
+}
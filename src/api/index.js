@@ -12,26 +12,76 @@ const getToken = () => {
   return localStorage.getItem('token')
 }
 
+// 获取刷新令牌
+const getRefreshToken = () => {
+  return localStorage.getItem('refreshToken')
+}
+
+// 用刷新令牌换取新的访问令牌，多个请求同时过期时只刷新一次
+let refreshing = null
+function refreshAccessToken() {
+  const refreshToken = getRefreshToken()
+  if (!refreshToken) {
+    return Promise.resolve(false)
+  }
+  if (!refreshing) {
+    refreshing = fetch(`${API_BASE_URL}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken }),
+    })
+      .then(async (response) => {
+        if (!response.ok) {
+          localStorage.removeItem('refreshToken')
+          return false
+        }
+        const result = await response.json()
+        localStorage.setItem('token', result.token)
+        localStorage.setItem('refreshToken', result.refreshToken)
+        return true
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
+// 携带认证头发送请求，访问令牌过期（401）时刷新后重试一次
+async function fetchWithAuth(url, options = {}, retry = true) {
+  const send = () => {
+    const headers = { ...options.headers }
+    const token = getToken()
+    if (token) {
+      headers.Authorization = `Bearer ${token}`
+    }
+    return fetch(url, { ...options, headers })
+  }
+
+  const response = await send()
+  if (response.status === 401 && retry && await refreshAccessToken()) {
+    return send()
+  }
+  return response
+}
+
 // 通用请求函数
 async function request(url, options = {}) {
   try {
     console.log(`API请求: ${API_BASE_URL}${url}`, options);
     
-    // 添加认证头
     const headers = {
       'Content-Type': 'application/json',
       ...options.headers,
     }
     
-    const token = getToken()
-    if (token) {
-      headers.Authorization = `Bearer ${token}`
-    }
-    
-    const response = await fetch(`${API_BASE_URL}${url}`, {
-      headers,
+    // 登录、注册等认证接口返回 401 时不需要刷新令牌
+    const retry = !url.startsWith('/auth/') || url === '/auth/me' || url === '/auth/logout-all'
+    const response = await fetchWithAuth(`${API_BASE_URL}${url}`, {
       ...options,
-    });
+      headers,
+    }, retry);
 
     console.log(`API响应状态: ${response.status}`);
 
@@ -63,7 +113,7 @@ export const questionBankAPI = {
   // 获取所有题库
   getAll: () => request('/question-banks'),
   
-  // 获取单个题库详情
+  // 获取单个题库详情（不含答案）
   getById: (id) => request(`/question-banks/${id}`),
   
   // 创建题库
@@ -75,16 +125,8 @@ export const questionBankAPI = {
   // 上传题库文件
   uploadFile: async (bankId, formData) => {
     try {
-      const token = getToken()
-      const headers = {}
-      
-      if (token) {
-        headers.Authorization = `Bearer ${token}`
-      }
-      
-      const response = await fetch(`${API_BASE_URL}/question-banks/${bankId}/upload`, {
+      const response = await fetchWithAuth(`${API_BASE_URL}/question-banks/${bankId}/upload`, {
         method: 'POST',
-        headers,
         body: formData,
       })
 
@@ -111,8 +153,8 @@ export const questionBankAPI = {
     method: 'DELETE',
   }),
 
-  // 获取题库题目
-  getQuestions: (bankId) => request(`/question-banks/${bankId}/questions`),
+  // 获取题库题目（含答案，仅供题库编辑使用）
+  getQuestions: (bankId) => request(`/question-banks/${bankId}/questions?mode=manage`),
   
   // 添加题目到题库
   addQuestion: (data) => request('/questions', {
@@ -154,6 +196,30 @@ export const wrongQuestionAPI = {
   }),
 };
 
+// 考试会话相关API：题目不含答案，由服务端判分，交卷后再获取答案和解析
+export const examSessionAPI = {
+  // 开始考试，返回会话和题目
+  start: (data) => request('/exam-sessions', {
+    method: 'POST',
+    body: JSON.stringify(data),
+  }),
+
+  // 保存单题答案
+  answer: (sessionId, questionId, data) => request(`/exam-sessions/${sessionId}/answers/${questionId}`, {
+    method: 'PUT',
+    body: JSON.stringify(data),
+  }),
+
+  // 交卷，返回服务端判分的考试结果
+  submit: (sessionId, answers = []) => request(`/exam-sessions/${sessionId}/submit`, {
+    method: 'POST',
+    body: JSON.stringify({ answers }),
+  }),
+
+  // 获取答案和解析（交卷后）
+  reveal: (sessionId) => request(`/exam-sessions/${sessionId}/reveal`),
+};
+
 // 考试结果相关API
 export const examResultAPI = {
   // 保存考试结果
@@ -182,6 +248,17 @@ export const authAPI = {
   
   // 获取当前用户信息
   getCurrentUser: () => request('/auth/me'),
+
+  // 退出登录（作废刷新令牌）
+  logout: (refreshToken) => request('/auth/logout', {
+    method: 'POST',
+    body: JSON.stringify({ refreshToken }),
+  }),
+
+  // 退出所有设备上的登录
+  logoutAll: () => request('/auth/logout-all', {
+    method: 'POST',
+  }),
 };
 
 // 管理员相关API
@@ -200,6 +277,11 @@ export const adminAPI = {
     method: 'DELETE',
   }),
   
+  // 强制用户退出所有登录
+  logoutUser: (id) => request(`/admin/users/${id}/logout`, {
+    method: 'POST',
+  }),
+  
   // 获取所有题库
   getQuestionBanks: () => request('/admin/question-banks'),
   
@@ -217,8 +299,8 @@ export const adminAPI = {
     body: JSON.stringify(data),
   }),
   
-  // 获取题库题目
-  getQuestions: (bankId) => request(`/question-banks/${bankId}/questions`),
+  // 获取题库题目（含答案，仅供题目编辑使用）
+  getQuestions: (bankId) => request(`/question-banks/${bankId}/questions?mode=manage`),
   
   // 更新题库信息
   updateQuestionBank: (id, data) => request(`/question-banks/${id}`, {
@@ -38,6 +38,7 @@ export const useAuthStore = defineStore('auth', {
         this.isAuthenticated = true
         
         localStorage.setItem('token', response.token)
+        localStorage.setItem('refreshToken', response.refreshToken)
         ElMessage.success('注册成功！')
         
         return response
@@ -60,6 +61,7 @@ export const useAuthStore = defineStore('auth', {
         this.isAuthenticated = true
         
         localStorage.setItem('token', response.token)
+        localStorage.setItem('refreshToken', response.refreshToken)
         ElMessage.success('登录成功！')
         
         return response
@@ -84,16 +86,33 @@ export const useAuthStore = defineStore('auth', {
       }
     },
 
-    // 用户登出
+    // 用户登出，同时通知服务端作废刷新令牌
     logout() {
+      const refreshToken = localStorage.getItem('refreshToken')
+      if (refreshToken) {
+        authAPI.logout(refreshToken).catch(() => {})
+      }
+
       this.user = null
       this.token = null
       this.isAuthenticated = false
       
       localStorage.removeItem('token')
+      localStorage.removeItem('refreshToken')
       ElMessage.success('已退出登录')
     },
 
+    // 退出所有设备上的登录
+    async logoutAll() {
+      try {
+        await authAPI.logoutAll()
+      } catch (error) {
+        ElMessage.error(error.message || '操作失败')
+        throw error
+      }
+      this.logout()
+    },
+
     // 更新token
     setToken(token) {
       this.token = token
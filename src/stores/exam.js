@@ -1,5 +1,5 @@
 import { defineStore } from 'pinia'
-import { questionBankAPI, wrongQuestionAPI, examResultAPI } from '../api'
+import { questionBankAPI, wrongQuestionAPI, examResultAPI, examSessionAPI } from '../api'
 import { ElMessage } from 'element-plus'
 
 export const useExamStore = defineStore('exam', {
@@ -129,10 +129,15 @@ export const useExamStore = defineStore('exam', {
         const wrongQuestionData = {
           bankId,
           questionId: question.id || Date.now().toString(),
+          type: question.type,
           question: question.question,
           options: question.options,
           answer: question.answer,
-          explanation: question.explanation
+          answers: question.answers,
+          blanks: question.blanks,
+          accepted_answers: question.accepted_answers,
+          explanation: question.explanation,
+          format: question.format
         }
         
         await wrongQuestionAPI.add(wrongQuestionData)
@@ -174,6 +179,38 @@ export const useExamStore = defineStore('exam', {
       this.currentExam = exam
     },
 
+    // 开始考试会话，题目顺序由服务端打乱
+    async startExamSession(bankId) {
+      try {
+        return await examSessionAPI.start({ bankId, shuffle: true })
+      } catch (error) {
+        ElMessage.error('开始考试失败: ' + error.message)
+        throw error
+      }
+    },
+
+    // 保存单题答案，交卷时服务端按已保存的答案判分
+    async saveSessionAnswer(sessionId, questionId, answer) {
+      try {
+        await examSessionAPI.answer(sessionId, questionId, { answer })
+      } catch (error) {
+        ElMessage.error('保存答案失败: ' + error.message)
+        console.error('Failed to save answer:', error)
+      }
+    },
+
+    // 交卷并获取答案和解析
+    async submitExamSession(sessionId) {
+      try {
+        const submitted = await examSessionAPI.submit(sessionId)
+        const revealed = await examSessionAPI.reveal(sessionId)
+        return { result: submitted.result, revealed: revealed || [] }
+      } catch (error) {
+        ElMessage.error('交卷失败: ' + error.message)
+        throw error
+      }
+    },
+
     // 保存考试结果
     async saveExamResult(result) {
       try {